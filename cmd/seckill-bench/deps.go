@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"rag-agent/config"
+	"rag-agent/internal/domain/seckill"
+	"rag-agent/internal/infrastructure/mq"
+	"rag-agent/internal/infrastructure/mysql"
+	redisinfra "rag-agent/internal/infrastructure/redis"
+	"rag-agent/pkg/snowflake"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	workerIDPrefix = "seckill:snowflake:worker:" // 与 cmd/server 相同，避免与服务实例的订单ID冲突
+	workerIDTTL    = 30 * time.Second
+	consumerGroup  = "seckill_bench_group"
+)
+
+// deps 压测依赖：MySQL、Redis 和 direct 模式下的秒杀服务
+type deps struct {
+	db       *sql.DB
+	redis    *redis.Client
+	lease    *snowflake.WorkerLease
+	broker   *mq.MemoryBroker
+	consumer mq.Consumer
+
+	repo    seckill.Repository
+	cache   seckill.CacheRepository
+	service *seckill.Service
+}
+
+// newDeps 按配置连接 MySQL 和 Redis 并构建秒杀服务
+// 订单消息通过进程内消息队列交给 OrderConsumer 异步处理，压测 direct 模式不依赖 RocketMQ
+func newDeps(ctx context.Context, cfg *config.Config) (_ *deps, err error) {
+	// 出错时返回 nil，defer 中关闭局部变量 d 上已创建的资源
+	d := &deps{}
+	defer func() {
+		if err != nil {
+			d.close()
+		}
+	}()
+
+	if err := seckill.ValidateTokenConfig(&cfg.Seckill); err != nil {
+		return nil, err
+	}
+
+	d.db, err = mysql.NewClient(mysql.Config{
+		DSN:             cfg.MySQL.DSN,
+		MaxOpenConns:    cfg.MySQL.MaxOpenConns,
+		MaxIdleConns:    cfg.MySQL.MaxIdleConns,
+		ConnMaxLifetime: cfg.MySQL.ConnMaxLifetime,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("初始化 MySQL 失败: %w", err)
+	}
+
+	d.redis, err = redisinfra.NewClient(redisinfra.Config{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("初始化 Redis 失败: %w", err)
+	}
+
+	d.lease, err = snowflake.AcquireWorkerID(ctx, d.redis, workerIDPrefix, workerIDTTL)
+	if err != nil {
+		return nil, fmt.Errorf("租用 Snowflake workerID 失败: %w", err)
+	}
+	idGen := snowflake.NewLeasedGenerator(d.lease)
+
+	d.repo = seckill.NewMySQLRepository(d.db)
+	d.cache = seckill.NewRedisCacheRepository(d.redis)
+	locker := seckill.NewRedisLocker(redisinfra.NewLocker(d.redis, cfg.Seckill.LockPrefix, cfg.Seckill.LockExpire), 0)
+
+	d.broker = mq.NewMemoryBroker(mq.MemoryConfig{
+		MaxReconsumeTimes: cfg.MQ.MaxReconsumeTimes,
+		RetryDelay:        cfg.MQ.RetryDelay,
+		CheckTransaction:  seckill.NewOrderTransactionChecker(d.cache),
+	})
+	orderConsumer := seckill.NewOrderConsumer(d.repo, d.cache, &cfg.Seckill)
+	d.consumer, err = d.broker.NewConsumer(mq.ConsumerConfig{
+		GroupName:         consumerGroup,
+		Topic:             cfg.RocketMQ.Topic,
+		Tag:               seckill.OrderMessageTag,
+		MaxReconsumeTimes: cfg.MQ.MaxReconsumeTimes,
+	}, orderConsumer.HandleMessage)
+	if err != nil {
+		return nil, fmt.Errorf("初始化订单消费者失败: %w", err)
+	}
+	if err := d.consumer.Start(); err != nil {
+		return nil, fmt.Errorf("启动订单消费者失败: %w", err)
+	}
+	producer := seckill.NewOrderMQProducer(d.broker, cfg.RocketMQ.Topic)
+	if cfg.MQ.Transactional {
+		producer = seckill.NewTransactionalOrderMQProducer(d.broker, d.broker, cfg.RocketMQ.Topic)
+	}
+
+	// 排队模式需要后台放行，压测时直接放行所有用户
+	seckillCfg := cfg.Seckill
+	seckillCfg.QueueEnabled = false
+	d.service = seckill.NewService(d.repo, d.cache, producer, idGen, locker, &seckillCfg)
+
+	return d, nil
+}
+
+// close 停止订单消费者，释放 workerID 并关闭连接
+func (d *deps) close() {
+	if d.consumer != nil {
+		d.consumer.Shutdown()
+	}
+	if d.broker != nil {
+		d.broker.Shutdown()
+	}
+	if d.lease != nil {
+		if err := d.lease.Close(context.Background()); err != nil {
+			log.Printf("释放 Snowflake workerID 失败: %v", err)
+		}
+	}
+	if d.redis != nil {
+		d.redis.Close()
+	}
+	if d.db != nil {
+		d.db.Close()
+	}
+}
+
+// stockReport 库存校验结果
+type stockReport struct {
+	totalStock     int64
+	activeOrders   int64 // 有效订单（待支付、已支付）
+	releasedOrders int64 // 已归还库存的订单（已取消、已退款）
+	boughtUsers    int64 // Redis 已购用户数
+	mysqlStock     int64
+	redisStock     int64
+	inFlight       int64 // 等待超时后仍未落库的订单
+}
+
+// ok MySQL: 有效订单数 + 剩余库存 = 总库存；Redis: 已扣减未归还的数量 + 剩余库存 = 总库存
+func (r *stockReport) ok() bool {
+	return r.inFlight == 0 &&
+		r.activeOrders+r.mysqlStock == r.totalStock &&
+		r.boughtUsers-r.releasedOrders+r.redisStock == r.totalStock
+}
+
+func (r *stockReport) print(w io.Writer) {
+	fmt.Fprintf(w, "\n库存校验: 总库存=%d, 有效订单=%d, 已归还订单=%d, 未落库订单=%d\n",
+		r.totalStock, r.activeOrders, r.releasedOrders, r.inFlight)
+	fmt.Fprintf(w, "  MySQL: 有效订单 %d + 剩余库存 %d = %d\n",
+		r.activeOrders, r.mysqlStock, r.activeOrders+r.mysqlStock)
+	fmt.Fprintf(w, "  Redis: 已购用户 %d - 已归还 %d + 剩余库存 %d = %d\n",
+		r.boughtUsers, r.releasedOrders, r.redisStock, r.boughtUsers-r.releasedOrders+r.redisStock)
+	if r.ok() {
+		fmt.Fprintln(w, "  结果: 通过，没有超卖")
+	} else {
+		fmt.Fprintln(w, "  结果: 不一致")
+	}
+}
+
+// verify 等待异步订单落库（最长 settle），然后读取 MySQL 和 Redis 库存进行校验
+func (d *deps) verify(ctx context.Context, couponID int64, settle time.Duration) (*stockReport, error) {
+	deadline := time.Now().Add(settle)
+	for {
+		report, err := d.stockReport(ctx, couponID)
+		if err != nil {
+			return nil, err
+		}
+		if report.inFlight == 0 || time.Now().After(deadline) {
+			return report, nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func (d *deps) stockReport(ctx context.Context, couponID int64) (*stockReport, error) {
+	coupon, err := d.repo.GetCoupon(ctx, couponID)
+	if err != nil {
+		return nil, err
+	}
+	active, released, err := d.repo.CountOrders(ctx, couponID)
+	if err != nil {
+		return nil, err
+	}
+	bought, err := d.cache.CountBoughtUsers(ctx, couponID)
+	if err != nil {
+		return nil, err
+	}
+	redisStock, err := d.cache.GetStock(ctx, couponID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stockReport{
+		totalStock:     coupon.TotalStock,
+		activeOrders:   active,
+		releasedOrders: released,
+		boughtUsers:    bought,
+		mysqlStock:     coupon.RemainStock,
+		redisStock:     redisStock,
+		inFlight:       max(bought-active-released, 0),
+	}, nil
+}
@@ -0,0 +1,123 @@
+// seckill-bench 秒杀压测工具
+//
+// 以 N 个虚拟用户（每人一次请求）并发抢购同一优惠券，可通过 HTTP 调用秒杀接口，
+// 也可以直接调用 seckill.Service（订单消息同步交给 OrderConsumer 处理，不依赖 RocketMQ）。
+// 结束后输出延迟分布和成功/售罄/拒绝/错误计数，并校验 Redis 与 MySQL 中
+// 订单数 + 剩余库存 = 总库存，即没有超卖。
+//
+// 用法:
+//
+//	go run ./cmd/seckill-bench -mode direct -coupon 1 -users 5000 -concurrency 200 -init
+//	go run ./cmd/seckill-bench -mode http -url http://localhost:8080/api/v1/seckill -coupon 1 -users 5000
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"rag-agent/config"
+)
+
+func main() {
+	os.Exit(runBench())
+}
+
+// runBench 执行压测并返回进程退出码；通过返回而不是 os.Exit 退出，保证 defer 释放消费者、消息队列和 workerID
+func runBench() int {
+	var (
+		configPath  = flag.String("config", "./config.yaml", "配置文件路径（用于连接 MySQL/Redis 校验库存，direct 模式还用于构建秒杀服务）")
+		mode        = flag.String("mode", "direct", "压测方式: http-调用秒杀接口, direct-直接调用 seckill.Service")
+		baseURL     = flag.String("url", "http://localhost:8080/api/v1/seckill", "http 模式下秒杀接口前缀")
+		couponID    = flag.Int64("coupon", 1, "目标优惠券ID")
+		users       = flag.Int("users", 1000, "虚拟用户数（每人请求一次）")
+		userStart   = flag.Int64("user-start", 1_000_000, "虚拟用户起始ID，多次压测同一优惠券时应错开")
+		concurrency = flag.Int("concurrency", 100, "并发数")
+		initStock   = flag.Bool("init", false, "压测前按 MySQL 剩余库存初始化 Redis 库存")
+		verify      = flag.Bool("verify", true, "压测后校验库存（订单数 + 剩余库存 = 总库存）")
+		settle      = flag.Duration("settle", 30*time.Second, "校验前等待异步订单落库的最长时间")
+	)
+	flag.Parse()
+
+	if err := config.LoadConfig(*configPath); err != nil {
+		log.Fatalf("加载配置文件失败: %v", err)
+	}
+	cfg := config.GetConfig()
+
+	ctx := context.Background()
+
+	deps, err := newDeps(ctx, cfg)
+	if err != nil {
+		log.Printf("初始化依赖失败: %v", err)
+		return 1
+	}
+	defer deps.close()
+
+	if *initStock {
+		if err := deps.service.InitStock(ctx, *couponID); err != nil {
+			log.Printf("初始化库存失败: %v", err)
+			return 1
+		}
+	}
+
+	var t target
+	switch *mode {
+	case "http":
+		t = newHTTPTarget(*baseURL, cfg.Seckill.TokenEnabled)
+	case "direct":
+		t = newDirectTarget(deps.service, cfg.Seckill.TokenEnabled)
+	default:
+		log.Printf("未知的压测方式: %s", *mode)
+		return 1
+	}
+
+	log.Printf("开始压测: mode=%s, couponID=%d, users=%d, concurrency=%d", *mode, *couponID, *users, *concurrency)
+	stats := run(ctx, t, *couponID, *userStart, *users, *concurrency)
+	stats.print(os.Stdout)
+
+	if !*verify {
+		return 0
+	}
+	report, err := deps.verify(ctx, *couponID, *settle)
+	if err != nil {
+		log.Printf("校验库存失败: %v", err)
+		return 1
+	}
+	report.print(os.Stdout)
+	if !report.ok() {
+		return 1
+	}
+	return 0
+}
+
+// run 以 concurrency 个 goroutine 发起 users 次秒杀请求
+func run(ctx context.Context, t target, couponID, userStart int64, users, concurrency int) *stats {
+	s := newStats()
+	userIDs := make(chan int64)
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < max(concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for userID := range userIDs {
+				begin := time.Now()
+				result := t.seckill(ctx, couponID, userID)
+				s.record(result, time.Since(begin))
+			}
+		}()
+	}
+
+	for i := 0; i < users; i++ {
+		userIDs <- userStart + int64(i)
+	}
+	close(userIDs)
+	wg.Wait()
+	s.elapsed = time.Since(start)
+
+	return s
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// latencyBuckets 延迟直方图的桶上界
+var latencyBuckets = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// stats 压测统计
+type stats struct {
+	mu        sync.Mutex
+	counts    [resultError + 1]int
+	latencies []time.Duration
+	elapsed   time.Duration
+}
+
+func newStats() *stats {
+	return &stats{}
+}
+
+// record 记录一次请求的结果和延迟
+func (s *stats) record(r result, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[r]++
+	s.latencies = append(s.latencies, latency)
+}
+
+// print 输出结果计数、吞吐量、分位数和延迟直方图
+func (s *stats) print(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := len(s.latencies)
+	fmt.Fprintf(w, "\n请求数: %d, 耗时: %s, 吞吐量: %.0f req/s\n", total, s.elapsed.Round(time.Millisecond), float64(total)/s.elapsed.Seconds())
+	for r, name := range resultNames {
+		fmt.Fprintf(w, "  %-12s %d\n", name, s.counts[r])
+	}
+	if total == 0 {
+		return
+	}
+
+	sorted := slices.Clone(s.latencies)
+	slices.Sort(sorted)
+	percentile := func(p float64) time.Duration {
+		return sorted[min(int(float64(total)*p), total-1)].Round(time.Microsecond)
+	}
+	fmt.Fprintf(w, "\n延迟: p50=%s p90=%s p99=%s max=%s\n",
+		percentile(0.50), percentile(0.90), percentile(0.99), sorted[total-1].Round(time.Microsecond))
+
+	// 直方图：每个桶统计 (上一个上界, 上界] 内的请求数
+	fmt.Fprintln(w, "\n延迟分布:")
+	i := 0
+	for _, bound := range latencyBuckets {
+		n := 0
+		for i < total && sorted[i] <= bound {
+			n++
+			i++
+		}
+		printBucket(w, fmt.Sprintf("<= %s", bound), n, total)
+	}
+	printBucket(w, fmt.Sprintf(">  %s", latencyBuckets[len(latencyBuckets)-1]), total-i, total)
+}
+
+func printBucket(w io.Writer, label string, n, total int) {
+	const width = 40
+	bar := make([]byte, n*width/total)
+	for i := range bar {
+		bar[i] = '#'
+	}
+	fmt.Fprintf(w, "  %-10s %8d %6.2f%% %s\n", label, n, float64(n)*100/float64(total), bar)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"rag-agent/internal/domain/seckill"
+)
+
+// result 单次秒杀结果
+type result int
+
+const (
+	resultSuccess     result = iota // 抢购成功
+	resultSoldOut                   // 库存不足
+	resultRejected                  // 业务拒绝：重复购买、活动未开始/已结束、未放行、令牌无效等
+	resultRateLimited               // 被限流（429）
+	resultError                     // 系统错误或网络错误
+)
+
+var resultNames = []string{"success", "sold_out", "rejected", "rate_limited", "error"}
+
+func (r result) String() string {
+	return resultNames[r]
+}
+
+// target 压测目标
+type target interface {
+	seckill(ctx context.Context, couponID, userID int64) result
+}
+
+// directTarget 直接调用秒杀服务
+type directTarget struct {
+	service      *seckill.Service
+	tokenEnabled bool
+}
+
+func newDirectTarget(service *seckill.Service, tokenEnabled bool) *directTarget {
+	return &directTarget{service: service, tokenEnabled: tokenEnabled}
+}
+
+func (t *directTarget) seckill(ctx context.Context, couponID, userID int64) result {
+	req := &seckill.SeckillRequest{UserID: userID, CouponID: couponID}
+	if t.tokenEnabled {
+		token, err := t.service.IssueToken(ctx, couponID, userID)
+		if err != nil {
+			return classifyError(err)
+		}
+		req.Token = token.Token
+	}
+
+	_, err := t.service.Seckill(ctx, req)
+	return classifyError(err)
+}
+
+// classifyError 按秒杀业务错误分类
+func classifyError(err error) result {
+	switch {
+	case err == nil:
+		return resultSuccess
+	case errors.Is(err, seckill.ErrStockNotEnough):
+		return resultSoldOut
+	case errors.Is(err, seckill.ErrAlreadyBought),
+		errors.Is(err, seckill.ErrNotStarted),
+		errors.Is(err, seckill.ErrEnded),
+		errors.Is(err, seckill.ErrNotAdmitted),
+		errors.Is(err, seckill.ErrTokenInvalid),
+		errors.Is(err, seckill.ErrTokenExpired),
+		errors.Is(err, seckill.ErrTokenUsed):
+		return resultRejected
+	default:
+		return resultError
+	}
+}
+
+// httpTarget 通过 HTTP 调用秒杀接口
+type httpTarget struct {
+	client       *http.Client
+	baseURL      string
+	tokenEnabled bool
+}
+
+func newHTTPTarget(baseURL string, tokenEnabled bool) *httpTarget {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 1024
+	return &httpTarget{
+		client:       &http.Client{Transport: transport, Timeout: 10 * time.Second},
+		baseURL:      baseURL,
+		tokenEnabled: tokenEnabled,
+	}
+}
+
+func (t *httpTarget) seckill(ctx context.Context, couponID, userID int64) result {
+	req := seckill.SeckillRequest{UserID: userID, CouponID: couponID}
+	if t.tokenEnabled {
+		var token seckill.SeckillToken
+		url := fmt.Sprintf("%s/token/%d?user_id=%d", t.baseURL, couponID, userID)
+		status, err := t.do(ctx, http.MethodGet, url, nil, &token)
+		if err != nil {
+			return resultError
+		}
+		if status != http.StatusOK {
+			return classifyStatus(status, "")
+		}
+		req.Token = token.Token
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return resultError
+	}
+	var resp seckill.SeckillResponse
+	status, err := t.do(ctx, http.MethodPost, t.baseURL+"/", body, &resp)
+	if err != nil {
+		return resultError
+	}
+	return classifyStatus(status, resp.Message)
+}
+
+// do 发送请求并解析 JSON 响应，返回 HTTP 状态码
+func (t *httpTarget) do(ctx context.Context, method, url string, body []byte, out any) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// 错误响应的格式不固定，解析失败时只返回状态码
+	_ = json.NewDecoder(resp.Body).Decode(out)
+	return resp.StatusCode, nil
+}
+
+// classifyStatus 按 HTTP 状态码和响应消息分类
+// 库存不足与重复购买、未放行与限流的状态码相同，通过响应消息区分
+func classifyStatus(status int, message string) result {
+	switch {
+	case status == http.StatusOK:
+		return resultSuccess
+	case message == seckill.ErrStockNotEnough.Error():
+		return resultSoldOut
+	case message == seckill.ErrNotAdmitted.Error():
+		return resultRejected
+	case status == http.StatusTooManyRequests:
+		return resultRateLimited
+	case status >= 400 && status < 500:
+		return resultRejected
+	default:
+		return resultError
+	}
+}
@@ -12,7 +12,6 @@ import (
 
 	"rag-agent/config"
 	"rag-agent/internal/domain/aisearch"
-	"rag-agent/internal/domain/seckill"
 	httpserver "rag-agent/internal/server/http"
 	"rag-agent/internal/server/http/handler"
 	"rag-agent/pkg/llm"
@@ -51,16 +50,28 @@ func main() {
 	// AI搜索服务 - 三大主要功能之一（整合了LLM和RAG）
 	aisearchService := aisearch.NewService(graph, ragEngine, llmClient)
 
-	// 秒杀服务 - 三大主要功能之二
-	seckillService := seckill.NewService(nil, nil, nil, &cfg.Seckill) 
+	// 秒杀服务 - 三大主要功能之二（MySQL、Redis、RocketMQ）
+	seckillModule, err := newSeckillModule(ctx, cfg)
+	if err != nil {
+		log.Fatalf("初始化秒杀模块失败: %v", err)
+	}
+	if err := seckillModule.start(ctx); err != nil {
+		seckillModule.close(context.Background())
+		log.Fatalf("启动秒杀模块失败: %v", err)
+	}
 
 	// 初始化处理器
 	aisearchHandler := handler.NewAISearchHandler(aisearchService)
-	seckillHandler := handler.NewSeckillHandler(seckillService)
+	seckillHandler := handler.NewSeckillHandler(seckillModule.service)
+	seckillAdminHandler := handler.NewSeckillAdminHandler(seckillModule.service, seckillModule.reconciler)
 
-	// 设置路由
-	router := httpserver.NewRouter(seckillHandler, aisearchHandler)
+	// 设置路由（秒杀接口限流使用 Redis 令牌桶，Redis 不可用时降级为进程内令牌桶）
+	router := httpserver.NewRouter(seckillHandler, seckillAdminHandler, aisearchHandler, seckillModule.rateLimiter)
 	engine := router.Setup()
+	// 只信任配置的反向代理设置的 X-Forwarded-For，避免客户端伪造 IP 绕过按 IP 限流
+	if err := engine.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("设置受信任代理失败: %v", err)
+	}
 
 	// 启动HTTP服务器
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
@@ -91,12 +102,17 @@ func main() {
 
 	log.Println("正在关闭服务器...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("服务器强制关闭:", err)
+	// 先停止接收 HTTP 请求，再关闭秒杀模块（消费者 → 后台任务 → 生产者 → 连接池）
+	// 两者各自使用独立的超时，HTTP 关闭耗尽时间后仍能释放 workerID 等资源
+	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelHTTP()
+	if err := srv.Shutdown(httpCtx); err != nil {
+		log.Printf("服务器强制关闭: %v", err)
 	}
 
+	moduleCtx, cancelModule := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelModule()
+	seckillModule.shutdown(moduleCtx)
+
 	log.Println("服务器已关闭")
 }
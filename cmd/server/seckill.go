@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"rag-agent/config"
+	"rag-agent/internal/domain/seckill"
+	"rag-agent/internal/infrastructure/mq"
+	"rag-agent/internal/infrastructure/mysql"
+	redisinfra "rag-agent/internal/infrastructure/redis"
+	"rag-agent/internal/server/http/middleware"
+	"rag-agent/pkg/snowflake"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	seckillWorkerIDPrefix = "seckill:snowflake:worker:" // Snowflake workerID 租约 key 前缀
+	seckillWorkerIDTTL    = 30 * time.Second            // workerID 租约有效期
+	seckillLeaderName     = "seckill:leader"            // 后台调度 leader 选举锁名
+)
+
+// 消息队列实现
+const (
+	brokerRocketMQ = "rocketmq"
+	brokerMemory   = "memory"
+)
+
+// backgroundWorker 后台任务
+type backgroundWorker interface {
+	Start(ctx context.Context)
+	Stop()
+}
+
+// seckillModule 秒杀模块：外部依赖、服务和后台任务
+type seckillModule struct {
+	db         *sql.DB
+	redis      *redis.Client
+	lease      *snowflake.WorkerLease
+	producer   mq.Producer
+	txProducer mq.TransactionProducer // 事务消息生产者，未开启 mq.transactional 时为 nil
+	consumer   mq.Consumer
+	workers    []backgroundWorker // 按启动顺序排列，关闭时逆序停止
+
+	service     *seckill.Service
+	reconciler  *seckill.Reconciler
+	rateLimiter *middleware.RateLimiter
+
+	cancel    context.CancelFunc
+	watchDone chan struct{}
+}
+
+// newSeckillModule 按配置连接 MySQL、Redis、消息队列并组装秒杀服务
+// 任一依赖初始化失败时释放已创建的资源并返回带依赖名称的错误
+func newSeckillModule(ctx context.Context, cfg *config.Config) (_ *seckillModule, err error) {
+	// 出错时返回 nil，defer 中关闭局部变量 m 上已创建的资源
+	m := &seckillModule{}
+	defer func() {
+		if err != nil {
+			m.close(context.Background())
+		}
+	}()
+
+	if err := seckill.ValidateTokenConfig(&cfg.Seckill); err != nil {
+		return nil, err
+	}
+
+	m.db, err = mysql.NewClient(mysql.Config{
+		DSN:             cfg.MySQL.DSN,
+		MaxOpenConns:    cfg.MySQL.MaxOpenConns,
+		MaxIdleConns:    cfg.MySQL.MaxIdleConns,
+		ConnMaxLifetime: cfg.MySQL.ConnMaxLifetime,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("初始化 MySQL 失败: %w", err)
+	}
+
+	m.redis, err = redisinfra.NewClient(redisinfra.Config{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("初始化 Redis 失败: %w", err)
+	}
+
+	m.lease, err = snowflake.AcquireWorkerID(ctx, m.redis, seckillWorkerIDPrefix, seckillWorkerIDTTL)
+	if err != nil {
+		return nil, fmt.Errorf("租用 Snowflake workerID 失败: %w", err)
+	}
+	idGen := snowflake.NewLeasedGenerator(m.lease)
+
+	repo := seckill.NewMySQLRepository(m.db)
+	cache := seckill.NewRedisCacheRepository(m.redis)
+	redisLocker := redisinfra.NewLocker(m.redis, cfg.Seckill.LockPrefix, cfg.Seckill.LockExpire)
+	locker := seckill.NewRedisLocker(redisLocker, 0)
+
+	nameServers := strings.Split(cfg.RocketMQ.NameServer, ";")
+	newConsumer, err := m.newBroker(cfg, nameServers, seckill.NewOrderTransactionChecker(cache))
+	if err != nil {
+		return nil, err
+	}
+
+	orderProducer := seckill.NewOrderMQProducer(m.producer, cfg.RocketMQ.Topic)
+	if m.txProducer != nil {
+		orderProducer = seckill.NewTransactionalOrderMQProducer(m.producer, m.txProducer, cfg.RocketMQ.Topic)
+	}
+
+	m.service = seckill.NewService(repo, cache, orderProducer, idGen, locker, &cfg.Seckill)
+	m.reconciler = seckill.NewReconciler(repo, cache, locker)
+	m.rateLimiter = middleware.NewRateLimiter(m.redis, cfg.RateLimit)
+
+	orderConsumer := seckill.NewOrderConsumer(repo, cache, &cfg.Seckill)
+	m.consumer, err = newConsumer(mq.ConsumerConfig{
+		NameServerAddr:    nameServers,
+		GroupName:         cfg.RocketMQ.GroupName,
+		Topic:             cfg.RocketMQ.Topic,
+		Tag:               seckill.OrderMessageTag,
+		MaxReconsumeTimes: cfg.MQ.MaxReconsumeTimes,
+	}, orderConsumer.HandleMessage)
+	if err != nil {
+		return nil, fmt.Errorf("初始化消息队列消费者失败: %w", err)
+	}
+
+	// 选举最先启动、最后停止，保证调度类任务停止前 leader 身份有效
+	election := redisinfra.NewElection(redisLocker, seckillLeaderName, max(cfg.Seckill.LockExpire/3, time.Second))
+	m.workers = []backgroundWorker{
+		election,
+		seckill.NewCouponScheduler(repo, cache, locker, election, &cfg.Seckill),
+		seckill.NewQueueAdmitter(cache, election, &cfg.Seckill),
+		seckill.NewCompensationWorker(repo, cache, orderProducer, locker, &cfg.Seckill),
+		seckill.NewOrderTimeoutWorker(repo, cache, locker),
+		m.reconciler,
+	}
+
+	return m, nil
+}
+
+// newBroker 按 mq.broker 配置创建消息队列生产者，返回创建消费者的函数
+// 开启 mq.transactional 时同时创建事务消息生产者，checker 用于回查状态未知的事务消息
+// memory 实现在进程内投递消息，不需要 NameServer，消息不持久化，只用于本地运行
+func (m *seckillModule) newBroker(cfg *config.Config, nameServers []string, checker mq.TransactionChecker) (func(mq.ConsumerConfig, mq.Handler) (mq.Consumer, error), error) {
+	switch cfg.MQ.Broker {
+	case "", brokerRocketMQ:
+		producer, err := mq.NewRocketMQProducer(mq.ProducerConfig{
+			NameServerAddr: nameServers,
+			GroupName:      cfg.RocketMQ.GroupName,
+			RetryTimes:     cfg.Seckill.MaxRetry,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("初始化 RocketMQ 生产者失败: %w", err)
+		}
+		m.producer = producer
+
+		if cfg.MQ.Transactional {
+			txProducer, err := mq.NewRocketMQTransactionProducer(mq.ProducerConfig{
+				NameServerAddr: nameServers,
+				GroupName:      cfg.RocketMQ.GroupName + "_tx",
+				RetryTimes:     cfg.Seckill.MaxRetry,
+			}, checker)
+			if err != nil {
+				return nil, fmt.Errorf("初始化 RocketMQ 事务消息生产者失败: %w", err)
+			}
+			m.txProducer = txProducer
+		}
+		return func(c mq.ConsumerConfig, h mq.Handler) (mq.Consumer, error) {
+			return mq.NewRocketMQConsumer(c, h)
+		}, nil
+	case brokerMemory:
+		log.Printf("使用进程内消息队列，消息不持久化，仅用于本地运行")
+		broker := mq.NewMemoryBroker(mq.MemoryConfig{
+			MaxReconsumeTimes: cfg.MQ.MaxReconsumeTimes,
+			RetryDelay:        cfg.MQ.RetryDelay,
+			CheckTransaction:  checker,
+		})
+		m.producer = broker
+		if cfg.MQ.Transactional {
+			m.txProducer = broker
+		}
+		return broker.NewConsumer, nil
+	default:
+		return nil, fmt.Errorf("不支持的消息队列实现: %s", cfg.MQ.Broker)
+	}
+}
+
+// start 启动订单消费者、后台任务和库存归还通知订阅
+func (m *seckillModule) start(ctx context.Context) error {
+	if err := m.consumer.Start(); err != nil {
+		return fmt.Errorf("启动消息队列消费者失败: %w", err)
+	}
+
+	ctx, m.cancel = context.WithCancel(ctx)
+	for _, w := range m.workers {
+		w.Start(ctx)
+	}
+
+	m.watchDone = make(chan struct{})
+	go func() {
+		defer close(m.watchDone)
+		if err := m.service.WatchStockRestored(ctx); err != nil {
+			log.Printf("订阅库存归还通知失败: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// shutdown 按顺序关闭：先停止消费者（等待在途消息处理完），再逆序停止后台任务，最后关闭生产者和连接池
+// 调用前应先关闭 HTTP 服务，避免新的秒杀请求继续发送消息
+func (m *seckillModule) shutdown(ctx context.Context) {
+	if err := m.consumer.Shutdown(); err != nil {
+		log.Printf("关闭消息队列消费者失败: %v", err)
+	}
+
+	for i := len(m.workers) - 1; i >= 0; i-- {
+		m.workers[i].Stop()
+	}
+	if m.cancel != nil {
+		m.cancel()
+		<-m.watchDone
+	}
+
+	m.close(ctx)
+}
+
+// close 关闭生产者、释放 workerID 并关闭连接池（只关闭已创建的资源）
+func (m *seckillModule) close(ctx context.Context) {
+	if m.txProducer != nil {
+		if err := m.txProducer.Shutdown(); err != nil {
+			log.Printf("关闭事务消息生产者失败: %v", err)
+		}
+	}
+	if m.producer != nil {
+		if err := m.producer.Shutdown(); err != nil {
+			log.Printf("关闭消息队列生产者失败: %v", err)
+		}
+	}
+	if m.lease != nil {
+		if err := m.lease.Close(ctx); err != nil {
+			log.Printf("释放 Snowflake workerID 失败: %v", err)
+		}
+	}
+	if m.redis != nil {
+		if err := m.redis.Close(); err != nil {
+			log.Printf("关闭 Redis 连接失败: %v", err)
+		}
+	}
+	if m.db != nil {
+		if err := m.db.Close(); err != nil {
+			log.Printf("关闭 MySQL 连接失败: %v", err)
+		}
+	}
+}
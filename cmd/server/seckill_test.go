@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"rag-agent/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试令牌密钥配置无效时返回校验错误，不会在释放资源时 panic
+func TestNewSeckillModule_InvalidTokenConfig(t *testing.T) {
+	cfg := &config.Config{Seckill: config.SeckillConfig{TokenEnabled: true}}
+
+	m, err := newSeckillModule(context.Background(), cfg)
+	assert.Nil(t, m)
+	assert.ErrorContains(t, err, "token_secret")
+}
@@ -15,10 +15,12 @@ type Config struct {
 	MySQL       MySQLConfig       `yaml:"mysql"`
 	Elasticsearch ElasticsearchConfig `yaml:"elasticsearch"`
 	RocketMQ    RocketMQConfig    `yaml:"rocketmq"`
+	MQ          MQConfig          `yaml:"mq"`
 	LLM         LLMConfig         `yaml:"llm"`
 	RAG         RAGConfig         `yaml:"rag"`
 	Embedding   EmbeddingConfig   `yaml:"embedding"`
 	Seckill     SeckillConfig     `yaml:"seckill"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
 }
 
 // RedisConfig Redis相关配置
@@ -55,10 +57,11 @@ type EmbeddingConfig struct {
 
 // ServerConfig 服务器相关配置
 type ServerConfig struct {
-	Host         string        `yaml:"host"`
-	Port         int           `yaml:"port"`
-	ReadTimeout  time.Duration `yaml:"read_timeout"`
-	WriteTimeout time.Duration `yaml:"write_timeout"`
+	Host           string        `yaml:"host"`
+	Port           int           `yaml:"port"`
+	ReadTimeout    time.Duration `yaml:"read_timeout"`
+	WriteTimeout   time.Duration `yaml:"write_timeout"`
+	TrustedProxies []string      `yaml:"trusted_proxies"` // 受信任的反向代理 IP/CIDR，为空时不采信 X-Forwarded-For
 }
 
 // MySQLConfig MySQL数据库配置
@@ -85,13 +88,46 @@ type RocketMQConfig struct {
 	InstanceName string `yaml:"instance_name"`
 }
 
+// MQConfig 消息队列配置
+type MQConfig struct {
+	Broker            string        `yaml:"broker"`              // 消息队列实现: rocketmq（默认）、memory（进程内，用于本地运行和测试）
+	MaxReconsumeTimes int32         `yaml:"max_reconsume_times"` // 最大重新投递次数，超过后进入死信
+	RetryDelay        time.Duration `yaml:"retry_delay"`         // memory 实现的重新投递间隔
+	Transactional     bool          `yaml:"transactional"`       // 秒杀订单消息使用事务消息，库存扣减与消息提交保持一致
+}
+
 // SeckillConfig 秒杀系统配置
 type SeckillConfig struct {
 	CachePrefix    string        `yaml:"cache_prefix"`
 	LockPrefix     string        `yaml:"lock_prefix"`
 	LockExpire     time.Duration `yaml:"lock_expire"`
 	MaxRetry       int           `yaml:"max_retry"`
+	MaxReconsume   int           `yaml:"max_reconsume"` // 订单消息最大重新消费次数，超过后转入死信表
 	OrderTimeout   time.Duration `yaml:"order_timeout"`
+	WarmupLead     time.Duration `yaml:"warmup_lead"`   // 活动开始前提前预热 Redis 库存的时间
+	KeyRetention   time.Duration `yaml:"key_retention"` // 活动结束后 Redis 库存相关 key 的保留时间
+	QueueEnabled   bool          `yaml:"queue_enabled"`    // 开启排队模式：用户先排队，被放行后才能秒杀
+	QueueAdmitRate int           `yaml:"queue_admit_rate"` // 每个优惠券每秒放行的排队人数
+	QueueAdmitTTL  time.Duration `yaml:"queue_admit_ttl"`  // 放行后的有效期，过期需重新排队
+	TokenEnabled   bool          `yaml:"token_enabled"`    // 开启秒杀令牌校验：秒杀前需先获取一次性令牌
+	TokenSecret    string        `yaml:"token_secret"`     // 秒杀令牌 HMAC 签名密钥
+	TokenTTL       time.Duration `yaml:"token_ttl"`        // 秒杀令牌有效期
+}
+
+// RateLimitConfig 限流配置
+type RateLimitConfig struct {
+	Enabled bool            `yaml:"enabled"`
+	Prefix  string          `yaml:"prefix"` // Redis key 前缀
+	Rules   []RateLimitRule `yaml:"rules"`
+}
+
+// RateLimitRule 限流规则（令牌桶：每 Window 补充 Limit 个令牌，桶容量为 Burst）
+// Limit 不大于 0 或 Window 小于 1ms 的规则不生效
+type RateLimitRule struct {
+	Key    string        `yaml:"key"` // 限流维度: user-用户ID, ip-客户端IP, route-路由
+	Limit  int           `yaml:"limit"`
+	Window time.Duration `yaml:"window"`
+	Burst  int           `yaml:"burst"` // 为 0 时等于 Limit
 }
 
 var (
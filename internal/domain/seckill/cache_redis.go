@@ -2,35 +2,375 @@ package seckill
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log"
+	"math/rand/v2"
 	"strconv"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// DecrStock Lua 脚本返回码
+const (
+	stockNotEnough   = -1 // 库存不足
+	alreadyPurchased = -2 // 用户已购买
+	activityNotStart = -3 // 活动未开始
+	activityEnded    = -4 // 活动已结束
+	stockNotCached   = -5 // 库存未缓存（AdjustStock）
+)
+
+// Lua 脚本通过 redis.Script 注册，执行时使用 EVALSHA，服务端未缓存脚本（NOSCRIPT）时自动回退为 EVAL
+//
+// 库存支持分桶模式：<库存key>:buckets 保存分桶数 N（不存在或 <= 1 时为单 key 模式），
+// 库存拆分到 <库存key>:0 ~ <库存key>:N-1，分散单个热点 key 的压力。
+// 分桶 key 由脚本根据分桶数动态拼接，因此库存相关 key 需要位于同一个 Redis 实例
+
+// stockLuaLib 库存读写公共函数，拼接在各库存脚本前
+const stockLuaLib = `
+	local function bucket_count(stock_key)
+		local n = tonumber(redis.call('GET', stock_key .. ':buckets'))
+		if n and n > 1 then
+			return n
+		end
+		return 1
+	end
+
+	local function bucket_key(stock_key, n, i)
+		if n == 1 then
+			return stock_key
+		end
+		return stock_key .. ':' .. (i % n)
+	end
+
+	-- 总库存，未缓存时返回 nil
+	local function total_stock(stock_key, n)
+		local total = nil
+		for i = 0, n - 1 do
+			local v = redis.call('GET', bucket_key(stock_key, n, i))
+			if v then
+				total = (total or 0) + tonumber(v)
+			end
+		end
+		return total
+	end
+
+	-- 将库存平均分配到各个桶
+	local function distribute(stock_key, n, total)
+		for i = 0, n - 1 do
+			local share = math.floor(total / n)
+			if i < total % n then
+				share = share + 1
+			end
+			redis.call('SET', bucket_key(stock_key, n, i), share)
+		end
+	end
+
+	-- 从 start 号桶开始依次扣减 quantity 个库存，调用前需确认总库存充足
+	local function take_stock(stock_key, n, start, quantity)
+		local need = quantity
+		for j = 0, n - 1 do
+			local key = bucket_key(stock_key, n, start + j)
+			local v = tonumber(redis.call('GET', key) or '0')
+			if v > 0 then
+				local d = math.min(v, need)
+				redis.call('DECRBY', key, d)
+				need = need - d
+				if need == 0 then
+					return
+				end
+			end
+		end
+	end
+`
+
+// decrStockLua 检查活动状态和时间窗口、检查用户是否已购买、检查库存并原子性扣减
+// KEYS: 库存, 已购用户集合, 活动信息, [订单扣减记录]；ARGV: 用户ID, 当前时间（毫秒）, 扣减数量, 起始桶（随机数）, [扣减记录有效期（毫秒）]
+// 活动信息未缓存时不做时间校验；状态为未开始或当前时间早于开始时间返回 -3，
+// 状态为已结束或当前时间晚于结束时间返回 -4
+// 如果用户已在已购集合中，返回 -2
+// 库存不少于扣减数量时扣减、记录用户并返回剩余库存（分桶模式下为所扣减桶的剩余库存），否则返回 -1
+// 分桶模式先尝试随机选中的桶，不足时依次尝试其他桶，单个桶都不足时跨桶扣减
+// 传入订单扣减记录 key 时，扣减成功后在同一脚本中写入该记录（事务消息回查依据）
+const decrStockLua = stockLuaLib + `
+	local function mark_bought()
+		redis.call('SADD', KEYS[2], ARGV[1])
+		if KEYS[4] then
+			redis.call('SET', KEYS[4], ARGV[1], 'PX', ARGV[5])
+		end
+	end
+
+	local activity = redis.call('HMGET', KEYS[3], 'start_time', 'end_time', 'status')
+	if activity[1] then
+		local now = tonumber(ARGV[2])
+		local status = tonumber(activity[3])
+		if status == 2 or now > tonumber(activity[2]) then
+			return -4
+		end
+		if status ~= 1 or now < tonumber(activity[1]) then
+			return -3
+		end
+	end
+	if redis.call('SISMEMBER', KEYS[2], ARGV[1]) == 1 then
+		return -2
+	end
+
+	local quantity = tonumber(ARGV[3])
+	local start = tonumber(ARGV[4])
+	local n = bucket_count(KEYS[1])
+	for j = 0, n - 1 do
+		local key = bucket_key(KEYS[1], n, start + j)
+		local stock = tonumber(redis.call('GET', key) or '-1')
+		if stock >= quantity then
+			redis.call('DECRBY', key, quantity)
+			mark_bought()
+			return stock - quantity
+		end
+	end
+
+	local total = total_stock(KEYS[1], n)
+	if n == 1 or not total or total < quantity then
+		return -1
+	end
+	take_stock(KEYS[1], n, start, quantity)
+	mark_bought()
+	return total - quantity
+`
+
+var decrStockScript = redis.NewScript(decrStockLua)
+
+// 获取总库存，未缓存时返回 nil
+var getStockScript = redis.NewScript(stockLuaLib + `
+	return total_stock(KEYS[1], bucket_count(KEYS[1]))
+`)
+
+// 设置总库存，分桶模式下平均分配到各个桶；ARGV[2] 为 1 时仅在未缓存时设置，返回是否设置
+var setStockScript = redis.NewScript(stockLuaLib + `
+	local n = bucket_count(KEYS[1])
+	if ARGV[2] == '1' and total_stock(KEYS[1], n) then
+		return 0
+	end
+	distribute(KEYS[1], n, tonumber(ARGV[1]))
+	return 1
+`)
+
+// 切换分桶数：读取当前总库存，删除旧的库存 key，按新的分桶数重新分配；分桶数不变时不做操作
+var setStockBucketsScript = redis.NewScript(stockLuaLib + `
+	local old = bucket_count(KEYS[1])
+	local n = math.max(tonumber(ARGV[1]), 1)
+	if old == n then
+		return 0
+	end
+
+	local total = total_stock(KEYS[1], old)
+	for i = 0, old - 1 do
+		redis.call('DEL', bucket_key(KEYS[1], old, i))
+	end
+	if n > 1 then
+		redis.call('SET', KEYS[1] .. ':buckets', n)
+	else
+		redis.call('DEL', KEYS[1] .. ':buckets')
+	end
+	if total then
+		distribute(KEYS[1], n, total)
+	end
+	return 1
+`)
+
+// 增加库存（delta 可为负），分桶模式下加到 ARGV[2] 指定的桶，返回是否增加
+// 库存未缓存（未预热或活动结束后已过期）时不处理，避免重新创建没有过期时间的库存 key
+var incrStockScript = redis.NewScript(stockLuaLib + `
+	local key = bucket_key(KEYS[1], bucket_count(KEYS[1]), tonumber(ARGV[2]))
+	if redis.call('EXISTS', key) == 0 then
+		return 0
+	end
+	redis.call('INCRBY', key, ARGV[1])
+	return 1
+`)
+
+// 回滚用户的扣减：只有用户确实在已购集合中时才归还库存，返回是否归还
+// 库存 key 已过期时只移出已购用户，不重新创建库存 key
+var revertStockScript = redis.NewScript(stockLuaLib + `
+	if redis.call('SREM', KEYS[2], ARGV[1]) == 1 then
+		local key = bucket_key(KEYS[1], bucket_count(KEYS[1]), tonumber(ARGV[3]))
+		if redis.call('EXISTS', key) == 0 then
+			return 0
+		end
+		redis.call('INCRBY', key, ARGV[2])
+		return 1
+	end
+	return 0
+`)
+
+// 调整已缓存的库存，库存未缓存返回 -5，调整后为负返回 -1，否则返回调整后的总库存
+var adjustStockScript = redis.NewScript(stockLuaLib + `
+	local n = bucket_count(KEYS[1])
+	local total = total_stock(KEYS[1], n)
+	if not total then
+		return -5
+	end
+	local delta = tonumber(ARGV[1])
+	local start = tonumber(ARGV[2])
+	if total + delta < 0 then
+		return -1
+	end
+	if delta >= 0 then
+		redis.call('INCRBY', bucket_key(KEYS[1], n, start), delta)
+	else
+		take_stock(KEYS[1], n, start, -delta)
+	end
+	return total + delta
+`)
+
+// 为库存、分桶数、已购用户、活动信息和排队相关 key 设置过期时间
+// KEYS[1]: 库存 key, KEYS[2..]: 其余 key
+var expireStockScript = redis.NewScript(stockLuaLib + `
+	local n = bucket_count(KEYS[1])
+	for i = 0, n - 1 do
+		redis.call('PEXPIRE', bucket_key(KEYS[1], n, i), ARGV[1])
+	end
+	redis.call('PEXPIRE', KEYS[1] .. ':buckets', ARGV[1])
+	for i = 2, #KEYS do
+		redis.call('PEXPIRE', KEYS[i], ARGV[1])
+	end
+	return 0
+`)
+
+// 认领到期成员：将 score 推迟到 ARGV[3]（租约到期时间），租约内其他实例不会再取到
+// 处理完成后由调用方删除，处理失败或进程崩溃时租约到期后重新被认领
+var claimExpiredScript = redis.NewScript(`
+	local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+	for _, id in ipairs(ids) do
+		redis.call('ZADD', KEYS[1], 'XX', ARGV[3], id)
+	end
+	return ids
+`)
+
+// 加入排队：已在队列中时返回原排队号，否则分配递增的排队号并按排队号排序
+// KEYS: 队列, 排队号计数器, 有排队的优惠券集合；ARGV: 用户ID, 优惠券ID
+var joinQueueScript = redis.NewScript(`
+	local ticket = redis.call('ZSCORE', KEYS[1], ARGV[1])
+	if ticket then
+		return tonumber(ticket)
+	end
+	ticket = redis.call('INCR', KEYS[2])
+	redis.call('ZADD', KEYS[1], ticket, ARGV[1])
+	redis.call('SADD', KEYS[3], ARGV[2])
+	return ticket
+`)
+
+// 查询排队状态：已放行返回 {0, 放行截止时间}，排队中返回 {排名（从 1 开始）, 0}，不在队列中返回 {-1, 0}
+// KEYS: 队列, 已放行集合；ARGV: 用户ID, 当前时间（毫秒）
+var queuePositionScript = redis.NewScript(`
+	local until_ms = tonumber(redis.call('ZSCORE', KEYS[2], ARGV[1]))
+	if until_ms and until_ms > tonumber(ARGV[2]) then
+		return {0, until_ms}
+	end
+	local rank = redis.call('ZRANK', KEYS[1], ARGV[1])
+	if rank then
+		return {rank + 1, 0}
+	end
+	return {-1, 0}
+`)
+
+// 按排队顺序放行一批用户，放行有效期截止到 ARGV[2]；队列为空时从有排队的优惠券集合中移除
+// KEYS: 队列, 已放行集合, 有排队的优惠券集合；ARGV: 放行人数, 放行截止时间（毫秒）, 当前时间（毫秒）, 优惠券ID
+var admitQueueScript = redis.NewScript(`
+	redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', ARGV[3])
+	local popped = redis.call('ZPOPMIN', KEYS[1], ARGV[1])
+	local ids = {}
+	for i = 1, #popped, 2 do
+		redis.call('ZADD', KEYS[2], ARGV[2], popped[i])
+		table.insert(ids, popped[i])
+	end
+	if redis.call('ZCARD', KEYS[1]) == 0 then
+		redis.call('SREM', KEYS[3], ARGV[4])
+	end
+	return ids
+`)
+
 // RedisCacheRepository Redis 缓存仓库实现（秒杀专用）
 type RedisCacheRepository struct {
-	client *redis.Client
-	prefix string
+	client         *redis.Client
+	prefix         string
+	userPrefix     string
+	activityPrefix string
+	orderPrefix    string
+	timeoutKey     string
+	restoredTopic  string
+	queuePrefix    string
+	queuedCoupons  string
+	tokenPrefix    string
+	deductPrefix   string
 }
 
 // NewRedisCacheRepository 创建 Redis 缓存仓库
 func NewRedisCacheRepository(client *redis.Client) CacheRepository {
 	return &RedisCacheRepository{
-		client: client,
-		prefix: "seckill:stock:",
+		client:         client,
+		prefix:         "seckill:stock:",
+		userPrefix:     "seckill:users:",
+		activityPrefix: "seckill:activity:",
+		orderPrefix:    "seckill:processing:",
+		timeoutKey:     "seckill:order:timeout",
+		restoredTopic:  "seckill:stock:restored",
+		queuePrefix:    "seckill:queue:",
+		queuedCoupons:  "seckill:queue:coupons",
+		tokenPrefix:    "seckill:token:",
+		deductPrefix:   "seckill:deduct:",
 	}
 }
 
+// getQueueKey 获取排队队列的 Redis key
+func (r *RedisCacheRepository) getQueueKey(couponID int64) string {
+	return fmt.Sprintf("%s%d", r.queuePrefix, couponID)
+}
+
+// getQueueSeqKey 获取排队号计数器的 Redis key
+func (r *RedisCacheRepository) getQueueSeqKey(couponID int64) string {
+	return fmt.Sprintf("%s%d:seq", r.queuePrefix, couponID)
+}
+
+// getAdmittedKey 获取已放行用户集合的 Redis key
+func (r *RedisCacheRepository) getAdmittedKey(couponID int64) string {
+	return fmt.Sprintf("%s%d:admitted", r.queuePrefix, couponID)
+}
+
 // getStockKey 获取库存的 Redis key
 func (r *RedisCacheRepository) getStockKey(couponID int64) string {
 	return fmt.Sprintf("%s%d", r.prefix, couponID)
 }
 
-// GetStock 获取缓存中的库存
+// getUserSetKey 获取已购用户集合的 Redis key
+func (r *RedisCacheRepository) getUserSetKey(couponID int64) string {
+	return fmt.Sprintf("%s%d", r.userPrefix, couponID)
+}
+
+// getActivityKey 获取活动信息的 Redis key
+func (r *RedisCacheRepository) getActivityKey(couponID int64) string {
+	return fmt.Sprintf("%s%d", r.activityPrefix, couponID)
+}
+
+// getDeductionKey 获取订单扣减记录的 Redis key
+func (r *RedisCacheRepository) getDeductionKey(orderID int64) string {
+	return fmt.Sprintf("%s%d", r.deductPrefix, orderID)
+}
+
+// getProcessingOrderKey 获取订单处理中标记的 Redis key
+func (r *RedisCacheRepository) getProcessingOrderKey(orderID int64) string {
+	return fmt.Sprintf("%s%d", r.orderPrefix, orderID)
+}
+
+// getUserProcessingKey 获取用户处理中订单ID集合的 Redis key
+func (r *RedisCacheRepository) getUserProcessingKey(userID int64) string {
+	return fmt.Sprintf("%suser:%d", r.orderPrefix, userID)
+}
+
+// GetStock 获取缓存中的库存（分桶模式下为各桶之和）
 func (r *RedisCacheRepository) GetStock(ctx context.Context, couponID int64) (int64, error) {
 	key := r.getStockKey(couponID)
-	val, err := r.client.Get(ctx, key).Result()
+	stock, err := getStockScript.Run(ctx, r.client, []string{key}).Int64()
 	if err == redis.Nil {
 		return 0, fmt.Errorf("库存不存在")
 	}
@@ -38,65 +378,485 @@ func (r *RedisCacheRepository) GetStock(ctx context.Context, couponID int64) (in
 		return 0, fmt.Errorf("获取库存失败: %w", err)
 	}
 
-	stock, err := strconv.ParseInt(val, 10, 64)
+	return stock, nil
+}
+
+// DecrStock 原子性校验活动时间、一人一单并扣减 1 个库存
+func (r *RedisCacheRepository) DecrStock(ctx context.Context, couponID, userID int64) (int64, error) {
+	return r.DecrStockN(ctx, couponID, userID, 1)
+}
+
+// DecrStockN 原子性校验活动时间、一人一单并一次扣减 quantity 个库存
+// 返回扣减后的库存，或 -1 库存不足、-2 已购买、-3 活动未开始、-4 活动已结束
+func (r *RedisCacheRepository) DecrStockN(ctx context.Context, couponID, userID, quantity int64) (int64, error) {
+	if quantity <= 0 {
+		return 0, fmt.Errorf("扣减数量必须大于0: %d", quantity)
+	}
+
+	keys := []string{r.getStockKey(couponID), r.getUserSetKey(couponID), r.getActivityKey(couponID)}
+	stock, err := decrStockScript.Run(ctx, r.client, keys, userID, time.Now().UnixMilli(), quantity, rand.Uint32()).Int64()
 	if err != nil {
-		return 0, fmt.Errorf("解析库存失败: %w", err)
+		return 0, fmt.Errorf("执行 Lua 脚本失败: %w", err)
 	}
 
 	return stock, nil
 }
 
-// DecrStock 使用 Lua 脚本原子性扣减库存
-// 返回扣减后的库存，如果库存不足返回 -1
-func (r *RedisCacheRepository) DecrStock(ctx context.Context, couponID int64) (int64, error) {
-	key := r.getStockKey(couponID)
+// DecrStockForOrder 原子性校验并扣减 1 个库存，扣减成功时写入订单扣减记录（保留 orderDeductionTTL）
+func (r *RedisCacheRepository) DecrStockForOrder(ctx context.Context, couponID, userID, orderID int64) (int64, error) {
+	keys := []string{r.getStockKey(couponID), r.getUserSetKey(couponID), r.getActivityKey(couponID), r.getDeductionKey(orderID)}
+	stock, err := decrStockScript.Run(ctx, r.client, keys,
+		userID, time.Now().UnixMilli(), 1, rand.Uint32(), orderDeductionTTL.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("执行 Lua 脚本失败: %w", err)
+	}
 
-	// Lua 脚本：检查库存并原子性扣减
-	// 如果库存 > 0，则扣减并返回扣减后的库存
-	// 如果库存 <= 0，返回 -1 表示库存不足
-	luaScript := `
-		local stock = redis.call('GET', KEYS[1])
-		if not stock then
-			return -1
-		end
-		stock = tonumber(stock)
-		if stock <= 0 then
-			return -1
-		end
-		redis.call('DECR', KEYS[1])
-		return stock - 1
-	`
+	return stock, nil
+}
 
-	result, err := r.client.Eval(ctx, luaScript, []string{key}).Result()
+// HasOrderDeduction 订单扣减记录是否存在
+func (r *RedisCacheRepository) HasOrderDeduction(ctx context.Context, orderID int64) (bool, error) {
+	n, err := r.client.Exists(ctx, r.getDeductionKey(orderID)).Result()
 	if err != nil {
-		return 0, fmt.Errorf("执行 Lua 脚本失败: %w", err)
+		return false, fmt.Errorf("查询订单扣减记录失败: %w", err)
 	}
+	return n > 0, nil
+}
 
-	stock, ok := result.(int64)
-	if !ok {
-		return 0, fmt.Errorf("Lua 脚本返回类型错误")
+// GetStocks 使用 pipeline 批量获取多个优惠券的库存，未缓存的优惠券不出现在结果中
+func (r *RedisCacheRepository) GetStocks(ctx context.Context, couponIDs []int64) (map[int64]int64, error) {
+	cmds, err := r.getStocksPipelined(ctx, couponIDs)
+	if err != nil && redis.HasErrorPrefix(err, "NOSCRIPT") {
+		// pipeline 中无法自动回退为 EVAL，加载脚本后重试一次
+		if err := getStockScript.Load(ctx, r.client).Err(); err != nil {
+			return nil, fmt.Errorf("加载 Lua 脚本失败: %w", err)
+		}
+		cmds, err = r.getStocksPipelined(ctx, couponIDs)
+	}
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("批量获取库存失败: %w", err)
 	}
 
-	return stock, nil
+	stocks := make(map[int64]int64, len(couponIDs))
+	for i, cmd := range cmds {
+		stock, err := cmd.Int64()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析库存失败: %w", err)
+		}
+		stocks[couponIDs[i]] = stock
+	}
+	return stocks, nil
+}
+
+// getStocksPipelined 在一个 pipeline 中对每个优惠券执行 EVALSHA 获取库存
+func (r *RedisCacheRepository) getStocksPipelined(ctx context.Context, couponIDs []int64) ([]*redis.Cmd, error) {
+	cmds := make([]*redis.Cmd, len(couponIDs))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, couponID := range couponIDs {
+			cmds[i] = getStockScript.EvalSha(ctx, pipe, []string{r.getStockKey(couponID)})
+		}
+		return nil
+	})
+	return cmds, err
 }
 
-// SetStock 设置缓存中的库存
+// SetStock 设置缓存中的库存（分桶模式下平均分配到各个桶）
 func (r *RedisCacheRepository) SetStock(ctx context.Context, couponID int64, stock int64) error {
 	key := r.getStockKey(couponID)
-	err := r.client.Set(ctx, key, stock, 0).Err()
+	err := setStockScript.Run(ctx, r.client, []string{key}, stock, 0).Err()
 	if err != nil {
 		return fmt.Errorf("设置库存失败: %w", err)
 	}
+	r.publishStockRestored(ctx, couponID)
 	return nil
 }
 
-// IncrStock 原子性增加库存（使用 Redis INCRBY 命令）
+// SetStockIfAbsent 库存未缓存时设置库存，已缓存时不覆盖
+func (r *RedisCacheRepository) SetStockIfAbsent(ctx context.Context, couponID int64, stock int64) (bool, error) {
+	key := r.getStockKey(couponID)
+	set, err := setStockScript.Run(ctx, r.client, []string{key}, stock, 1).Int64()
+	if err != nil {
+		return false, fmt.Errorf("设置库存失败: %w", err)
+	}
+	if set == 1 {
+		r.publishStockRestored(ctx, couponID)
+	}
+	return set == 1, nil
+}
+
+// SetStockBuckets 设置库存分桶数，已缓存的库存按新的分桶数重新分配
+func (r *RedisCacheRepository) SetStockBuckets(ctx context.Context, couponID int64, buckets int) error {
+	key := r.getStockKey(couponID)
+	if err := setStockBucketsScript.Run(ctx, r.client, []string{key}, buckets).Err(); err != nil {
+		return fmt.Errorf("设置库存分桶失败: %w", err)
+	}
+	return nil
+}
+
+// ExpireCouponKeys 为优惠券的库存、已购用户和活动信息 key 设置过期时间
+func (r *RedisCacheRepository) ExpireCouponKeys(ctx context.Context, couponID int64, ttl time.Duration) error {
+	keys := []string{
+		r.getStockKey(couponID), r.getUserSetKey(couponID), r.getActivityKey(couponID),
+		r.getQueueKey(couponID), r.getQueueSeqKey(couponID), r.getAdmittedKey(couponID),
+	}
+	if err := expireStockScript.Run(ctx, r.client, keys, ttl.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("设置优惠券缓存过期时间失败: %w", err)
+	}
+	return nil
+}
+
+// SetActivity 设置缓存中的活动时间窗口（毫秒时间戳）和状态
+func (r *RedisCacheRepository) SetActivity(ctx context.Context, couponID int64, startTime, endTime time.Time, status int) error {
+	key := r.getActivityKey(couponID)
+	err := r.client.HSet(ctx, key,
+		"start_time", startTime.UnixMilli(),
+		"end_time", endTime.UnixMilli(),
+		"status", status,
+	).Err()
+	if err != nil {
+		return fmt.Errorf("设置活动信息失败: %w", err)
+	}
+	return nil
+}
+
+// GetActivity 获取缓存中的活动时间窗口和状态，未缓存时返回 ErrCouponNotFound
+func (r *RedisCacheRepository) GetActivity(ctx context.Context, couponID int64) (time.Time, time.Time, int, error) {
+	values, err := r.client.HMGet(ctx, r.getActivityKey(couponID), "start_time", "end_time", "status").Result()
+	if err != nil {
+		return time.Time{}, time.Time{}, 0, fmt.Errorf("获取活动信息失败: %w", err)
+	}
+
+	var fields [3]int64
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return time.Time{}, time.Time{}, 0, ErrCouponNotFound
+		}
+		if fields[i], err = strconv.ParseInt(s, 10, 64); err != nil {
+			return time.Time{}, time.Time{}, 0, fmt.Errorf("解析活动信息失败: %w", err)
+		}
+	}
+
+	return time.UnixMilli(fields[0]), time.UnixMilli(fields[1]), int(fields[2]), nil
+}
+
+// AdjustStock 原子性调整已缓存的库存，调整后库存不能为负
+// 返回调整后的库存，库存不足返回 -1，库存未缓存返回 -5
+func (r *RedisCacheRepository) AdjustStock(ctx context.Context, couponID int64, delta int64) (int64, error) {
+	key := r.getStockKey(couponID)
+	stock, err := adjustStockScript.Run(ctx, r.client, []string{key}, delta, rand.Uint32()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("调整库存失败: %w", err)
+	}
+	if delta > 0 && stock >= 0 {
+		r.publishStockRestored(ctx, couponID)
+	}
+	return stock, nil
+}
+
+// IncrStock 原子性增加库存（分桶模式下加到随机选中的桶），库存未缓存时不处理
 func (r *RedisCacheRepository) IncrStock(ctx context.Context, couponID int64, delta int64) error {
 	key := r.getStockKey(couponID)
-	// INCRBY 是原子操作，线程安全
-	err := r.client.IncrBy(ctx, key, delta).Err()
+	incremented, err := incrStockScript.Run(ctx, r.client, []string{key}, delta, rand.Uint32()).Int64()
 	if err != nil {
 		return fmt.Errorf("增加库存失败: %w", err)
 	}
+	if incremented == 1 && delta > 0 {
+		r.publishStockRestored(ctx, couponID)
+	}
+	return nil
+}
+
+// CountBoughtUsers 统计已购用户集合的大小
+func (r *RedisCacheRepository) CountBoughtUsers(ctx context.Context, couponID int64) (int64, error) {
+	n, err := r.client.SCard(ctx, r.getUserSetKey(couponID)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("统计已购用户失败: %w", err)
+	}
+	return n, nil
+}
+
+// RevertStock 回滚用户的扣减：移出已购用户集合并归还 1 个库存
+// 只有用户确实在集合中时才归还库存，保证重复回滚不会多加库存
+func (r *RedisCacheRepository) RevertStock(ctx context.Context, couponID, userID int64) error {
+	return r.RevertStockN(ctx, couponID, userID, 1)
+}
+
+// RevertStockN 回滚 DecrStockN 的扣减：移出已购用户集合并归还 quantity 个库存
+func (r *RedisCacheRepository) RevertStockN(ctx context.Context, couponID, userID, quantity int64) error {
+	keys := []string{r.getStockKey(couponID), r.getUserSetKey(couponID)}
+	reverted, err := revertStockScript.Run(ctx, r.client, keys, userID, quantity, rand.Uint32()).Int64()
+	if err != nil {
+		return fmt.Errorf("回滚库存失败: %w", err)
+	}
+	if reverted == 1 {
+		r.publishStockRestored(ctx, couponID)
+	}
+	return nil
+}
+
+// publishStockRestored 广播库存归还通知，各实例收到后清除本地售罄标记
+// 发布失败只记录日志，本地售罄标记有过期时间兜底
+func (r *RedisCacheRepository) publishStockRestored(ctx context.Context, couponID int64) {
+	if err := r.client.Publish(ctx, r.restoredTopic, couponID).Err(); err != nil {
+		log.Printf("发布库存归还通知失败: %v, couponID=%d", err, couponID)
+	}
+}
+
+// SubscribeStockRestored 订阅库存归还通知，返回的 channel 在 ctx 结束后关闭
+func (r *RedisCacheRepository) SubscribeStockRestored(ctx context.Context) (<-chan int64, error) {
+	pubsub := r.client.Subscribe(ctx, r.restoredTopic)
+	// 等待订阅确认，确保返回后不会错过通知
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("订阅库存归还通知失败: %w", err)
+	}
+
+	couponIDs := make(chan int64)
+	go func() {
+		defer close(couponIDs)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				couponID, err := strconv.ParseInt(msg.Payload, 10, 64)
+				if err != nil {
+					log.Printf("解析库存归还通知失败: %v, payload=%s", err, msg.Payload)
+					continue
+				}
+				select {
+				case couponIDs <- couponID:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return couponIDs, nil
+}
+
+// SetOrderProcessing 写入订单处理中标记
+// 订单详情存于 seckill:processing:<orderID>，同时把订单ID记入用户集合便于列表查询
+func (r *RedisCacheRepository) SetOrderProcessing(ctx context.Context, order *Order, ttl time.Duration) error {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("序列化订单失败: %w", err)
+	}
+
+	userKey := r.getUserProcessingKey(order.UserID)
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, r.getProcessingOrderKey(order.ID), data, ttl)
+		pipe.SAdd(ctx, userKey, order.ID)
+		pipe.Expire(ctx, userKey, ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("写入订单处理中标记失败: %w", err)
+	}
+	return nil
+}
+
+// GetProcessingOrder 获取处理中的订单，没有标记时返回 nil
+func (r *RedisCacheRepository) GetProcessingOrder(ctx context.Context, orderID int64) (*Order, error) {
+	data, err := r.client.Get(ctx, r.getProcessingOrderKey(orderID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取订单处理中标记失败: %w", err)
+	}
+
+	var order Order
+	if err := json.Unmarshal(data, &order); err != nil {
+		return nil, fmt.Errorf("解析订单失败: %w", err)
+	}
+	return &order, nil
+}
+
+// ListProcessingOrders 获取用户所有处理中的订单
+// 标记已过期的订单ID会顺带从用户集合中移除
+func (r *RedisCacheRepository) ListProcessingOrders(ctx context.Context, userID int64) ([]*Order, error) {
+	userKey := r.getUserProcessingKey(userID)
+	ids, err := r.client.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取处理中订单失败: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = r.orderPrefix + id
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取处理中订单失败: %w", err)
+	}
+
+	var orders []*Order
+	var expired []interface{}
+	for i, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			expired = append(expired, ids[i])
+			continue
+		}
+		var order Order
+		if err := json.Unmarshal([]byte(data), &order); err != nil {
+			return nil, fmt.Errorf("解析订单失败: %w", err)
+		}
+		orders = append(orders, &order)
+	}
+
+	if len(expired) > 0 {
+		r.client.SRem(ctx, userKey, expired...)
+	}
+	return orders, nil
+}
+
+// ClearOrderProcessing 清除订单处理中标记
+func (r *RedisCacheRepository) ClearOrderProcessing(ctx context.Context, order *Order) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, r.getProcessingOrderKey(order.ID))
+		pipe.SRem(ctx, r.getUserProcessingKey(order.UserID), order.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("清除订单处理中标记失败: %w", err)
+	}
+	return nil
+}
+
+// ScheduleOrderTimeout 登记订单支付超时时间（有序集合，score 为到期毫秒时间戳）
+func (r *RedisCacheRepository) ScheduleOrderTimeout(ctx context.Context, orderID int64, deadline time.Time) error {
+	err := r.client.ZAddNX(ctx, r.timeoutKey, redis.Z{
+		Score:  float64(deadline.UnixMilli()),
+		Member: orderID,
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("登记订单超时失败: %w", err)
+	}
 	return nil
 }
+
+// ClaimExpiredOrders 原子性认领已到期的订单ID，租约 lease 内不会被再次认领
+func (r *RedisCacheRepository) ClaimExpiredOrders(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]int64, error) {
+	result, err := claimExpiredScript.Run(ctx, r.client, []string{r.timeoutKey}, now.UnixMilli(), limit, now.Add(lease).UnixMilli()).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("获取到期订单失败: %w", err)
+	}
+
+	ids := make([]int64, 0, len(result))
+	for _, v := range result {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("解析订单ID失败: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// RemoveOrderTimeout 移除订单支付超时登记
+func (r *RedisCacheRepository) RemoveOrderTimeout(ctx context.Context, orderID int64) error {
+	if err := r.client.ZRem(ctx, r.timeoutKey, orderID).Err(); err != nil {
+		return fmt.Errorf("移除订单超时登记失败: %w", err)
+	}
+	return nil
+}
+
+// JoinQueue 加入排队，返回排队号（已在队列中时返回原排队号）
+func (r *RedisCacheRepository) JoinQueue(ctx context.Context, couponID, userID int64) (int64, error) {
+	keys := []string{r.getQueueKey(couponID), r.getQueueSeqKey(couponID), r.queuedCoupons}
+	ticket, err := joinQueueScript.Run(ctx, r.client, keys, userID, couponID).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("加入排队失败: %w", err)
+	}
+	return ticket, nil
+}
+
+// GetQueuePosition 查询排队状态
+// 已放行时 position 为 0 并返回放行截止时间，排队中返回排名（从 1 开始），不在队列中返回 -1
+func (r *RedisCacheRepository) GetQueuePosition(ctx context.Context, couponID, userID int64, now time.Time) (int64, time.Time, error) {
+	keys := []string{r.getQueueKey(couponID), r.getAdmittedKey(couponID)}
+	result, err := queuePositionScript.Run(ctx, r.client, keys, userID, now.UnixMilli()).Int64Slice()
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("查询排队状态失败: %w", err)
+	}
+
+	if result[0] == 0 {
+		return 0, time.UnixMilli(result[1]), nil
+	}
+	return result[0], time.Time{}, nil
+}
+
+// IsAdmitted 用户是否已被放行且未过期
+func (r *RedisCacheRepository) IsAdmitted(ctx context.Context, couponID, userID int64, now time.Time) (bool, error) {
+	until, err := r.client.ZScore(ctx, r.getAdmittedKey(couponID), strconv.FormatInt(userID, 10)).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("查询放行状态失败: %w", err)
+	}
+	return int64(until) > now.UnixMilli(), nil
+}
+
+// ListQueuedCoupons 获取有用户排队的优惠券
+func (r *RedisCacheRepository) ListQueuedCoupons(ctx context.Context) ([]int64, error) {
+	members, err := r.client.SMembers(ctx, r.queuedCoupons).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取排队优惠券失败: %w", err)
+	}
+
+	couponIDs := make([]int64, 0, len(members))
+	for _, m := range members {
+		couponID, err := strconv.ParseInt(m, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("解析优惠券ID失败: %w", err)
+		}
+		couponIDs = append(couponIDs, couponID)
+	}
+	return couponIDs, nil
+}
+
+// AdmitFromQueue 按排队顺序放行最多 n 个用户，放行有效期截止到 until，返回放行的用户ID
+func (r *RedisCacheRepository) AdmitFromQueue(ctx context.Context, couponID int64, n int, until, now time.Time) ([]int64, error) {
+	keys := []string{r.getQueueKey(couponID), r.getAdmittedKey(couponID), r.queuedCoupons}
+	result, err := admitQueueScript.Run(ctx, r.client, keys, n, until.UnixMilli(), now.UnixMilli(), couponID).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("放行排队用户失败: %w", err)
+	}
+
+	userIDs := make([]int64, 0, len(result))
+	for _, v := range result {
+		userID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("解析用户ID失败: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, nil
+}
+
+// ConsumeToken 标记秒杀令牌已使用（SET NX），保留到令牌过期；令牌已被使用时返回 false
+func (r *RedisCacheRepository) ConsumeToken(ctx context.Context, nonce string, expireAt time.Time) (bool, error) {
+	ttl := max(time.Until(expireAt), time.Millisecond)
+	ok, err := r.client.SetNX(ctx, r.tokenPrefix+nonce, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("标记秒杀令牌已使用失败: %w", err)
+	}
+	return ok, nil
+}
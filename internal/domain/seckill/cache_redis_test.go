@@ -0,0 +1,287 @@
+package seckill
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 测试一次购买扣减多个库存及回滚
+func TestRedisCache_DecrStockN(t *testing.T) {
+	cacheRepo, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	require.NoError(t, cacheRepo.SetStock(ctx, 1, 5))
+
+	stock, err := cacheRepo.DecrStockN(ctx, 1, 1001, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stock)
+
+	// 库存少于购买数量
+	stock, err = cacheRepo.DecrStockN(ctx, 1, 1002, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(stockNotEnough), stock)
+
+	// 一人一单
+	stock, err = cacheRepo.DecrStockN(ctx, 1, 1001, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(alreadyPurchased), stock)
+
+	_, err = cacheRepo.DecrStockN(ctx, 1, 1003, 0)
+	assert.Error(t, err)
+
+	require.NoError(t, cacheRepo.RevertStockN(ctx, 1, 1001, 3))
+	stock, err = cacheRepo.GetStock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), stock)
+}
+
+// 测试批量获取库存
+func TestRedisCache_GetStocks(t *testing.T) {
+	cacheRepo, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	require.NoError(t, cacheRepo.SetStock(ctx, 1, 10))
+	require.NoError(t, cacheRepo.SetStock(ctx, 3, 30))
+
+	stocks, err := cacheRepo.GetStocks(ctx, []int64{1, 2, 3})
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]int64{1: 10, 3: 30}, stocks)
+}
+
+// 测试活动结束设置过期时间后，归还库存不会去掉过期时间，key 过期后也不会重新创建
+func TestRedisCache_IncrStockAfterExpire(t *testing.T) {
+	cacheRepo, client, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	require.NoError(t, cacheRepo.SetStock(ctx, 1, 5))
+	_, err := cacheRepo.DecrStock(ctx, 1, 1001)
+	require.NoError(t, err)
+	_, err = cacheRepo.DecrStock(ctx, 1, 1002)
+	require.NoError(t, err)
+	require.NoError(t, cacheRepo.ExpireCouponKeys(ctx, 1, time.Hour))
+
+	stockKey := cacheRepo.(*RedisCacheRepository).getStockKey(1)
+	require.NoError(t, cacheRepo.IncrStock(ctx, 1, 1))
+	ttl, err := client.PTTL(ctx, stockKey).Result()
+	require.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0))
+
+	// 模拟 key 过期
+	require.NoError(t, client.Del(ctx, stockKey).Err())
+	require.NoError(t, cacheRepo.IncrStock(ctx, 1, 1))
+	require.NoError(t, cacheRepo.RevertStock(ctx, 1, 1002))
+
+	exists, err := client.Exists(ctx, stockKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), exists)
+	bought, err := cacheRepo.CountBoughtUsers(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), bought)
+}
+
+// 测试认领到期订单：租约内不会重复认领，未移除的订单租约到期后重新认领
+func TestRedisCache_ClaimExpiredOrders(t *testing.T) {
+	cacheRepo, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	now := time.Now()
+	require.NoError(t, cacheRepo.ScheduleOrderTimeout(ctx, 1, now.Add(-time.Second)))
+	require.NoError(t, cacheRepo.ScheduleOrderTimeout(ctx, 2, now.Add(time.Minute)))
+
+	ids, err := cacheRepo.ClaimExpiredOrders(ctx, now, 10*time.Second, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, ids)
+
+	ids, err = cacheRepo.ClaimExpiredOrders(ctx, now, 10*time.Second, 10)
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	ids, err = cacheRepo.ClaimExpiredOrders(ctx, now.Add(10*time.Second), 10*time.Second, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, ids)
+
+	require.NoError(t, cacheRepo.RemoveOrderTimeout(ctx, 1))
+	ids, err = cacheRepo.ClaimExpiredOrders(ctx, now.Add(time.Hour), 10*time.Second, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2}, ids)
+}
+
+// 测试脚本被 SCRIPT FLUSH 清除后自动回退为 EVAL
+func TestRedisCache_ScriptFlushFallback(t *testing.T) {
+	cacheRepo, client, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	require.NoError(t, cacheRepo.SetStock(ctx, 1, 10))
+	require.NoError(t, client.ScriptFlush(ctx).Err())
+
+	stock, err := cacheRepo.DecrStock(ctx, 1, 1001)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), stock)
+}
+
+// 测试扣减成功时写入订单扣减记录，扣减失败时不写入
+func TestRedisCache_DecrStockForOrder(t *testing.T) {
+	cacheRepo, client, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	require.NoError(t, cacheRepo.SetStock(ctx, 1, 1))
+
+	stock, err := cacheRepo.DecrStockForOrder(ctx, 1, 1001, 9001)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stock)
+	deducted, err := cacheRepo.HasOrderDeduction(ctx, 9001)
+	require.NoError(t, err)
+	assert.True(t, deducted)
+	assert.Greater(t, client.PTTL(ctx, "seckill:deduct:9001").Val(), time.Duration(0))
+
+	// 一人一单和库存不足都不写入扣减记录
+	for orderID, userID := range map[int64]int64{9002: 1001, 9003: 1002} {
+		stock, err := cacheRepo.DecrStockForOrder(ctx, 1, userID, orderID)
+		require.NoError(t, err)
+		assert.Less(t, stock, int64(0))
+		deducted, err := cacheRepo.HasOrderDeduction(ctx, orderID)
+		require.NoError(t, err)
+		assert.False(t, deducted)
+	}
+}
+
+// 对比：每次请求发送完整脚本（EVAL）
+func BenchmarkDecrStock_Eval(b *testing.B) {
+	_, client, cleanup := setupTestEnv(b)
+	defer cleanup()
+
+	ctx := context.Background()
+	client.Set(ctx, "seckill:stock:1", b.N, 0)
+	keys := []string{"seckill:stock:1", "seckill:users:1", "seckill:activity:1"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := client.Eval(ctx, decrStockLua, keys, i, time.Now().UnixMilli(), 1).Err(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// 使用 EVALSHA 执行已缓存的脚本
+func BenchmarkDecrStock_EvalSha(b *testing.B) {
+	cacheRepo, _, cleanup := setupTestEnv(b)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := cacheRepo.SetStock(ctx, 1, int64(b.N)); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cacheRepo.DecrStock(ctx, 1, int64(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// 对比：逐个获取 100 个优惠券的库存
+func BenchmarkGetStock_Loop(b *testing.B) {
+	cacheRepo, couponIDs, cleanup := setupStockBenchmark(b)
+	defer cleanup()
+
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, couponID := range couponIDs {
+			if _, err := cacheRepo.GetStock(ctx, couponID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// 使用 pipeline 批量获取 100 个优惠券的库存
+func BenchmarkGetStocks_Pipeline(b *testing.B) {
+	cacheRepo, couponIDs, cleanup := setupStockBenchmark(b)
+	defer cleanup()
+
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cacheRepo.GetStocks(ctx, couponIDs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func setupStockBenchmark(b *testing.B) (CacheRepository, []int64, func()) {
+	cacheRepo, _, cleanup := setupTestEnv(b)
+
+	ctx := context.Background()
+	couponIDs := make([]int64, 100)
+	for i := range couponIDs {
+		couponIDs[i] = int64(i + 1)
+		if err := cacheRepo.SetStock(ctx, couponIDs[i], 100); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return cacheRepo, couponIDs, cleanup
+}
+
+// 测试分桶库存：平均分配、求和、跨桶扣减和切换分桶数
+func TestRedisCache_StockBuckets(t *testing.T) {
+	cacheRepo, client, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	require.NoError(t, cacheRepo.SetStock(ctx, 1, 10))
+	require.NoError(t, cacheRepo.SetStockBuckets(ctx, 1, 4))
+
+	// 单 key 的库存按分桶数重新分配
+	assert.Equal(t, int64(0), client.Exists(ctx, "seckill:stock:1").Val())
+	assert.Equal(t, "3", client.Get(ctx, "seckill:stock:1:0").Val())
+	assert.Equal(t, "2", client.Get(ctx, "seckill:stock:1:3").Val())
+
+	stock, err := cacheRepo.GetStock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), stock)
+
+	// 扣减 9 个用户后只剩 1 个，随机选桶不足时回退到其他桶
+	for i := int64(0); i < 9; i++ {
+		stock, err := cacheRepo.DecrStock(ctx, 1, 1000+i)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, stock, int64(0))
+	}
+	stock, err = cacheRepo.DecrStock(ctx, 1, 2000)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, stock, int64(0))
+	stock, err = cacheRepo.DecrStock(ctx, 1, 2001)
+	require.NoError(t, err)
+	assert.Equal(t, int64(stockNotEnough), stock)
+
+	// 归还和跨桶扣减
+	require.NoError(t, cacheRepo.IncrStock(ctx, 1, 3))
+	stock, err = cacheRepo.DecrStockN(ctx, 1, 3000, 3)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, stock, int64(0))
+
+	require.NoError(t, cacheRepo.IncrStock(ctx, 1, 5))
+	stock, err = cacheRepo.AdjustStock(ctx, 1, -2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stock)
+
+	stocks, err := cacheRepo.GetStocks(ctx, []int64{1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stocks[1])
+
+	// 切回单 key 模式
+	require.NoError(t, cacheRepo.SetStockBuckets(ctx, 1, 1))
+	assert.Equal(t, "3", client.Get(ctx, "seckill:stock:1").Val())
+	assert.Equal(t, int64(0), client.Exists(ctx, "seckill:stock:1:0", "seckill:stock:1:buckets").Val())
+}
@@ -0,0 +1,187 @@
+package seckill
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"rag-agent/config"
+)
+
+const (
+	compensationInterval    = 5 * time.Second // 轮询间隔
+	compensationBatchSize   = 100             // 每次拉取的任务数
+	compensationBaseBackoff = 2 * time.Second // 首次重试的退避时间
+	compensationMaxBackoff  = 5 * time.Minute // 退避时间上限
+
+	// compensationProcessingTimeout 任务处于处理中超过该时间未更新，视为处理实例已崩溃，重新投递
+	// 订单消费者按订单ID幂等，重复投递不会重复落库
+	compensationProcessingTimeout = time.Minute
+)
+
+// CompensationWorker 补偿任务 worker
+// 定时拉取待处理的补偿任务，将到期任务的订单消息批量重新投递；
+// 按指数退避重试，超过 MaxRetry 后标记失败并回滚 Redis 库存和已购用户；
+// 每批任务在分布式锁内处理，多实例部署时同一时刻只有一个实例投递
+type CompensationWorker struct {
+	repo       Repository
+	cache      CacheRepository
+	mqProducer MQProducer
+	locker     Locker
+	cfg        *config.SeckillConfig
+
+	interval time.Duration
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewCompensationWorker 创建补偿任务 worker
+func NewCompensationWorker(repo Repository, cache CacheRepository, mq MQProducer, locker Locker, cfg *config.SeckillConfig) *CompensationWorker {
+	return &CompensationWorker{
+		repo:       repo,
+		cache:      cache,
+		mqProducer: mq,
+		locker:     locker,
+		cfg:        cfg,
+		interval:   compensationInterval,
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// Start 启动后台轮询
+func (w *CompensationWorker) Start(ctx context.Context) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.stopCh:
+				return
+			case <-ticker.C:
+				if err := w.RunOnce(ctx); err != nil {
+					log.Printf("处理补偿任务失败: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止后台轮询并等待当前批次处理完成
+func (w *CompensationWorker) Stop() {
+	close(w.stopCh)
+	w.wg.Wait()
+}
+
+// RunOnce 处理一批到期的补偿任务，其他实例正在处理时直接跳过
+func (w *CompensationWorker) RunOnce(ctx context.Context) error {
+	unlock, err := w.locker.Lock(ctx, "compensation")
+	if errors.Is(err, ErrLockFailed) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tasks, err := w.repo.GetPendingCompensationTasks(ctx, compensationBatchSize, compensationProcessingTimeout)
+	if err != nil {
+		return err
+	}
+
+	// 退避期由查询按数据库时间过滤，返回的任务都已到期
+	var due []*CompensationTask
+	for _, task := range tasks {
+		if err := w.repo.UpdateCompensationTaskStatus(ctx, task.ID, CompensationProcessing, task.RetryCount); err != nil {
+			log.Printf("标记补偿任务处理中失败: %v, taskID=%d", err, task.ID)
+			continue
+		}
+		due = append(due, task)
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	// 本轮到期的任务通过一次批量请求重新投递，失败时每个任务各计一次重试
+	orders := make([]*Order, 0, len(due))
+	for _, task := range due {
+		orders = append(orders, &Order{
+			ID:        task.OrderID,
+			UserID:    task.UserID,
+			CouponID:  task.CouponID,
+			Status:    OrderPending,
+			CreatedAt: task.OrderCreatedAt,
+		})
+	}
+	err = w.mqProducer.SendOrderMessages(ctx, orders)
+	for i, task := range due {
+		if err == nil {
+			if err := w.repo.UpdateCompensationTaskStatus(ctx, task.ID, CompensationDone, task.RetryCount); err != nil {
+				log.Printf("标记补偿任务完成失败: %v, taskID=%d", err, task.ID)
+			}
+			log.Printf("补偿任务投递成功: taskID=%d, orderID=%d", task.ID, task.OrderID)
+			continue
+		}
+		w.retry(ctx, task, orders[i], err)
+	}
+
+	return nil
+}
+
+// retry 处理投递失败的补偿任务：未超过 MaxRetry 时等待下次重试，否则标记失败并回滚库存
+func (w *CompensationWorker) retry(ctx context.Context, task *CompensationTask, order *Order, err error) {
+	retryCount := task.RetryCount + 1
+	log.Printf("补偿任务投递失败: %v, taskID=%d, retry=%d", err, task.ID, retryCount)
+
+	if retryCount < w.cfg.MaxRetry {
+		if err := w.repo.UpdateCompensationTaskStatus(ctx, task.ID, CompensationPending, retryCount); err != nil {
+			log.Printf("更新补偿任务重试次数失败: %v, taskID=%d", err, task.ID)
+		}
+		return
+	}
+
+	// 超过最大重试次数，标记失败并归还 Redis 库存，用户可以重新抢购
+	// 对账正在修复该优惠券时保持处理中，超时后重新处理
+	unlock, err := w.locker.Lock(ctx, reconcileLockName(task.CouponID))
+	if err != nil {
+		log.Printf("获取对账锁失败: %v, taskID=%d, 稍后重试", err, task.ID)
+		return
+	}
+	defer unlock()
+
+	if err := w.repo.UpdateCompensationTaskStatus(ctx, task.ID, CompensationFailed, retryCount); err != nil {
+		log.Printf("标记补偿任务失败状态失败: %v, taskID=%d", err, task.ID)
+		return
+	}
+	if err := w.cache.RevertStock(ctx, task.CouponID, task.UserID); err != nil {
+		log.Printf("补偿失败后回滚库存失败: %v, taskID=%d", err, task.ID)
+	}
+	if err := w.cache.ClearOrderProcessing(ctx, order); err != nil {
+		log.Printf("补偿失败后清除订单处理中标记失败: %v, taskID=%d", err, task.ID)
+	}
+	log.Printf("补偿任务超过最大重试次数，已放弃: taskID=%d, orderID=%d", task.ID, task.OrderID)
+}
+
+// compensationBackoff 计算第 retryCount 次重试前需要等待的时间（指数退避）
+func compensationBackoff(retryCount int) time.Duration {
+	if retryCount <= 0 {
+		return 0
+	}
+
+	backoff := compensationBaseBackoff
+	for i := 1; i < retryCount; i++ {
+		backoff *= 2
+		if backoff >= compensationMaxBackoff {
+			return compensationMaxBackoff
+		}
+	}
+	return backoff
+}
@@ -0,0 +1,152 @@
+package seckill
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rag-agent/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 测试指数退避
+func TestCompensationBackoff(t *testing.T) {
+	assert.Equal(t, time.Duration(0), compensationBackoff(0))
+	assert.Equal(t, 2*time.Second, compensationBackoff(1))
+	assert.Equal(t, 4*time.Second, compensationBackoff(2))
+	assert.Equal(t, 8*time.Second, compensationBackoff(3))
+	assert.Equal(t, compensationMaxBackoff, compensationBackoff(30))
+}
+
+// 测试补偿任务重新投递成功，重新投递的订单保留原下单时间
+func TestCompensationWorker_ResendSuccess(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	orderCreatedAt := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	require.NoError(t, repo.SaveCompensationTask(ctx, &CompensationTask{UserID: 1001, CouponID: 1, OrderCreatedAt: orderCreatedAt}))
+
+	producer := &TestMQProducer{}
+	worker := NewCompensationWorker(repo, nil, producer, &TestLocker{}, &config.SeckillConfig{MaxRetry: 3})
+	require.NoError(t, worker.RunOnce(ctx))
+
+	require.Len(t, producer.sent, 1)
+	assert.True(t, orderCreatedAt.Equal(producer.sent[0].CreatedAt))
+
+	assert.Equal(t, CompensationDone, repo.tasks[1].Status)
+	assert.Equal(t, 0, repo.tasks[1].RetryCount)
+}
+
+// 测试到期的补偿任务通过一次批量请求投递，退避期内的任务不投递
+func TestCompensationWorker_BatchSend(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	for userID := int64(1001); userID <= 1003; userID++ {
+		require.NoError(t, repo.SaveCompensationTask(ctx, &CompensationTask{OrderID: userID * 10, UserID: userID, CouponID: 1}))
+	}
+	require.NoError(t, repo.SaveCompensationTask(ctx, &CompensationTask{
+		OrderID: 10040, UserID: 1004, CouponID: 1, RetryCount: 1, UpdatedAt: time.Now(),
+	}))
+
+	producer := &TestMQProducer{}
+	worker := NewCompensationWorker(repo, nil, producer, &TestLocker{}, &config.SeckillConfig{MaxRetry: 3})
+	require.NoError(t, worker.RunOnce(ctx))
+
+	assert.Equal(t, 1, producer.batches)
+	require.Len(t, producer.sent, 3)
+	for _, order := range producer.sent {
+		assert.Equal(t, order.UserID*10, order.ID)
+	}
+	for id := int64(1); id <= 3; id++ {
+		assert.Equal(t, CompensationDone, repo.tasks[id].Status)
+	}
+	assert.Equal(t, CompensationPending, repo.tasks[4].Status)
+}
+
+// 测试处理中超时的补偿任务（处理实例崩溃）重新投递，未超时的不处理
+func TestCompensationWorker_StuckProcessing(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	require.NoError(t, repo.SaveCompensationTask(ctx, &CompensationTask{
+		OrderID: 10010, UserID: 1001, CouponID: 1, Status: CompensationProcessing,
+		UpdatedAt: time.Now().Add(-2 * compensationProcessingTimeout),
+	}))
+	require.NoError(t, repo.SaveCompensationTask(ctx, &CompensationTask{
+		OrderID: 10020, UserID: 1002, CouponID: 1, Status: CompensationProcessing,
+		UpdatedAt: time.Now(),
+	}))
+
+	producer := &TestMQProducer{}
+	worker := NewCompensationWorker(repo, nil, producer, &TestLocker{}, &config.SeckillConfig{MaxRetry: 3})
+	require.NoError(t, worker.RunOnce(ctx))
+
+	require.Len(t, producer.sent, 1)
+	assert.Equal(t, int64(10010), producer.sent[0].ID)
+	assert.Equal(t, CompensationDone, repo.tasks[1].Status)
+	assert.Equal(t, CompensationProcessing, repo.tasks[2].Status)
+}
+
+// 测试补偿任务在退避期内不会被处理
+func TestCompensationWorker_SkipDuringBackoff(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	require.NoError(t, repo.SaveCompensationTask(ctx, &CompensationTask{
+		UserID:     1001,
+		CouponID:   1,
+		RetryCount: 1,
+		UpdatedAt:  time.Now(),
+	}))
+
+	worker := NewCompensationWorker(repo, nil, &TestMQProducer{}, &TestLocker{}, &config.SeckillConfig{MaxRetry: 3})
+	require.NoError(t, worker.RunOnce(ctx))
+
+	assert.Equal(t, CompensationPending, repo.tasks[1].Status)
+}
+
+// 测试补偿任务重试耗尽后标记失败并回滚库存
+func TestCompensationWorker_ExhaustRetries(t *testing.T) {
+	cacheRepo, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	require.NoError(t, cacheRepo.SetStock(ctx, 1, 10))
+	_, err := cacheRepo.DecrStock(ctx, 1, 1001)
+	require.NoError(t, err)
+
+	repo := NewTestRepository()
+	require.NoError(t, repo.SaveCompensationTask(ctx, &CompensationTask{UserID: 1001, CouponID: 1}))
+
+	worker := NewCompensationWorker(repo, cacheRepo, &TestMQProducer{shouldFail: true}, &TestLocker{}, &config.SeckillConfig{MaxRetry: 2})
+
+	// 第一次失败：重试次数 +1，仍为待处理
+	require.NoError(t, worker.RunOnce(ctx))
+	assert.Equal(t, CompensationPending, repo.tasks[1].Status)
+	assert.Equal(t, 1, repo.tasks[1].RetryCount)
+
+	// 退避期过后第二次失败：达到 MaxRetry，标记失败
+	repo.tasks[1].UpdatedAt = time.Now().Add(-time.Hour)
+	require.NoError(t, worker.RunOnce(ctx))
+	assert.Equal(t, CompensationFailed, repo.tasks[1].Status)
+
+	// 验证库存已归还
+	stock, err := cacheRepo.GetStock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), stock)
+}
+
+// 测试其他实例持有锁时跳过本轮
+func TestCompensationWorker_SkipWhenLocked(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	require.NoError(t, repo.SaveCompensationTask(ctx, &CompensationTask{UserID: 1001, CouponID: 1}))
+
+	locker := &TestLocker{}
+	_, err := locker.Lock(ctx, "compensation")
+	require.NoError(t, err)
+
+	worker := NewCompensationWorker(repo, nil, &TestMQProducer{}, locker, &config.SeckillConfig{MaxRetry: 3})
+	require.NoError(t, worker.RunOnce(ctx))
+
+	assert.Equal(t, CompensationPending, repo.tasks[1].Status)
+}
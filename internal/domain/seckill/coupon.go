@@ -0,0 +1,217 @@
+package seckill
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+const (
+	defaultCouponPageSize = 20  // 优惠券列表默认每页条数
+	maxCouponPageSize     = 100 // 优惠券列表每页条数上限
+	maxStockBuckets       = 64  // 库存分桶数上限
+)
+
+// CreateCoupon 创建优惠券，状态为进行中时自动预热 Redis 库存
+func (s *Service) CreateCoupon(ctx context.Context, req *CreateCouponRequest) (*Coupon, error) {
+	coupon := &Coupon{
+		Name:         req.Name,
+		Description:  req.Description,
+		TotalStock:   req.TotalStock,
+		RemainStock:  req.TotalStock,
+		StockBuckets: max(req.StockBuckets, 1),
+		StartTime:    req.StartTime,
+		EndTime:      req.EndTime,
+		Status:       req.Status,
+	}
+	if err := validateCoupon(coupon); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CreateCoupon(ctx, coupon); err != nil {
+		return nil, err
+	}
+
+	if coupon.Status == CouponActive {
+		if err := s.InitStock(ctx, coupon.ID); err != nil {
+			return nil, fmt.Errorf("预热库存失败: %w", err)
+		}
+	}
+
+	return coupon, nil
+}
+
+// UpdateCoupon 更新优惠券
+// 修改总库存时先原子调整 Redis 库存，再同步 MySQL，MySQL 失败时回滚 Redis；
+// 状态变为进行中时自动预热 Redis 库存，否则同步活动信息
+func (s *Service) UpdateCoupon(ctx context.Context, couponID int64, req *UpdateCouponRequest) (*Coupon, error) {
+	unlock, err := s.locker.Lock(ctx, fmt.Sprintf("coupon:%d", couponID))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	coupon, err := s.repo.GetCoupon(ctx, couponID)
+	if err != nil {
+		return nil, err
+	}
+	wasActive := coupon.Status == CouponActive
+
+	if req.Name != nil {
+		coupon.Name = *req.Name
+	}
+	if req.Description != nil {
+		coupon.Description = *req.Description
+	}
+	if req.StockBuckets != nil {
+		coupon.StockBuckets = *req.StockBuckets
+	}
+	if req.StartTime != nil {
+		coupon.StartTime = *req.StartTime
+	}
+	if req.EndTime != nil {
+		coupon.EndTime = *req.EndTime
+	}
+	if req.Status != nil {
+		coupon.Status = *req.Status
+	}
+
+	var delta int64
+	if req.TotalStock != nil {
+		delta = *req.TotalStock - coupon.TotalStock
+		coupon.TotalStock = *req.TotalStock
+		coupon.RemainStock += delta
+	}
+	if err := validateCoupon(coupon); err != nil {
+		return nil, err
+	}
+
+	if delta != 0 {
+		if err := s.adjustStock(ctx, couponID, delta); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repo.UpdateCoupon(ctx, coupon); err != nil {
+		if delta != 0 {
+			// 库存调整已生效，按相反差值撤销，避免库存与优惠券信息不一致
+			if revertErr := s.adjustStock(ctx, couponID, -delta); revertErr != nil {
+				log.Printf("撤销库存调整失败: %v, couponID=%d, delta=%d", revertErr, couponID, delta)
+			}
+		}
+		return nil, err
+	}
+
+	if req.StockBuckets != nil {
+		// 已缓存的库存按新的分桶数重新分配
+		if err := s.cache.SetStockBuckets(ctx, couponID, coupon.StockBuckets); err != nil {
+			return nil, err
+		}
+	}
+
+	if !wasActive && coupon.Status == CouponActive {
+		if err := s.InitStock(ctx, couponID); err != nil {
+			return nil, fmt.Errorf("预热库存失败: %w", err)
+		}
+		return coupon, nil
+	}
+
+	if err := s.cache.SetActivity(ctx, couponID, coupon.StartTime, coupon.EndTime, coupon.Status); err != nil {
+		return nil, err
+	}
+
+	return coupon, nil
+}
+
+// adjustStock 调整总库存：先调整 Redis 缓存库存，再调整 MySQL，MySQL 失败时回滚 Redis
+func (s *Service) adjustStock(ctx context.Context, couponID int64, delta int64) error {
+	stock, err := s.cache.AdjustStock(ctx, couponID, delta)
+	if err != nil {
+		return err
+	}
+	if stock == stockNotEnough {
+		return ErrStockNotEnough
+	}
+	cached := stock != stockNotCached
+
+	if err := s.repo.AdjustCouponStock(ctx, couponID, delta); err != nil {
+		if cached {
+			if revertErr := s.cache.IncrStock(ctx, couponID, -delta); revertErr != nil {
+				log.Printf("回滚Redis库存调整失败: %v, couponID=%d, delta=%d", revertErr, couponID, delta)
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ListCoupons 分页查询优惠券列表
+func (s *Service) ListCoupons(ctx context.Context, req *ListCouponsRequest) (*CouponListResponse, error) {
+	page := req.Page
+	if page < 1 {
+		page = 1
+	}
+	pageSize := req.PageSize
+	if pageSize < 1 {
+		pageSize = defaultCouponPageSize
+	}
+	if pageSize > maxCouponPageSize {
+		pageSize = maxCouponPageSize
+	}
+
+	coupons, total, err := s.repo.ListCoupons(ctx, req.Status, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	if coupons == nil {
+		coupons = []*Coupon{}
+	}
+
+	return &CouponListResponse{
+		Coupons:  coupons,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+// DeleteCoupon 软删除优惠券，并将 Redis 活动状态置为已结束以停止秒杀
+func (s *Service) DeleteCoupon(ctx context.Context, couponID int64) error {
+	unlock, err := s.locker.Lock(ctx, fmt.Sprintf("coupon:%d", couponID))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	coupon, err := s.repo.GetCoupon(ctx, couponID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteCoupon(ctx, couponID); err != nil {
+		return err
+	}
+
+	return s.cache.SetActivity(ctx, couponID, coupon.StartTime, coupon.EndTime, CouponEnded)
+}
+
+// validateCoupon 校验优惠券参数
+func validateCoupon(coupon *Coupon) error {
+	if coupon.Name == "" {
+		return fmt.Errorf("%w: 名称不能为空", ErrCouponInvalid)
+	}
+	if coupon.TotalStock <= 0 {
+		return fmt.Errorf("%w: 总库存必须大于0", ErrCouponInvalid)
+	}
+	if !coupon.EndTime.After(coupon.StartTime) {
+		return fmt.Errorf("%w: 结束时间必须晚于开始时间", ErrCouponInvalid)
+	}
+	if coupon.StockBuckets < 1 || coupon.StockBuckets > maxStockBuckets {
+		return fmt.Errorf("%w: 库存分桶数必须在 1-%d 之间", ErrCouponInvalid, maxStockBuckets)
+	}
+	if coupon.Status < CouponNotStarted || coupon.Status > CouponEnded {
+		return fmt.Errorf("%w: 状态无效", ErrCouponInvalid)
+	}
+	return nil
+}
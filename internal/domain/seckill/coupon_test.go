@@ -0,0 +1,232 @@
+package seckill
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rag-agent/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCouponService() (*Service, *TestRepository, *TestOrderCache) {
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	return NewService(repo, cache, nil, nil, &TestLocker{}, &config.SeckillConfig{}), repo, cache
+}
+
+func newCreateCouponRequest(status int) *CreateCouponRequest {
+	now := time.Now()
+	return &CreateCouponRequest{
+		Name:       "满100减20",
+		TotalStock: 100,
+		StartTime:  now,
+		EndTime:    now.Add(time.Hour),
+		Status:     status,
+	}
+}
+
+// 测试创建进行中的优惠券会自动预热 Redis 库存
+func TestService_CreateCoupon_WarmsActiveStock(t *testing.T) {
+	ctx := context.Background()
+	service, _, cache := newTestCouponService()
+
+	coupon, err := service.CreateCoupon(ctx, newCreateCouponRequest(CouponActive))
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), coupon.RemainStock)
+
+	stock, err := cache.GetStock(ctx, coupon.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), stock)
+	assert.Equal(t, CouponActive, cache.activities[coupon.ID])
+
+	// 未开始的优惠券不预热
+	pending, err := service.CreateCoupon(ctx, newCreateCouponRequest(CouponNotStarted))
+	require.NoError(t, err)
+	_, cached := cache.stocks[pending.ID]
+	assert.False(t, cached)
+}
+
+// 测试参数校验
+func TestService_CreateCoupon_Invalid(t *testing.T) {
+	service, _, _ := newTestCouponService()
+
+	req := newCreateCouponRequest(CouponActive)
+	req.EndTime = req.StartTime.Add(-time.Minute)
+
+	_, err := service.CreateCoupon(context.Background(), req)
+	assert.ErrorIs(t, err, ErrCouponInvalid)
+}
+
+// 测试激活优惠券时预热库存
+func TestService_UpdateCoupon_Activate(t *testing.T) {
+	ctx := context.Background()
+	service, _, cache := newTestCouponService()
+
+	coupon, err := service.CreateCoupon(ctx, newCreateCouponRequest(CouponNotStarted))
+	require.NoError(t, err)
+
+	status := CouponActive
+	_, err = service.UpdateCoupon(ctx, coupon.ID, &UpdateCouponRequest{Status: &status})
+	require.NoError(t, err)
+
+	stock, err := cache.GetStock(ctx, coupon.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), stock)
+	assert.Equal(t, CouponActive, cache.activities[coupon.ID])
+}
+
+// 测试修改进行中优惠券的总库存会同步调整缓存库存
+func TestService_UpdateCoupon_AdjustStock(t *testing.T) {
+	ctx := context.Background()
+	service, repo, cache := newTestCouponService()
+
+	coupon, err := service.CreateCoupon(ctx, newCreateCouponRequest(CouponActive))
+	require.NoError(t, err)
+
+	// 模拟已售出 30 张
+	require.NoError(t, cache.SetStock(ctx, coupon.ID, 70))
+	repo.stocks[coupon.ID] = 70
+
+	total := int64(150)
+	updated, err := service.UpdateCoupon(ctx, coupon.ID, &UpdateCouponRequest{TotalStock: &total})
+	require.NoError(t, err)
+	assert.Equal(t, int64(150), updated.TotalStock)
+	assert.Equal(t, int64(120), updated.RemainStock)
+
+	stock, err := cache.GetStock(ctx, coupon.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(120), stock)
+
+	// 总库存不能低于已售出数量，缓存库存保持不变
+	total = 20
+	_, err = service.UpdateCoupon(ctx, coupon.ID, &UpdateCouponRequest{TotalStock: &total})
+	assert.ErrorIs(t, err, ErrStockNotEnough)
+
+	stock, err = cache.GetStock(ctx, coupon.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(120), stock)
+}
+
+// 更新优惠券信息失败的 Repository
+type failingUpdateRepository struct {
+	*TestRepository
+}
+
+func (r *failingUpdateRepository) UpdateCoupon(ctx context.Context, coupon *Coupon) error {
+	return assert.AnError
+}
+
+// 测试更新优惠券失败时撤销已生效的库存调整
+func TestService_UpdateCoupon_RevertStockOnFailure(t *testing.T) {
+	ctx := context.Background()
+	service, repo, cache := newTestCouponService()
+
+	coupon, err := service.CreateCoupon(ctx, newCreateCouponRequest(CouponActive))
+	require.NoError(t, err)
+
+	service.repo = &failingUpdateRepository{TestRepository: repo}
+	total := int64(150)
+	_, err = service.UpdateCoupon(ctx, coupon.ID, &UpdateCouponRequest{TotalStock: &total})
+	assert.ErrorIs(t, err, assert.AnError)
+
+	stock, err := cache.GetStock(ctx, coupon.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), stock)
+	assert.Equal(t, int64(100), repo.stocks[coupon.ID])
+	assert.Equal(t, int64(100), repo.coupons[coupon.ID].TotalStock)
+}
+
+// 测试分页和状态过滤
+func TestService_ListCoupons(t *testing.T) {
+	ctx := context.Background()
+	service, _, _ := newTestCouponService()
+
+	for i := 0; i < 3; i++ {
+		_, err := service.CreateCoupon(ctx, newCreateCouponRequest(CouponActive))
+		require.NoError(t, err)
+	}
+	_, err := service.CreateCoupon(ctx, newCreateCouponRequest(CouponNotStarted))
+	require.NoError(t, err)
+
+	status := CouponActive
+	resp, err := service.ListCoupons(ctx, &ListCouponsRequest{Status: &status, Page: 2, PageSize: 2})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), resp.Total)
+	require.Len(t, resp.Coupons, 1)
+	assert.Equal(t, int64(1), resp.Coupons[0].ID)
+
+	resp, err = service.ListCoupons(ctx, &ListCouponsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), resp.Total)
+	assert.Equal(t, defaultCouponPageSize, resp.PageSize)
+}
+
+// 测试删除优惠券后停止秒杀
+func TestService_DeleteCoupon(t *testing.T) {
+	ctx := context.Background()
+	service, _, cache := newTestCouponService()
+
+	coupon, err := service.CreateCoupon(ctx, newCreateCouponRequest(CouponActive))
+	require.NoError(t, err)
+
+	require.NoError(t, service.DeleteCoupon(ctx, coupon.ID))
+	assert.Equal(t, CouponEnded, cache.activities[coupon.ID])
+
+	_, err = service.GetCoupon(ctx, coupon.ID)
+	assert.ErrorIs(t, err, ErrCouponNotFound)
+
+	assert.ErrorIs(t, service.DeleteCoupon(ctx, coupon.ID), ErrCouponNotFound)
+}
+
+// 测试 Redis 原子调整库存
+func TestRedisCache_AdjustStock(t *testing.T) {
+	cacheRepo, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	// 库存未缓存时不做调整
+	stock, err := cacheRepo.AdjustStock(ctx, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(stockNotCached), stock)
+
+	require.NoError(t, cacheRepo.SetStock(ctx, 1, 5))
+
+	stock, err = cacheRepo.AdjustStock(ctx, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), stock)
+
+	// 调整后为负时拒绝
+	stock, err = cacheRepo.AdjustStock(ctx, 1, -20)
+	require.NoError(t, err)
+	assert.Equal(t, int64(stockNotEnough), stock)
+
+	stock, err = cacheRepo.GetStock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), stock)
+}
+
+// 测试创建和修改优惠券时同步库存分桶数
+func TestService_CouponStockBuckets(t *testing.T) {
+	ctx := context.Background()
+	service, _, cache := newTestCouponService()
+
+	req := newCreateCouponRequest(CouponActive)
+	req.StockBuckets = 8
+	coupon, err := service.CreateCoupon(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, 8, cache.buckets[coupon.ID])
+
+	buckets := 4
+	updated, err := service.UpdateCoupon(ctx, coupon.ID, &UpdateCouponRequest{StockBuckets: &buckets})
+	require.NoError(t, err)
+	assert.Equal(t, 4, updated.StockBuckets)
+	assert.Equal(t, 4, cache.buckets[coupon.ID])
+
+	buckets = maxStockBuckets + 1
+	_, err = service.UpdateCoupon(ctx, coupon.ID, &UpdateCouponRequest{StockBuckets: &buckets})
+	assert.ErrorIs(t, err, ErrCouponInvalid)
+}
@@ -0,0 +1,142 @@
+package seckill
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+)
+
+const (
+	defaultDeadLetterPageSize = 20  // 死信列表默认每页条数
+	maxDeadLetterPageSize     = 100 // 死信列表每页条数上限
+)
+
+// ListDeadLetters 分页查询死信
+func (s *Service) ListDeadLetters(ctx context.Context, req *ListDeadLettersRequest) (*DeadLetterListResponse, error) {
+	page := req.Page
+	if page < 1 {
+		page = 1
+	}
+	pageSize := req.PageSize
+	if pageSize < 1 {
+		pageSize = defaultDeadLetterPageSize
+	}
+	if pageSize > maxDeadLetterPageSize {
+		pageSize = maxDeadLetterPageSize
+	}
+
+	deadLetters, total, err := s.repo.ListDeadLetters(ctx, req.Status, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	if deadLetters == nil {
+		deadLetters = []*DeadLetter{}
+	}
+
+	return &DeadLetterListResponse{
+		DeadLetters: deadLetters,
+		Total:       total,
+		Page:        page,
+		PageSize:    pageSize,
+	}, nil
+}
+
+// GetDeadLetter 查询死信
+func (s *Service) GetDeadLetter(ctx context.Context, id int64) (*DeadLetter, error) {
+	return s.repo.GetDeadLetter(ctx, id)
+}
+
+// ReplayDeadLetter 重放死信：将订单消息重新发送到消息队列，由订单消费者重新落库
+// 先发送再标记已重放，标记失败时重复发送的消息由消费者按订单幂等处理
+func (s *Service) ReplayDeadLetter(ctx context.Context, id int64) error {
+	unlock, err := s.locker.Lock(ctx, fmt.Sprintf("dead_letter:%d", id))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dl, order, err := s.getPendingDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+	if order == nil {
+		return ErrDeadLetterInvalid
+	}
+
+	if err := s.mqProducer.SendOrderMessage(ctx, order); err != nil {
+		return err
+	}
+	if err := s.repo.UpdateDeadLetterStatus(ctx, dl.ID, DeadLetterPending, DeadLetterReplayed); err != nil {
+		return err
+	}
+
+	log.Printf("死信已重放: deadLetterID=%d, orderID=%d", dl.ID, order.ID)
+	return nil
+}
+
+// DiscardDeadLetter 丢弃死信；订单未落库时回滚 Redis 扣减并清除处理中标记，用户可以重新抢购
+func (s *Service) DiscardDeadLetter(ctx context.Context, id int64) error {
+	unlock, err := s.locker.Lock(ctx, fmt.Sprintf("dead_letter:%d", id))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dl, order, err := s.getPendingDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+	if order != nil {
+		// 回滚扣减与库存对账互斥，在标记丢弃前加锁，加锁失败时死信保持待处理
+		unlockReconcile, err := s.locker.Lock(ctx, reconcileLockName(order.CouponID))
+		if err != nil {
+			return err
+		}
+		defer unlockReconcile()
+	}
+	if err := s.repo.UpdateDeadLetterStatus(ctx, dl.ID, DeadLetterPending, DeadLetterDiscarded); err != nil {
+		return err
+	}
+	log.Printf("死信已丢弃: deadLetterID=%d", dl.ID)
+
+	// 无法解析的消息没有对应的扣减
+	if order == nil {
+		return nil
+	}
+	_, err = s.repo.GetOrder(ctx, order.ID)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrOrderNotFound) {
+		log.Printf("丢弃死信后查询订单失败: %v, orderID=%d", err, order.ID)
+		return nil
+	}
+
+	if err := s.cache.RevertStock(ctx, order.CouponID, order.UserID); err != nil {
+		// Redis 库存差异由对账修复
+		log.Printf("丢弃死信后回滚库存失败: %v, orderID=%d", err, order.ID)
+	}
+	if err := s.cache.ClearOrderProcessing(ctx, order); err != nil {
+		log.Printf("丢弃死信后清除订单处理中标记失败: %v, orderID=%d", err, order.ID)
+	}
+	return nil
+}
+
+// getPendingDeadLetter 获取待处理的死信并解析订单，消息体无法解析时订单为 nil
+func (s *Service) getPendingDeadLetter(ctx context.Context, id int64) (*DeadLetter, *Order, error) {
+	dl, err := s.repo.GetDeadLetter(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dl.Status != DeadLetterPending {
+		return nil, nil, ErrDeadLetterHandled
+	}
+
+	var order Order
+	if err := json.Unmarshal([]byte(dl.Payload), &order); err != nil || order.ID == 0 {
+		return dl, nil, nil
+	}
+	return dl, &order, nil
+}
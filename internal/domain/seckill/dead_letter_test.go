@@ -0,0 +1,96 @@
+package seckill
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"rag-agent/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 构造订单死信，订单的 Redis 扣减和处理中标记仍保留
+func newOrderDeadLetter(t *testing.T, repo *TestRepository, cache *TestOrderCache, order *Order) int64 {
+	body, err := json.Marshal(order)
+	require.NoError(t, err)
+	dl := &DeadLetter{Payload: string(body), Error: "处理失败", Status: DeadLetterPending}
+	require.NoError(t, repo.SaveDeadLetter(context.Background(), dl))
+	require.NoError(t, cache.SetOrderProcessing(context.Background(), order, 0))
+	return dl.ID
+}
+
+// 测试重放死信：重新发送订单消息，只能处理一次
+func TestService_ReplayDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	producer := &TestMQProducer{}
+	service := NewService(repo, cache, producer, &TestIDGenerator{}, &TestLocker{}, &config.SeckillConfig{})
+
+	id := newOrderDeadLetter(t, repo, cache, &Order{ID: 10, UserID: 1001, CouponID: 1})
+	require.NoError(t, service.ReplayDeadLetter(ctx, id))
+	require.Len(t, producer.sent, 1)
+	assert.Equal(t, int64(10), producer.sent[0].ID)
+	assert.Equal(t, DeadLetterReplayed, repo.deadLetters[id].Status)
+
+	assert.ErrorIs(t, service.ReplayDeadLetter(ctx, id), ErrDeadLetterHandled)
+	assert.ErrorIs(t, service.DiscardDeadLetter(ctx, id), ErrDeadLetterHandled)
+	assert.ErrorIs(t, service.ReplayDeadLetter(ctx, 99), ErrDeadLetterNotFound)
+
+	// 无法解析的消息不能重放，只能丢弃
+	poison := &DeadLetter{Payload: "{invalid", Status: DeadLetterPending}
+	require.NoError(t, repo.SaveDeadLetter(ctx, poison))
+	assert.ErrorIs(t, service.ReplayDeadLetter(ctx, poison.ID), ErrDeadLetterInvalid)
+	require.NoError(t, service.DiscardDeadLetter(ctx, poison.ID))
+	assert.Equal(t, DeadLetterDiscarded, repo.deadLetters[poison.ID].Status)
+}
+
+// 测试丢弃死信：订单未落库时回滚 Redis 扣减，已落库时不回滚
+func TestService_DiscardDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	service := NewService(repo, cache, &TestMQProducer{}, &TestIDGenerator{}, &TestLocker{}, &config.SeckillConfig{})
+	cache.stocks[1] = 9
+	cache.bought[1] = 1
+
+	id := newOrderDeadLetter(t, repo, cache, &Order{ID: 10, UserID: 1001, CouponID: 1})
+	require.NoError(t, service.DiscardDeadLetter(ctx, id))
+	assert.Equal(t, DeadLetterDiscarded, repo.deadLetters[id].Status)
+	assert.Equal(t, int64(10), cache.stocks[1])
+	assert.Equal(t, int64(0), cache.bought[1])
+	assert.Empty(t, cache.processing)
+
+	repo.stocks[1] = 10
+	persisted := &Order{ID: 11, UserID: 1002, CouponID: 1}
+	require.NoError(t, repo.CreateOrderWithStock(ctx, persisted))
+	id = newOrderDeadLetter(t, repo, cache, persisted)
+	require.NoError(t, service.DiscardDeadLetter(ctx, id))
+	assert.Equal(t, int64(10), cache.stocks[1])
+}
+
+// 测试死信分页查询和状态过滤
+func TestService_ListDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	service := NewService(repo, NewTestOrderCache(), &TestMQProducer{}, &TestIDGenerator{}, &TestLocker{}, &config.SeckillConfig{})
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, repo.SaveDeadLetter(ctx, &DeadLetter{Status: DeadLetterPending}))
+	}
+	require.NoError(t, repo.UpdateDeadLetterStatus(ctx, 1, DeadLetterPending, DeadLetterDiscarded))
+
+	resp, err := service.ListDeadLetters(ctx, &ListDeadLettersRequest{PageSize: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), resp.Total)
+	require.Len(t, resp.DeadLetters, 1)
+	assert.Equal(t, int64(3), resp.DeadLetters[0].ID)
+
+	pending := DeadLetterPending
+	resp, err = service.ListDeadLetters(ctx, &ListDeadLettersRequest{Status: &pending})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), resp.Total)
+	assert.Equal(t, 20, resp.PageSize)
+}
@@ -0,0 +1,174 @@
+package seckill
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rag-agent/config"
+	"rag-agent/internal/infrastructure/mq"
+	"rag-agent/pkg/tracing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 通过进程内消息队列组装完整秒杀链路：Service → MemoryBroker → OrderConsumer
+func newTestFlow(t *testing.T, repo *TestRepository, cache *TestOrderCache) (*Service, *mq.MemoryBroker) {
+	cfg := &config.SeckillConfig{OrderTimeout: time.Minute, MaxReconsume: 100}
+	broker := mq.NewMemoryBroker(mq.MemoryConfig{RetryDelay: 10 * time.Millisecond})
+
+	orderConsumer := NewOrderConsumer(repo, cache, cfg)
+	c, err := broker.NewConsumer(mq.ConsumerConfig{GroupName: "seckill_group", Topic: "seckill_order", Tag: OrderMessageTag}, orderConsumer.HandleMessage)
+	require.NoError(t, err)
+	require.NoError(t, c.Start())
+	t.Cleanup(func() { c.Shutdown() })
+
+	producer := NewOrderMQProducer(broker, "seckill_order")
+	return NewService(repo, cache, producer, &TestIDGenerator{}, &TestLocker{}, cfg), broker
+}
+
+// 测试秒杀成功后订单异步落库，落库后可以支付
+func TestSeckillFlow_MemoryBroker(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	repo.stocks[1] = 2
+	cache.stocks[1] = 2
+	service, _ := newTestFlow(t, repo, cache)
+
+	var orderIDs []int64
+	for userID := int64(1001); userID <= 1003; userID++ {
+		resp, err := service.Seckill(ctx, &SeckillRequest{UserID: userID, CouponID: 1})
+		if userID == 1003 {
+			assert.ErrorIs(t, err, ErrStockNotEnough)
+			continue
+		}
+		require.NoError(t, err)
+		orderIDs = append(orderIDs, resp.OrderID)
+	}
+
+	for _, orderID := range orderIDs {
+		assert.Eventually(t, func() bool {
+			order, err := service.GetOrder(ctx, orderID)
+			return err == nil && order.State == OrderStatePending
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	require.NoError(t, service.PayOrder(ctx, orderIDs[0]))
+	order, err := service.GetOrder(ctx, orderIDs[0])
+	require.NoError(t, err)
+	assert.Equal(t, OrderStatePaid, order.State)
+
+	repo.mu.Lock()
+	assert.Equal(t, int64(0), repo.stocks[1])
+	repo.mu.Unlock()
+	cache.mu.Lock()
+	assert.Empty(t, cache.processing)
+	cache.mu.Unlock()
+}
+
+// 测试订单落库失败时消息重新投递，恢复后订单落库
+func TestSeckillFlow_Retry(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	cache.stocks[1] = 1
+	service, broker := newTestFlow(t, repo, cache)
+
+	// MySQL 库存未初始化，消费失败
+	resp, err := service.Seckill(ctx, &SeckillRequest{UserID: 1001, CouponID: 1})
+	require.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	order, err := service.GetOrder(ctx, resp.OrderID)
+	require.NoError(t, err)
+	assert.Equal(t, OrderStateProcessing, order.State)
+
+	repo.mu.Lock()
+	repo.stocks[1] = 1
+	repo.mu.Unlock()
+
+	assert.Eventually(t, func() bool {
+		order, err := service.GetOrder(ctx, resp.OrderID)
+		return err == nil && order.State == OrderStatePending
+	}, time.Second, 10*time.Millisecond)
+	assert.Empty(t, broker.DeadLetters("seckill_group"))
+}
+
+// 测试订单消息的顺序、批量和异步发送都由订单消费者落库
+func TestOrderMQProducer_SendModes(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	repo.stocks[1] = 4
+	_, broker := newTestFlow(t, repo, cache)
+	producer := NewOrderMQProducer(broker, "seckill_order")
+
+	require.NoError(t, producer.SendOrderMessageOrderly(ctx, &Order{ID: 1, UserID: 1001, CouponID: 1}))
+	require.NoError(t, producer.SendOrderMessages(ctx, []*Order{
+		{ID: 2, UserID: 1002, CouponID: 1},
+		{ID: 3, UserID: 1003, CouponID: 1},
+	}))
+	done := make(chan error, 1)
+	require.NoError(t, producer.SendOrderMessageAsync(ctx, &Order{ID: 4, UserID: 1004, CouponID: 1}, func(err error) { done <- err }))
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("未回调发送结果")
+	}
+
+	assert.Eventually(t, func() bool {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		return len(repo.orders) == 4
+	}, time.Second, 10*time.Millisecond)
+}
+
+// syncBuffer 并发安全的日志缓冲区
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// 测试秒杀请求的请求ID随订单消息传递，消费日志带有该请求ID
+func TestSeckillFlow_RequestID(t *testing.T) {
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	ctx := tracing.EnsureTrace(tracing.WithRequestID(context.Background(), "req-1"))
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	repo.stocks[1] = 1
+	cache.stocks[1] = 1
+	service, _ := newTestFlow(t, repo, cache)
+
+	resp, err := service.Seckill(ctx, &SeckillRequest{UserID: 1001, CouponID: 1})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return strings.Contains(logs.String(), "[request_id=req-1] 订单处理成功")
+	}, time.Second, 10*time.Millisecond)
+	assert.Contains(t, logs.String(), "[request_id=req-1] 收到订单消息")
+	_, err = service.GetOrder(context.Background(), resp.OrderID)
+	assert.NoError(t, err)
+}
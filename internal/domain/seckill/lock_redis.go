@@ -0,0 +1,52 @@
+package seckill
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	redisinfra "rag-agent/internal/infrastructure/redis"
+)
+
+// RedisLocker 分布式锁（domain 层适配器）
+type RedisLocker struct {
+	locker *redisinfra.Locker
+	wait   time.Duration
+}
+
+// NewRedisLocker 创建分布式锁适配器
+// wait 为锁被占用时的最长等待时间，0 表示只尝试一次
+func NewRedisLocker(locker *redisinfra.Locker, wait time.Duration) Locker {
+	return &RedisLocker{
+		locker: locker,
+		wait:   wait,
+	}
+}
+
+// Lock 获取锁，锁已被占用时返回 ErrLockFailed
+func (l *RedisLocker) Lock(ctx context.Context, name string) (func(), error) {
+	var lock *redisinfra.Lock
+	var err error
+	if l.wait > 0 {
+		waitCtx, cancel := context.WithTimeout(ctx, l.wait)
+		lock, err = l.locker.Lock(waitCtx, name)
+		cancel()
+	} else {
+		lock, err = l.locker.TryLock(ctx, name)
+	}
+
+	if errors.Is(err, redisinfra.ErrNotObtained) {
+		return nil, ErrLockFailed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := func() {
+		if err := lock.Unlock(context.Background()); err != nil {
+			log.Printf("释放锁失败: %v, key=%s", err, lock.Key())
+		}
+	}
+	return unlock, nil
+}
@@ -1,52 +1,255 @@
 package seckill
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 // Coupon 优惠券模型
 type Coupon struct {
-	ID          int64     `json:"id" db:"id"`
-	Name        string    `json:"name" db:"name"`
-	Description string    `json:"description" db:"description"`
-	TotalStock  int64     `json:"total_stock" db:"total_stock"`
-	RemainStock int64     `json:"remain_stock" db:"remain_stock"`
-	StartTime   time.Time `json:"start_time" db:"start_time"`
-	EndTime     time.Time `json:"end_time" db:"end_time"`
-	Status      int       `json:"status" db:"status"` // 0-未开始, 1-进行中, 2-已结束
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID           int64     `json:"id" db:"id"`
+	Name         string    `json:"name" db:"name"`
+	Description  string    `json:"description" db:"description"`
+	TotalStock   int64     `json:"total_stock" db:"total_stock"`
+	RemainStock  int64     `json:"remain_stock" db:"remain_stock"`
+	StockBuckets int       `json:"stock_buckets" db:"stock_buckets"` // Redis 库存分桶数，1 表示不分桶
+	StartTime    time.Time `json:"start_time" db:"start_time"`
+	EndTime      time.Time `json:"end_time" db:"end_time"`
+	Status       int       `json:"status" db:"status"` // 0-未开始, 1-进行中, 2-已结束
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
 
 // Order 订单模型
+// 订单 ID 是 Snowflake ID，超出 JS 安全整数范围，在 MQ 消息、处理中标记和死信中与接口响应一样以字符串序列化
 type Order struct {
-	ID        int64     `json:"id" db:"id"`
+	ID        int64     `json:"id,string" db:"id"`
 	UserID    int64     `json:"user_id" db:"user_id"`
 	CouponID  int64     `json:"coupon_id" db:"coupon_id"`
-	Status    int       `json:"status" db:"status"` // 0-待支付, 1-已支付, 2-已取消
+	Status    int       `json:"status" db:"status"` // 0-待支付, 1-已支付, 2-已取消, 3-已退款
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// UnmarshalJSON 兼容旧版本以数字序列化订单 ID 的消息、处理中标记和死信
+func (o *Order) UnmarshalJSON(data []byte) error {
+	type order Order
+	aux := struct {
+		ID json.Number `json:"id"`
+		*order
+	}{order: (*order)(o)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.ID == "" {
+		return nil
+	}
+	id, err := aux.ID.Int64()
+	if err != nil {
+		return fmt.Errorf("解析订单ID失败: %w", err)
+	}
+	o.ID = id
+	return nil
+}
+
+// OrderTransition 订单状态变更
+type OrderTransition struct {
+	OrderID int64
+	From    int    // 期望的当前状态（WHERE status = From）
+	To      int    // 目标状态
+	Reason  string // 变更原因
+	Actor   string // 操作人
+}
+
+// OrderStatusLog 订单状态变更日志
+type OrderStatusLog struct {
+	ID         int64     `json:"id" db:"id"`
+	OrderID    int64     `json:"order_id,string" db:"order_id"`
+	FromStatus int       `json:"from_status" db:"from_status"`
+	ToStatus   int       `json:"to_status" db:"to_status"`
+	Reason     string    `json:"reason" db:"reason"`
+	Actor      string    `json:"actor" db:"actor"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// RefundOrderRequest 退款请求
+type RefundOrderRequest struct {
+	Reason   string `json:"reason" binding:"required"`
+	Operator string `json:"operator"` // 操作人，为空时记录为 admin
+}
+
 // SeckillRequest 秒杀请求
 type SeckillRequest struct {
-	UserID   int64 `json:"user_id" binding:"required"`
-	CouponID int64 `json:"coupon_id" binding:"required"`
+	UserID   int64  `json:"user_id" binding:"required"`
+	CouponID int64  `json:"coupon_id" binding:"required"`
+	Token    string `json:"token"` // 秒杀令牌，开启令牌校验时必填
+}
+
+// SeckillToken 秒杀令牌（一次性，与用户和优惠券绑定）
+type SeckillToken struct {
+	Token    string    `json:"token"`
+	ExpireAt time.Time `json:"expire_at"`
 }
 
 // SeckillResponse 秒杀响应
 type SeckillResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
-	OrderID int64  `json:"order_id,omitempty"`
+	OrderID int64  `json:"order_id,string,omitempty"` // Snowflake ID 超出 JS 安全整数范围，以字符串返回
+}
+
+// OrderResponse 订单查询响应
+type OrderResponse struct {
+	OrderID   int64     `json:"order_id,string"`
+	UserID    int64     `json:"user_id"`
+	CouponID  int64     `json:"coupon_id"`
+	Status    int       `json:"status"`
+	State     string    `json:"state"` // processing-处理中, pending-待支付, paid-已支付, cancelled-已取消, refunded-已退款
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// QueueStatus 排队状态
+type QueueStatus struct {
+	CouponID      int64      `json:"coupon_id"`
+	UserID        int64      `json:"user_id"`
+	Ticket        int64      `json:"ticket,omitempty"`         // 排队号（按到达顺序递增），仅加入排队时返回
+	Position      int64      `json:"position"`                 // 当前排名（从 1 开始），已放行时为 0
+	Admitted      bool       `json:"admitted"`                 // 是否已放行，放行后可发起秒杀
+	AdmittedUntil *time.Time `json:"admitted_until,omitempty"` // 放行截止时间，过期需重新排队
+	EstimatedWait int64      `json:"estimated_wait"`           // 预计等待秒数
+}
+
+// StockReport 库存对账结果（Drift = 实际库存 - 应有库存，0 表示一致）
+type StockReport struct {
+	CouponID        int64  `json:"coupon_id"`
+	TotalStock      int64  `json:"total_stock"`
+	RedisStock      int64  `json:"redis_stock"`
+	MySQLStock      int64  `json:"mysql_stock"`
+	ActiveOrders    int64  `json:"active_orders"`    // 待支付 + 已支付订单数
+	CancelledOrders int64  `json:"cancelled_orders"` // 已取消订单数
+	InFlight        int64  `json:"in_flight"`        // Redis 已扣减但尚未落库的订单数
+	MySQLDrift      int64  `json:"mysql_drift"`
+	RedisDrift      int64  `json:"redis_drift"`
+	Repaired        bool   `json:"repaired"`
+	Error           string `json:"error,omitempty"`
+}
+
+// CreateCouponRequest 创建优惠券请求
+type CreateCouponRequest struct {
+	Name         string    `json:"name" binding:"required"`
+	Description  string    `json:"description"`
+	TotalStock   int64     `json:"total_stock" binding:"required,gt=0"`
+	StockBuckets int       `json:"stock_buckets"` // 为 0 时不分桶
+	StartTime    time.Time `json:"start_time" binding:"required"`
+	EndTime      time.Time `json:"end_time" binding:"required"`
+	Status       int       `json:"status"`
+}
+
+// UpdateCouponRequest 更新优惠券请求（字段为 nil 表示不修改）
+type UpdateCouponRequest struct {
+	Name         *string    `json:"name"`
+	Description  *string    `json:"description"`
+	TotalStock   *int64     `json:"total_stock"`
+	StockBuckets *int       `json:"stock_buckets"`
+	StartTime    *time.Time `json:"start_time"`
+	EndTime      *time.Time `json:"end_time"`
+	Status       *int       `json:"status"`
+}
+
+// ListCouponsRequest 优惠券列表查询请求
+type ListCouponsRequest struct {
+	Status   *int `form:"status"`
+	Page     int  `form:"page"`
+	PageSize int  `form:"page_size"`
+}
+
+// CouponListResponse 优惠券列表响应
+type CouponListResponse struct {
+	Coupons  []*Coupon `json:"coupons"`
+	Total    int64     `json:"total"`
+	Page     int       `json:"page"`
+	PageSize int       `json:"page_size"`
 }
 
 // CompensationTask 补偿任务模型（用于MQ发送失败后的补偿处理）
 type CompensationTask struct {
-	ID         int64     `json:"id" db:"id"`
-	UserID     int64     `json:"user_id" db:"user_id"`
-	CouponID   int64     `json:"coupon_id" db:"coupon_id"`
-	OrderID    int64     `json:"order_id" db:"order_id"`
-	Status     int       `json:"status" db:"status"`         // 0-待处理, 1-处理中, 2-已完成, -1-失败
-	RetryCount int       `json:"retry_count" db:"retry_count"` // 重试次数
-	CreatedAt  time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+	ID             int64     `json:"id" db:"id"`
+	UserID         int64     `json:"user_id" db:"user_id"`
+	CouponID       int64     `json:"coupon_id" db:"coupon_id"`
+	OrderID        int64     `json:"order_id,string" db:"order_id"`
+	OrderCreatedAt time.Time `json:"order_created_at" db:"order_created_at"` // 下单时间，重新投递时作为订单创建时间
+	Status         int       `json:"status" db:"status"`                     // 0-待处理, 1-处理中, 2-已完成, -1-失败
+	RetryCount     int       `json:"retry_count" db:"retry_count"`           // 重试次数
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// DeadLetter 死信消息：无法解析或超过最大重新消费次数的消息，保存原始消息体和失败原因，供人工重放或丢弃
+type DeadLetter struct {
+	ID             int64     `json:"id" db:"id"`
+	MsgID          string    `json:"msg_id" db:"msg_id"`
+	Topic          string    `json:"topic" db:"topic"`
+	Tag            string    `json:"tag" db:"tag"`
+	Keys           string    `json:"keys" db:"msg_keys"`                   // 多个 Key 以空格分隔
+	Payload        string    `json:"payload" db:"payload"`                 // 原始消息体
+	Error          string    `json:"error" db:"error"`                     // 最后一次消费失败的原因
+	ReconsumeTimes int       `json:"reconsume_times" db:"reconsume_times"` // 进入死信时已重新消费的次数
+	Status         int       `json:"status" db:"status"`                   // 0-待处理, 1-已重放, 2-已丢弃
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
 }
+
+// ListDeadLettersRequest 死信列表查询参数
+type ListDeadLettersRequest struct {
+	Status   *int `form:"status"`
+	Page     int  `form:"page"`
+	PageSize int  `form:"page_size"`
+}
+
+// DeadLetterListResponse 死信列表响应
+type DeadLetterListResponse struct {
+	DeadLetters []*DeadLetter `json:"dead_letters"`
+	Total       int64         `json:"total"`
+	Page        int           `json:"page"`
+	PageSize    int           `json:"page_size"`
+}
+
+// 订单状态
+const (
+	OrderPending   = 0 // 待支付
+	OrderPaid      = 1 // 已支付
+	OrderCancelled = 2 // 已取消
+	OrderRefunded  = 3 // 已退款
+)
+
+// 订单查询状态（State）
+const (
+	OrderStateProcessing = "processing" // 订单消息仍在 MQ 中，尚未落库
+	OrderStatePending    = "pending"    // 待支付
+	OrderStatePaid       = "paid"       // 已支付
+	OrderStateCancelled  = "cancelled"  // 已取消
+	OrderStateRefunded   = "refunded"   // 已退款
+)
+
+// 优惠券状态
+const (
+	CouponNotStarted = 0 // 未开始
+	CouponActive     = 1 // 进行中
+	CouponEnded      = 2 // 已结束
+)
+
+// 死信状态
+const (
+	DeadLetterPending   = 0 // 待处理
+	DeadLetterReplayed  = 1 // 已重放
+	DeadLetterDiscarded = 2 // 已丢弃
+)
+
+// 补偿任务状态
+const (
+	CompensationPending    = 0  // 待处理
+	CompensationProcessing = 1  // 处理中
+	CompensationDone       = 2  // 已完成
+	CompensationFailed     = -1 // 失败
+)
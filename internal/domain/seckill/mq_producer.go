@@ -4,18 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 
 	"rag-agent/internal/infrastructure/mq"
 )
 
+// OrderMessageTag 订单消息 Tag，消费者按该 Tag 订阅
+const OrderMessageTag = "seckill_order"
+
 // OrderMQProducer 订单消息生产者（domain 层适配器）
 type OrderMQProducer struct {
-	producer *mq.Producer
+	producer mq.Producer
 	topic    string
 }
 
 // NewOrderMQProducer 创建订单消息生产者
-func NewOrderMQProducer(producer *mq.Producer, topic string) MQProducer {
+func NewOrderMQProducer(producer mq.Producer, topic string) MQProducer {
 	return &OrderMQProducer{
 		producer: producer,
 		topic:    topic,
@@ -31,11 +35,110 @@ func (p *OrderMQProducer) SendOrderMessage(ctx context.Context, order *Order) er
 	}
 
 	// 发送消息
-	key := fmt.Sprintf("order_%d", order.ID)
-	err = p.producer.SendMessage(ctx, p.topic, "seckill_order", orderData, key)
+	err = p.producer.SendMessage(ctx, p.topic, OrderMessageTag, orderData, orderMessageKey(order.ID))
 	if err != nil {
 		return fmt.Errorf("发送订单消息失败: %w", err)
 	}
 
 	return nil
 }
+
+// SendOrderMessageOrderly 以优惠券ID为分片键发送订单消息
+// 热门优惠券的消息会集中到同一队列，秒杀下单仍使用 SendOrderMessage
+func (p *OrderMQProducer) SendOrderMessageOrderly(ctx context.Context, order *Order) error {
+	orderData, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("序列化订单失败: %w", err)
+	}
+
+	shardingKey := strconv.FormatInt(order.CouponID, 10)
+	err = p.producer.SendOrderly(ctx, p.topic, OrderMessageTag, shardingKey, orderData, orderMessageKey(order.ID))
+	if err != nil {
+		return fmt.Errorf("发送订单顺序消息失败: %w", err)
+	}
+
+	return nil
+}
+
+// SendOrderMessages 批量发送订单消息
+func (p *OrderMQProducer) SendOrderMessages(ctx context.Context, orders []*Order) error {
+	msgs := make([]*mq.Message, 0, len(orders))
+	for _, order := range orders {
+		orderData, err := json.Marshal(order)
+		if err != nil {
+			return fmt.Errorf("序列化订单失败: %w", err)
+		}
+		msgs = append(msgs, &mq.Message{
+			Topic: p.topic,
+			Tag:   OrderMessageTag,
+			Keys:  []string{orderMessageKey(order.ID)},
+			Body:  orderData,
+		})
+	}
+
+	if err := p.producer.SendBatch(ctx, msgs); err != nil {
+		return fmt.Errorf("批量发送订单消息失败: %w", err)
+	}
+
+	return nil
+}
+
+// SendOrderMessageAsync 异步发送订单消息
+func (p *OrderMQProducer) SendOrderMessageAsync(ctx context.Context, order *Order, callback func(err error)) error {
+	orderData, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("序列化订单失败: %w", err)
+	}
+
+	err = p.producer.SendAsync(ctx, p.topic, OrderMessageTag, orderData, func(err error) {
+		if err != nil {
+			err = fmt.Errorf("发送订单消息失败: %w", err)
+		}
+		callback(err)
+	}, orderMessageKey(order.ID))
+	if err != nil {
+		return fmt.Errorf("发送订单消息失败: %w", err)
+	}
+
+	return nil
+}
+
+// TransactionalOrderMQProducer 支持事务消息的订单消息生产者
+type TransactionalOrderMQProducer struct {
+	*OrderMQProducer
+	txProducer mq.TransactionProducer
+}
+
+// NewTransactionalOrderMQProducer 创建支持事务消息的订单消息生产者
+// producer 用于普通消息（死信重放等），txProducer 用于秒杀下单的事务消息
+func NewTransactionalOrderMQProducer(producer mq.Producer, txProducer mq.TransactionProducer, topic string) TransactionalMQProducer {
+	return &TransactionalOrderMQProducer{
+		OrderMQProducer: &OrderMQProducer{
+			producer: producer,
+			topic:    topic,
+		},
+		txProducer: txProducer,
+	}
+}
+
+// SendOrderMessageInTransaction 发送订单事务消息，execute 为本地事务
+func (p *TransactionalOrderMQProducer) SendOrderMessageInTransaction(ctx context.Context, order *Order, execute func(ctx context.Context) mq.TransactionState) (mq.TransactionState, error) {
+	orderData, err := json.Marshal(order)
+	if err != nil {
+		return mq.TransactionRollback, fmt.Errorf("序列化订单失败: %w", err)
+	}
+
+	state, err := p.txProducer.SendMessageInTransaction(ctx, p.topic, OrderMessageTag, orderData,
+		func(ctx context.Context, _ *mq.Message) mq.TransactionState { return execute(ctx) },
+		orderMessageKey(order.ID))
+	if err != nil {
+		return state, fmt.Errorf("发送订单事务消息失败: %w", err)
+	}
+
+	return state, nil
+}
+
+// orderMessageKey 订单消息的 Key，用于按订单查询消息
+func orderMessageKey(orderID int64) string {
+	return fmt.Sprintf("order_%d", orderID)
+}
@@ -3,64 +3,180 @@ package seckill
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
 
-	"github.com/apache/rocketmq-client-go/v2/consumer"
-	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"rag-agent/config"
+	"rag-agent/internal/infrastructure/mq"
+	"rag-agent/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultMaxReconsume   = 5    // 未配置 max_reconsume 时订单消息的最大重新消费次数
+	maxDeadLetterErrorLen = 1024 // 死信失败原因的最大长度（字符），与 dead_letters.error 列一致
 )
 
+// consumeOutcome 单条订单消息的消费结果
+type consumeOutcome int
+
+const (
+	outcomeSucceeded  consumeOutcome = iota // 订单落库成功
+	outcomeDuplicate                        // 订单已存在，重复消息
+	outcomeRetry                            // 处理失败，稍后重新投递
+	outcomeDeadLetter                       // 无法解析或超过最大重新消费次数，转入死信表
+)
+
+// OrderConsumerStats 订单消息消费结果统计
+type OrderConsumerStats struct {
+	Succeeded    int64 `json:"succeeded"`
+	Duplicated   int64 `json:"duplicated"`
+	Retried      int64 `json:"retried"`
+	DeadLettered int64 `json:"dead_lettered"`
+}
+
 // OrderConsumer 订单消费者服务（业务逻辑层）
 type OrderConsumer struct {
-	repo Repository
+	repo  Repository
+	cache CacheRepository
+	cfg   *config.SeckillConfig
+
+	outcomes [outcomeDeadLetter + 1]atomic.Int64
 }
 
 // NewOrderConsumer 创建订单消费者
-func NewOrderConsumer(repo Repository) *OrderConsumer {
+func NewOrderConsumer(repo Repository, cache CacheRepository, cfg *config.SeckillConfig) *OrderConsumer {
 	return &OrderConsumer{
-		repo: repo,
+		repo:  repo,
+		cache: cache,
+		cfg:   cfg,
 	}
 }
 
-// HandleMessage 处理订单消息（业务逻辑）
-func (c *OrderConsumer) HandleMessage(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
-	for _, msg := range msgs {
-		// 解析订单消息
-		var order Order
-		if err := json.Unmarshal(msg.Body, &order); err != nil {
-			log.Printf("解析订单消息失败: %v, msgID: %s", err, msg.MsgId)
-			// 解析失败，直接返回成功，避免重复消费
-			continue
-		}
+// HandleMessage 处理订单消息（业务逻辑），返回错误时消息稍后重新投递
+// 无法解析的消息和超过最大重新消费次数的消息转入死信表后确认，不再阻塞消费
+// 从消息属性恢复秒杀请求的 trace context 和请求ID，消费日志和 span 关联到原始请求
+func (c *OrderConsumer) HandleMessage(ctx context.Context, msg *mq.Message) error {
+	ctx = tracing.Extract(ctx, propagation.MapCarrier(msg.Properties))
+	ctx, span := tracing.Tracer().Start(ctx, "seckill.order.consume",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("request_id", tracing.RequestID(ctx)),
+			attribute.String("messaging.message.id", msg.ID),
+			attribute.Int("messaging.reconsume_times", int(msg.ReconsumeTimes)),
+		))
+	defer span.End()
 
-		log.Printf("收到订单消息: userID=%d, couponID=%d, orderID=%d", order.UserID, order.CouponID, order.ID)
+	outcome, err := c.consume(ctx, msg)
+	c.outcomes[outcome].Add(1)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
 
-		// 处理订单：扣减 MySQL 库存 + 创建订单记录
-		if err := c.processOrder(ctx, &order); err != nil {
-			log.Printf("处理订单失败: %v, 将重试", err)
-			// 返回失败，RocketMQ 会自动重试
-			return consumer.ConsumeRetryLater, err
+// Stats 返回消费结果统计
+func (c *OrderConsumer) Stats() OrderConsumerStats {
+	return OrderConsumerStats{
+		Succeeded:    c.outcomes[outcomeSucceeded].Load(),
+		Duplicated:   c.outcomes[outcomeDuplicate].Load(),
+		Retried:      c.outcomes[outcomeRetry].Load(),
+		DeadLettered: c.outcomes[outcomeDeadLetter].Load(),
+	}
+}
+
+// consume 处理单条订单消息并返回消费结果
+func (c *OrderConsumer) consume(ctx context.Context, msg *mq.Message) (consumeOutcome, error) {
+	// 解析订单消息，无法解析的消息重试也不会成功，直接转入死信表
+	var order Order
+	if err := json.Unmarshal(msg.Body, &order); err != nil {
+		tracing.Logf(ctx, "解析订单消息失败: %v, msgID: %s", err, msg.ID)
+		return c.quarantine(ctx, msg, fmt.Errorf("解析订单消息失败: %w", err))
+	}
+
+	tracing.Logf(ctx, "收到订单消息: userID=%d, couponID=%d, orderID=%d, reconsumeTimes=%d",
+		order.UserID, order.CouponID, order.ID, msg.ReconsumeTimes)
+
+	// 处理订单：事务内扣减 MySQL 库存 + 创建订单记录
+	outcome := outcomeSucceeded
+	err := c.repo.CreateOrderWithStock(ctx, &order)
+	switch {
+	case errors.Is(err, ErrOrderExists):
+		// 订单已存在说明消息已被处理过（消息重投），直接视为成功，避免重复扣减库存
+		tracing.Logf(ctx, "订单已存在，跳过重复消息: userID=%d, couponID=%d", order.UserID, order.CouponID)
+		outcome = outcomeDuplicate
+	case err != nil:
+		if int(msg.ReconsumeTimes) >= c.maxReconsume() {
+			tracing.Logf(ctx, "处理订单失败且超过最大重新消费次数: %v, orderID=%d", err, order.ID)
+			return c.quarantine(ctx, msg, err)
 		}
+		tracing.Logf(ctx, "处理订单失败: %v, orderID=%d, 将重试", err, order.ID)
+		return outcomeRetry, err
+	}
 
-		log.Printf("订单处理成功: orderID=%d", order.ID)
+	// 订单已落库，清除处理中标记并登记支付超时
+	if err := c.cache.ClearOrderProcessing(ctx, &order); err != nil {
+		tracing.Logf(ctx, "清除订单处理中标记失败: %v, orderID=%d", err, order.ID)
+	}
+	if c.cfg.OrderTimeout > 0 {
+		// 支付期限从下单时间起算，消息延迟或重投不会延长期限
+		createdAt := order.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+		if err := c.cache.ScheduleOrderTimeout(ctx, order.ID, createdAt.Add(c.cfg.OrderTimeout)); err != nil {
+			// 未登记的订单永远不会超时取消，返回错误让消息重投；重投时订单已存在，只补登记超时
+			tracing.Logf(ctx, "登记订单支付超时失败: %v, orderID=%d, 将重试", err, order.ID)
+			return outcomeRetry, err
+		}
 	}
 
-	return consumer.ConsumeSuccess, nil
+	tracing.Logf(ctx, "订单处理成功: orderID=%d", order.ID)
+	return outcome, nil
 }
 
-// processOrder 处理订单：扣减 MySQL 库存 + 创建订单记录
-func (c *OrderConsumer) processOrder(ctx context.Context, order *Order) error {
-	// 1. 扣减 MySQL 库存
-	if err := c.repo.DecrStock(ctx, order.CouponID); err != nil {
-		log.Printf("扣减 MySQL 库存失败: %v", err)
-		return err
+// quarantine 将消息转入死信表；保存失败时返回错误，消息稍后重新投递，不会丢失
+// 订单的 Redis 扣减和处理中标记保留，由管理员重放或丢弃时处理
+func (c *OrderConsumer) quarantine(ctx context.Context, msg *mq.Message, cause error) (consumeOutcome, error) {
+	dl := &DeadLetter{
+		MsgID:          msg.ID,
+		Topic:          msg.Topic,
+		Tag:            msg.Tag,
+		Keys:           strings.Join(msg.Keys, " "),
+		Payload:        string(msg.Body),
+		Error:          truncateRunes(cause.Error(), maxDeadLetterErrorLen),
+		ReconsumeTimes: int(msg.ReconsumeTimes),
+		Status:         DeadLetterPending,
+	}
+	if err := c.repo.SaveDeadLetter(ctx, dl); err != nil {
+		tracing.Logf(ctx, "保存死信失败: %v, msgID=%s, 将重试", err, msg.ID)
+		return outcomeRetry, err
 	}
 
-	// 2. 创建订单记录
-	if err := c.repo.CreateOrder(ctx, order); err != nil {
-		log.Printf("创建订单失败: %v", err)
-		// TODO: 这里需要回滚 MySQL 库存，或者通过补偿机制处理
-		return err
+	tracing.Logf(ctx, "订单消息转入死信: deadLetterID=%d, msgID=%s, err=%v", dl.ID, msg.ID, cause)
+	return outcomeDeadLetter, nil
+}
+
+func (c *OrderConsumer) maxReconsume() int {
+	if c.cfg.MaxReconsume > 0 {
+		return c.cfg.MaxReconsume
 	}
+	return defaultMaxReconsume
+}
 
-	return nil
+// truncateRunes 截断字符串到最多 n 个字符
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
 }
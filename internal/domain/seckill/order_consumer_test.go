@@ -0,0 +1,162 @@
+package seckill
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"rag-agent/config"
+	"rag-agent/internal/infrastructure/mq"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 构造订单消息
+func newOrderMessage(t *testing.T, order *Order) *mq.Message {
+	body, err := json.Marshal(order)
+	require.NoError(t, err)
+	return &mq.Message{Body: body}
+}
+
+// 测试订单 ID 以字符串序列化，并兼容旧版本的数字格式
+func TestOrder_JSONID(t *testing.T) {
+	const id = int64(1)<<62 + 1 // 超出 JS 安全整数范围
+	body, err := json.Marshal(&Order{ID: id, UserID: 1001, CouponID: 1})
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"id":"4611686018427387905"`)
+
+	var order Order
+	require.NoError(t, json.Unmarshal(body, &order))
+	assert.Equal(t, id, order.ID)
+	assert.Equal(t, int64(1001), order.UserID)
+
+	var legacy Order
+	require.NoError(t, json.Unmarshal([]byte(`{"id":4611686018427387905,"user_id":1001}`), &legacy))
+	assert.Equal(t, id, legacy.ID)
+
+	task, err := json.Marshal(&CompensationTask{OrderID: id})
+	require.NoError(t, err)
+	assert.Contains(t, string(task), `"order_id":"4611686018427387905"`)
+}
+
+// 测试订单消息处理成功
+func TestOrderConsumer_HandleMessage(t *testing.T) {
+	repo := NewTestRepository()
+	repo.stocks[1] = 10
+	cache := NewTestOrderCache()
+	c := NewOrderConsumer(repo, cache, &config.SeckillConfig{OrderTimeout: time.Minute})
+
+	createdAt := time.Now().Add(-10 * time.Second).Truncate(time.Millisecond)
+	order := &Order{ID: 1, UserID: 1001, CouponID: 1, CreatedAt: createdAt}
+	require.NoError(t, cache.SetOrderProcessing(context.Background(), order, time.Minute))
+
+	err := c.HandleMessage(context.Background(), newOrderMessage(t, order))
+
+	assert.NoError(t, err)
+	assert.Len(t, repo.orders, 1)
+	assert.Equal(t, int64(9), repo.stocks[1])
+
+	// 落库后处理中标记被清除，并按下单时间登记支付超时
+	assert.Empty(t, cache.processing)
+	assert.True(t, createdAt.Add(time.Minute).Equal(cache.timeouts[1]))
+}
+
+// 登记支付超时失败的缓存
+type failingTimeoutCache struct {
+	*TestOrderCache
+	fail bool
+}
+
+func (c *failingTimeoutCache) ScheduleOrderTimeout(ctx context.Context, orderID int64, deadline time.Time) error {
+	if c.fail {
+		return assert.AnError
+	}
+	return c.TestOrderCache.ScheduleOrderTimeout(ctx, orderID, deadline)
+}
+
+// 测试登记支付超时失败时返回错误，重投后补登记
+func TestOrderConsumer_ScheduleTimeoutFailed(t *testing.T) {
+	repo := NewTestRepository()
+	repo.stocks[1] = 10
+	cache := &failingTimeoutCache{TestOrderCache: NewTestOrderCache(), fail: true}
+	c := NewOrderConsumer(repo, cache, &config.SeckillConfig{OrderTimeout: time.Minute})
+
+	msg := newOrderMessage(t, &Order{ID: 1, UserID: 1001, CouponID: 1, CreatedAt: time.Now()})
+	assert.ErrorIs(t, c.HandleMessage(context.Background(), msg), assert.AnError)
+	assert.Len(t, repo.orders, 1)
+
+	cache.fail = false
+	require.NoError(t, c.HandleMessage(context.Background(), msg))
+	assert.Contains(t, cache.timeouts, int64(1))
+	assert.Equal(t, int64(9), repo.stocks[1])
+}
+
+// 测试重复投递的消息不会重复扣减库存
+func TestOrderConsumer_DuplicateMessage(t *testing.T) {
+	repo := NewTestRepository()
+	repo.stocks[1] = 10
+	c := NewOrderConsumer(repo, NewTestOrderCache(), &config.SeckillConfig{})
+
+	msg := newOrderMessage(t, &Order{ID: 1, UserID: 1001, CouponID: 1})
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, c.HandleMessage(context.Background(), msg))
+	}
+
+	assert.Len(t, repo.orders, 1)
+	assert.Equal(t, int64(9), repo.stocks[1])
+}
+
+// 测试 MySQL 库存不足时返回重试
+func TestOrderConsumer_StockNotEnough(t *testing.T) {
+	repo := NewTestRepository()
+	c := NewOrderConsumer(repo, NewTestOrderCache(), &config.SeckillConfig{})
+
+	err := c.HandleMessage(context.Background(), newOrderMessage(t, &Order{ID: 1, UserID: 1001, CouponID: 1}))
+
+	assert.ErrorIs(t, err, ErrStockNotEnough)
+	assert.Empty(t, repo.orders)
+}
+
+// 测试无法解析的消息直接转入死信表
+func TestOrderConsumer_PoisonMessage(t *testing.T) {
+	repo := NewTestRepository()
+	c := NewOrderConsumer(repo, NewTestOrderCache(), &config.SeckillConfig{})
+
+	msg := &mq.Message{ID: "msg-1", Topic: "seckill_order", Tag: OrderMessageTag, Keys: []string{"order_1"}, Body: []byte("{invalid")}
+	require.NoError(t, c.HandleMessage(context.Background(), msg))
+
+	require.Len(t, repo.deadLetters, 1)
+	dl := repo.deadLetters[1]
+	assert.Equal(t, "msg-1", dl.MsgID)
+	assert.Equal(t, "order_1", dl.Keys)
+	assert.Equal(t, "{invalid", dl.Payload)
+	assert.Contains(t, dl.Error, "解析订单消息失败")
+	assert.Equal(t, DeadLetterPending, dl.Status)
+	assert.Equal(t, OrderConsumerStats{DeadLettered: 1}, c.Stats())
+}
+
+// 测试超过最大重新消费次数后转入死信表，死信保存失败时继续重试
+func TestOrderConsumer_MaxReconsume(t *testing.T) {
+	repo := NewTestRepository()
+	c := NewOrderConsumer(repo, NewTestOrderCache(), &config.SeckillConfig{MaxReconsume: 2})
+	msg := newOrderMessage(t, &Order{ID: 1, UserID: 1001, CouponID: 1})
+
+	for msg.ReconsumeTimes = 0; msg.ReconsumeTimes < 2; msg.ReconsumeTimes++ {
+		assert.ErrorIs(t, c.HandleMessage(context.Background(), msg), ErrStockNotEnough)
+	}
+	assert.Empty(t, repo.deadLetters)
+
+	repo.failSaveDeadLetter = true
+	assert.Error(t, c.HandleMessage(context.Background(), msg))
+	assert.Empty(t, repo.deadLetters)
+
+	repo.failSaveDeadLetter = false
+	require.NoError(t, c.HandleMessage(context.Background(), msg))
+	require.Len(t, repo.deadLetters, 1)
+	assert.Equal(t, ErrStockNotEnough.Error(), repo.deadLetters[1].Error)
+	assert.Equal(t, 2, repo.deadLetters[1].ReconsumeTimes)
+
+	assert.Equal(t, OrderConsumerStats{Retried: 3, DeadLettered: 1}, c.Stats())
+}
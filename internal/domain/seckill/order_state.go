@@ -0,0 +1,91 @@
+package seckill
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// 订单状态变更操作人
+const (
+	OrderActorUser   = "user"   // 用户操作
+	OrderActorSystem = "system" // 系统自动处理（如支付超时）
+	OrderActorAdmin  = "admin"  // 管理员操作（未指定操作人时）
+)
+
+// orderTransitions 订单状态机：当前状态 → 允许变更到的状态
+//
+//	待支付 → 已支付 / 已取消
+//	已支付 → 已退款
+var orderTransitions = map[int][]int{
+	OrderPending: {OrderPaid, OrderCancelled},
+	OrderPaid:    {OrderRefunded},
+}
+
+// validateOrderTransition 校验状态变更是否被状态机允许
+func validateOrderTransition(from, to int) error {
+	for _, allowed := range orderTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d → %d", ErrOrderStatusInvalid, from, to)
+}
+
+// releasesStock 变更到该状态时是否归还库存
+func releasesStock(status int) bool {
+	return status == OrderCancelled || status == OrderRefunded
+}
+
+// RefundOrder 退款：已支付 → 已退款，MySQL 库存在状态变更事务中归还，这里归还 Redis 库存
+// 用户仍保留在已购集合中：uk_user_coupon 不允许同一用户对同一优惠券再下一单
+func (s *Service) RefundOrder(ctx context.Context, orderID int64, reason, actor string) error {
+	if actor == "" {
+		actor = OrderActorAdmin
+	}
+
+	order, err := s.repo.GetOrder(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	// 与库存对账互斥，避免对账读到已退款但 Redis 库存尚未归还的中间状态
+	unlock, err := s.locker.Lock(ctx, reconcileLockName(order.CouponID))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	order, err = s.repo.TransitionOrder(ctx, &OrderTransition{
+		OrderID: orderID,
+		From:    OrderPaid,
+		To:      OrderRefunded,
+		Reason:  reason,
+		Actor:   actor,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.cache.IncrStock(ctx, order.CouponID, 1); err != nil {
+		// Redis 库存差异由对账修复
+		log.Printf("退款归还 Redis 库存失败: %v, orderID=%d", err, orderID)
+	}
+	return nil
+}
+
+// GetOrderStatusLogs 查询订单状态变更日志
+func (s *Service) GetOrderStatusLogs(ctx context.Context, orderID int64) ([]*OrderStatusLog, error) {
+	if _, err := s.repo.GetOrder(ctx, orderID); err != nil {
+		return nil, err
+	}
+
+	logs, err := s.repo.ListOrderStatusLogs(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if logs == nil {
+		logs = []*OrderStatusLog{}
+	}
+	return logs, nil
+}
@@ -0,0 +1,75 @@
+package seckill
+
+import (
+	"context"
+	"testing"
+
+	"rag-agent/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 测试状态机只允许 待支付→已支付、待支付→已取消、已支付→已退款
+func TestValidateOrderTransition(t *testing.T) {
+	statuses := []int{OrderPending, OrderPaid, OrderCancelled, OrderRefunded}
+	allowed := map[[2]int]bool{
+		{OrderPending, OrderPaid}:      true,
+		{OrderPending, OrderCancelled}: true,
+		{OrderPaid, OrderRefunded}:     true,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			err := validateOrderTransition(from, to)
+			if allowed[[2]int{from, to}] {
+				assert.NoError(t, err, "%d → %d", from, to)
+			} else {
+				assert.ErrorIs(t, err, ErrOrderStatusInvalid, "%d → %d", from, to)
+			}
+		}
+	}
+}
+
+// 测试支付后退款：归还 MySQL 和 Redis 库存，并记录状态变更日志
+func TestService_RefundOrder(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	service := NewService(repo, cache, &TestMQProducer{}, &TestIDGenerator{}, &TestLocker{}, &config.SeckillConfig{})
+
+	repo.stocks[1] = 10
+	cache.stocks[1] = 9
+	require.NoError(t, repo.CreateOrderWithStock(ctx, &Order{ID: 1, UserID: 1001, CouponID: 1}))
+
+	// 未支付的订单不能退款
+	assert.ErrorIs(t, service.RefundOrder(ctx, 1, "用户申请", ""), ErrOrderStatusInvalid)
+
+	require.NoError(t, service.PayOrder(ctx, 1))
+	require.NoError(t, service.RefundOrder(ctx, 1, "用户申请", "operator-1"))
+	assert.Equal(t, OrderRefunded, repo.orders[1].Status)
+	assert.Equal(t, int64(10), repo.stocks[1])
+	assert.Equal(t, int64(10), cache.stocks[1])
+
+	// 重复退款
+	assert.ErrorIs(t, service.RefundOrder(ctx, 1, "用户申请", ""), ErrOrderStatusInvalid)
+	assert.Equal(t, int64(10), cache.stocks[1])
+
+	logs, err := service.GetOrderStatusLogs(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	assert.Equal(t, OrderPending, logs[0].FromStatus)
+	assert.Equal(t, OrderPaid, logs[0].ToStatus)
+	assert.Equal(t, OrderActorUser, logs[0].Actor)
+	assert.Equal(t, OrderPaid, logs[1].FromStatus)
+	assert.Equal(t, OrderRefunded, logs[1].ToStatus)
+	assert.Equal(t, "用户申请", logs[1].Reason)
+	assert.Equal(t, "operator-1", logs[1].Actor)
+
+	order, err := service.GetOrder(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, OrderStateRefunded, order.State)
+
+	_, err = service.GetOrderStatusLogs(ctx, 2)
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+}
@@ -0,0 +1,140 @@
+package seckill
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	orderTimeoutInterval   = time.Second      // 轮询间隔
+	orderTimeoutBatchSize  = 100              // 每次取出的到期订单数
+	orderTimeoutClaimLease = 10 * time.Second // 认领租约：取消失败或进程崩溃后重新处理的延迟
+)
+
+// OrderTimeoutWorker 订单支付超时 worker
+// 定时从 Redis 有序集合中认领到期订单，取消仍未支付的订单并归还 MySQL 与 Redis 库存，
+// 处理完成后才移除超时登记，保证每个订单至少被处理一次
+type OrderTimeoutWorker struct {
+	repo   Repository
+	cache  CacheRepository
+	locker Locker
+
+	interval time.Duration
+	now      func() time.Time
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewOrderTimeoutWorker 创建订单支付超时 worker
+func NewOrderTimeoutWorker(repo Repository, cache CacheRepository, locker Locker) *OrderTimeoutWorker {
+	return &OrderTimeoutWorker{
+		repo:     repo,
+		cache:    cache,
+		locker:   locker,
+		interval: orderTimeoutInterval,
+		now:      time.Now,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start 启动后台轮询
+func (w *OrderTimeoutWorker) Start(ctx context.Context) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.stopCh:
+				return
+			case <-ticker.C:
+				if err := w.RunOnce(ctx); err != nil {
+					log.Printf("处理超时订单失败: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止后台轮询并等待当前批次处理完成
+func (w *OrderTimeoutWorker) Stop() {
+	close(w.stopCh)
+	w.wg.Wait()
+}
+
+// RunOnce 取消一批已到期的订单
+func (w *OrderTimeoutWorker) RunOnce(ctx context.Context) error {
+	orderIDs, err := w.cache.ClaimExpiredOrders(ctx, w.now(), orderTimeoutClaimLease, orderTimeoutBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, orderID := range orderIDs {
+		if !w.cancel(ctx, orderID) {
+			// 保留登记，租约到期后重新认领
+			continue
+		}
+		if err := w.cache.RemoveOrderTimeout(ctx, orderID); err != nil {
+			log.Printf("移除订单超时登记失败: %v, orderID=%d", err, orderID)
+		}
+	}
+	return nil
+}
+
+// cancel 取消单个超时订单，返回是否已处理完成（已取消、已支付或订单不存在）
+// 在对账锁内完成状态变更和 Redis 库存归还，锁被占用或取消失败时返回 false 稍后重试
+func (w *OrderTimeoutWorker) cancel(ctx context.Context, orderID int64) bool {
+	order, err := w.repo.GetOrder(ctx, orderID)
+	if errors.Is(err, ErrOrderNotFound) {
+		return true
+	}
+	if err != nil {
+		log.Printf("查询超时订单失败: %v, orderID=%d, 稍后重试", err, orderID)
+		return false
+	}
+	if order.Status != OrderPending {
+		// 已支付或已取消，无需处理
+		return true
+	}
+
+	unlock, err := w.locker.Lock(ctx, reconcileLockName(order.CouponID))
+	if err != nil {
+		log.Printf("获取对账锁失败: %v, orderID=%d, 稍后重试", err, orderID)
+		return false
+	}
+	defer unlock()
+
+	order, err = w.repo.TransitionOrder(ctx, &OrderTransition{
+		OrderID: orderID,
+		From:    OrderPending,
+		To:      OrderCancelled,
+		Reason:  "支付超时",
+		Actor:   OrderActorSystem,
+	})
+	if errors.Is(err, ErrOrderStatusInvalid) || errors.Is(err, ErrOrderNotFound) {
+		// 已支付或已取消，无需处理
+		return true
+	}
+	if err != nil {
+		log.Printf("取消超时订单失败: %v, orderID=%d, 稍后重试", err, orderID)
+		return false
+	}
+
+	// MySQL 库存已在事务中归还，这里归还 Redis 库存
+	// 用户仍保留在已购集合中：uk_user_coupon 不允许同一用户对同一优惠券再下一单
+	if err := w.cache.IncrStock(ctx, order.CouponID, 1); err != nil {
+		log.Printf("归还 Redis 库存失败: %v, orderID=%d", err, orderID)
+	}
+
+	log.Printf("订单支付超时已取消: orderID=%d, couponID=%d", orderID, order.CouponID)
+	return true
+}
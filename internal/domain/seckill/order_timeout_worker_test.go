@@ -0,0 +1,92 @@
+package seckill
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 测试超时未支付的订单被取消并归还库存
+func TestOrderTimeoutWorker_CancelExpired(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	repo.stocks[1] = 10
+
+	require.NoError(t, repo.CreateOrderWithStock(ctx, &Order{ID: 1, UserID: 1001, CouponID: 1}))
+	require.NoError(t, repo.CreateOrderWithStock(ctx, &Order{ID: 2, UserID: 1002, CouponID: 1}))
+	now := time.Now()
+	require.NoError(t, cache.ScheduleOrderTimeout(ctx, 1, now.Add(-time.Second)))
+	require.NoError(t, cache.ScheduleOrderTimeout(ctx, 2, now.Add(time.Minute)))
+
+	worker := NewOrderTimeoutWorker(repo, cache, &TestLocker{})
+	worker.now = func() time.Time { return now }
+	require.NoError(t, worker.RunOnce(ctx))
+
+	// 只有到期的订单被取消
+	assert.Equal(t, OrderCancelled, repo.orders[1].Status)
+	assert.Equal(t, OrderPending, repo.orders[2].Status)
+	require.Len(t, repo.statusLogs, 1)
+	assert.Equal(t, OrderActorSystem, repo.statusLogs[0].Actor)
+	assert.Equal(t, int64(9), repo.stocks[1], "MySQL 库存应归还 1 个")
+	assert.Equal(t, int64(1), cache.stocks[1], "Redis 库存应归还 1 个")
+	assert.NotContains(t, cache.timeouts, int64(1), "处理完成后移除超时登记")
+	assert.Contains(t, cache.timeouts, int64(2))
+}
+
+// 测试已支付的订单不会被取消
+func TestOrderTimeoutWorker_SkipPaid(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	repo.stocks[1] = 10
+
+	require.NoError(t, repo.CreateOrderWithStock(ctx, &Order{ID: 1, UserID: 1001, CouponID: 1}))
+	_, err := repo.TransitionOrder(ctx, &OrderTransition{OrderID: 1, From: OrderPending, To: OrderPaid})
+	require.NoError(t, err)
+	require.NoError(t, cache.ScheduleOrderTimeout(ctx, 1, time.Now().Add(-time.Second)))
+
+	worker := NewOrderTimeoutWorker(repo, cache, &TestLocker{})
+	require.NoError(t, worker.RunOnce(ctx))
+
+	assert.Equal(t, OrderPaid, repo.orders[1].Status)
+	assert.Equal(t, int64(9), repo.stocks[1])
+	assert.Empty(t, cache.stocks)
+}
+
+// 测试对账锁被占用时不取消订单，保留登记到租约到期后重试
+func TestOrderTimeoutWorker_ReconcileLocked(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	repo.stocks[1] = 10
+
+	require.NoError(t, repo.CreateOrderWithStock(ctx, &Order{ID: 1, UserID: 1001, CouponID: 1}))
+	now := time.Now()
+	require.NoError(t, cache.ScheduleOrderTimeout(ctx, 1, now.Add(-time.Second)))
+
+	locker := &TestLocker{}
+	unlock, err := locker.Lock(ctx, reconcileLockName(1))
+	require.NoError(t, err)
+
+	worker := NewOrderTimeoutWorker(repo, cache, locker)
+	worker.now = func() time.Time { return now }
+	require.NoError(t, worker.RunOnce(ctx))
+
+	assert.Equal(t, OrderPending, repo.orders[1].Status)
+	assert.Empty(t, cache.stocks)
+	assert.Equal(t, now.Add(orderTimeoutClaimLease), cache.timeouts[1])
+
+	// 租约内不会重复认领，租约到期后锁已释放则取消成功
+	require.NoError(t, worker.RunOnce(ctx))
+	assert.Equal(t, OrderPending, repo.orders[1].Status)
+
+	unlock()
+	worker.now = func() time.Time { return now.Add(orderTimeoutClaimLease) }
+	require.NoError(t, worker.RunOnce(ctx))
+	assert.Equal(t, OrderCancelled, repo.orders[1].Status)
+	assert.Empty(t, cache.timeouts)
+}
@@ -0,0 +1,152 @@
+package seckill
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"rag-agent/config"
+)
+
+// queueAdmitInterval 排队放行间隔，每次放行 QueueAdmitRate 人
+const queueAdmitInterval = time.Second
+
+// JoinQueue 加入秒杀排队，返回排队号和当前排名
+// 未开启排队模式时直接返回已放行
+func (s *Service) JoinQueue(ctx context.Context, req *SeckillRequest) (*QueueStatus, error) {
+	if !s.cfg.QueueEnabled {
+		return &QueueStatus{CouponID: req.CouponID, UserID: req.UserID, Admitted: true}, nil
+	}
+
+	// 已售罄时无需排队
+	if s.soldOut.isSoldOut(req.CouponID, time.Now()) {
+		return nil, ErrStockNotEnough
+	}
+
+	ticket, err := s.cache.JoinQueue(ctx, req.CouponID, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := s.GetQueueStatus(ctx, req.CouponID, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	status.Ticket = ticket
+	return status, nil
+}
+
+// GetQueueStatus 查询排队状态，不在队列中且未被放行时返回 ErrNotInQueue
+func (s *Service) GetQueueStatus(ctx context.Context, couponID, userID int64) (*QueueStatus, error) {
+	if !s.cfg.QueueEnabled {
+		return &QueueStatus{CouponID: couponID, UserID: userID, Admitted: true}, nil
+	}
+
+	position, admittedUntil, err := s.cache.GetQueuePosition(ctx, couponID, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if position < 0 {
+		return nil, ErrNotInQueue
+	}
+
+	status := &QueueStatus{
+		CouponID: couponID,
+		UserID:   userID,
+		Position: position,
+	}
+	if position == 0 {
+		status.Admitted = true
+		status.AdmittedUntil = &admittedUntil
+		return status, nil
+	}
+	if s.cfg.QueueAdmitRate > 0 {
+		// 向上取整：排名在第一批内的用户预计等待 1 秒
+		status.EstimatedWait = (position + int64(s.cfg.QueueAdmitRate) - 1) / int64(s.cfg.QueueAdmitRate)
+	}
+	return status, nil
+}
+
+// QueueAdmitter 排队放行 worker
+// 每秒为每个有排队的优惠券按到达顺序放行 QueueAdmitRate 个用户，放行后 QueueAdmitTTL 内可以秒杀；
+// 多实例部署时只有 leader 放行，保证总放行速率不随实例数增加
+type QueueAdmitter struct {
+	cache   CacheRepository
+	elector LeaderElector
+	cfg     *config.SeckillConfig
+
+	interval time.Duration
+	now      func() time.Time
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewQueueAdmitter 创建排队放行 worker
+func NewQueueAdmitter(cache CacheRepository, elector LeaderElector, cfg *config.SeckillConfig) *QueueAdmitter {
+	return &QueueAdmitter{
+		cache:    cache,
+		elector:  elector,
+		cfg:      cfg,
+		interval: queueAdmitInterval,
+		now:      time.Now,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start 启动后台放行
+func (a *QueueAdmitter) Start(ctx context.Context) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-a.stopCh:
+				return
+			case <-ticker.C:
+				if err := a.RunOnce(ctx); err != nil {
+					log.Printf("排队放行失败: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止后台放行
+func (a *QueueAdmitter) Stop() {
+	close(a.stopCh)
+	a.wg.Wait()
+}
+
+// RunOnce 为每个有排队的优惠券放行一批用户，当前实例不是 leader 时直接跳过
+func (a *QueueAdmitter) RunOnce(ctx context.Context) error {
+	if !a.elector.IsLeader() || a.cfg.QueueAdmitRate <= 0 {
+		return nil
+	}
+
+	couponIDs, err := a.cache.ListQueuedCoupons(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := a.now()
+	for _, couponID := range couponIDs {
+		userIDs, err := a.cache.AdmitFromQueue(ctx, couponID, a.cfg.QueueAdmitRate, now.Add(a.cfg.QueueAdmitTTL), now)
+		if err != nil {
+			log.Printf("放行排队用户失败: %v, couponID=%d", err, couponID)
+			continue
+		}
+		if len(userIDs) > 0 {
+			log.Printf("排队放行: couponID=%d, count=%d", couponID, len(userIDs))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package seckill
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rag-agent/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestQueueService() (*Service, *TestOrderCache) {
+	cache := NewTestOrderCache()
+	cfg := &config.SeckillConfig{QueueEnabled: true, QueueAdmitRate: 2, QueueAdmitTTL: time.Minute}
+	return NewService(NewTestRepository(), cache, &TestMQProducer{}, &TestIDGenerator{}, &TestLocker{}, cfg), cache
+}
+
+// 测试排队模式下未放行的用户不能秒杀，放行后可以秒杀
+func TestSeckill_QueueAdmission(t *testing.T) {
+	ctx := context.Background()
+	service, cache := newTestQueueService()
+	cache.stocks[1] = 10
+
+	resp, err := service.Seckill(ctx, &SeckillRequest{UserID: 1001, CouponID: 1})
+	assert.ErrorIs(t, err, ErrNotAdmitted)
+	assert.False(t, resp.Success)
+	assert.Equal(t, 0, cache.decrCalls)
+
+	status, err := service.JoinQueue(ctx, &SeckillRequest{UserID: 1001, CouponID: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), status.Ticket)
+	assert.Equal(t, int64(1), status.Position)
+	assert.False(t, status.Admitted)
+
+	_, err = cache.AdmitFromQueue(ctx, 1, 1, time.Now().Add(time.Minute), time.Now())
+	require.NoError(t, err)
+
+	resp, err = service.Seckill(ctx, &SeckillRequest{UserID: 1001, CouponID: 1})
+	require.NoError(t, err)
+	assert.True(t, resp.Success)
+}
+
+// 测试排队状态：排名、预计等待时间和放行状态
+func TestService_GetQueueStatus(t *testing.T) {
+	ctx := context.Background()
+	service, cache := newTestQueueService()
+
+	_, err := service.GetQueueStatus(ctx, 1, 1001)
+	assert.ErrorIs(t, err, ErrNotInQueue)
+
+	for userID := int64(1001); userID <= 1005; userID++ {
+		_, err := service.JoinQueue(ctx, &SeckillRequest{UserID: userID, CouponID: 1})
+		require.NoError(t, err)
+	}
+
+	// 重复排队返回原排队号
+	status, err := service.JoinQueue(ctx, &SeckillRequest{UserID: 1003, CouponID: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), status.Ticket)
+
+	// 每秒放行 2 人，排名第 5 预计等待 3 秒
+	status, err = service.GetQueueStatus(ctx, 1, 1005)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), status.Position)
+	assert.Equal(t, int64(3), status.EstimatedWait)
+
+	until := time.Now().Add(time.Minute)
+	_, err = cache.AdmitFromQueue(ctx, 1, 2, until, time.Now())
+	require.NoError(t, err)
+
+	status, err = service.GetQueueStatus(ctx, 1, 1001)
+	require.NoError(t, err)
+	assert.True(t, status.Admitted)
+	require.NotNil(t, status.AdmittedUntil)
+	assert.Equal(t, until, *status.AdmittedUntil)
+
+	status, err = service.GetQueueStatus(ctx, 1, 1005)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), status.Position)
+	assert.Equal(t, int64(2), status.EstimatedWait)
+}
+
+// 测试未开启排队模式时直接放行
+func TestService_QueueDisabled(t *testing.T) {
+	ctx := context.Background()
+	cache := NewTestOrderCache()
+	service := NewService(NewTestRepository(), cache, nil, nil, &TestLocker{}, &config.SeckillConfig{})
+
+	status, err := service.JoinQueue(ctx, &SeckillRequest{UserID: 1001, CouponID: 1})
+	require.NoError(t, err)
+	assert.True(t, status.Admitted)
+	assert.Empty(t, cache.queues[1])
+}
+
+// 测试放行 worker 按速率放行，且只有 leader 执行
+func TestQueueAdmitter_RunOnce(t *testing.T) {
+	ctx := context.Background()
+	cache := NewTestOrderCache()
+	cfg := &config.SeckillConfig{QueueAdmitRate: 2, QueueAdmitTTL: time.Minute}
+	for userID := int64(1001); userID <= 1003; userID++ {
+		_, err := cache.JoinQueue(ctx, 1, userID)
+		require.NoError(t, err)
+	}
+
+	follower := NewQueueAdmitter(cache, &TestElector{leader: false}, cfg)
+	require.NoError(t, follower.RunOnce(ctx))
+	assert.Len(t, cache.queues[1], 3)
+
+	now := time.Now()
+	admitter := NewQueueAdmitter(cache, &TestElector{leader: true}, cfg)
+	admitter.now = func() time.Time { return now }
+	require.NoError(t, admitter.RunOnce(ctx))
+	assert.Equal(t, []int64{1003}, cache.queues[1])
+	assert.Equal(t, now.Add(time.Minute), cache.admitted[1][1001])
+	assert.Equal(t, now.Add(time.Minute), cache.admitted[1][1002])
+
+	// 放行过期后不能再秒杀
+	admitted, err := cache.IsAdmitted(ctx, 1, 1001, now.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.False(t, admitted)
+}
+
+// 测试 Redis 排队、查询排名和按顺序放行
+func TestRedisCache_Queue(t *testing.T) {
+	cacheRepo, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	now := time.Now()
+
+	for i, userID := range []int64{1001, 1002, 1003} {
+		ticket, err := cacheRepo.JoinQueue(ctx, 1, userID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(i+1), ticket)
+	}
+	ticket, err := cacheRepo.JoinQueue(ctx, 1, 1002)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), ticket)
+
+	position, _, err := cacheRepo.GetQueuePosition(ctx, 1, 1003, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), position)
+
+	position, _, err = cacheRepo.GetQueuePosition(ctx, 1, 2001, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), position)
+
+	couponIDs, err := cacheRepo.ListQueuedCoupons(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, couponIDs)
+
+	until := now.Add(time.Minute)
+	userIDs, err := cacheRepo.AdmitFromQueue(ctx, 1, 2, until, now)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1001, 1002}, userIDs)
+
+	position, admittedUntil, err := cacheRepo.GetQueuePosition(ctx, 1, 1001, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), position)
+	assert.Equal(t, until.UnixMilli(), admittedUntil.UnixMilli())
+
+	admitted, err := cacheRepo.IsAdmitted(ctx, 1, 1001, now)
+	require.NoError(t, err)
+	assert.True(t, admitted)
+	admitted, err = cacheRepo.IsAdmitted(ctx, 1, 1001, until)
+	require.NoError(t, err)
+	assert.False(t, admitted)
+
+	position, _, err = cacheRepo.GetQueuePosition(ctx, 1, 1003, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), position)
+
+	// 队列放行完后不再出现在排队优惠券集合中
+	_, err = cacheRepo.AdmitFromQueue(ctx, 1, 2, until, now)
+	require.NoError(t, err)
+	couponIDs, err = cacheRepo.ListQueuedCoupons(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, couponIDs)
+}
@@ -0,0 +1,238 @@
+package seckill
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	reconcileInterval    = time.Minute // 定时对账间隔
+	reconcileSettleDelay = time.Second // 修复前两次对账之间的间隔
+)
+
+// reconcileLockName 对账修复锁名称
+// 超时取消、退款、补偿失败和丢弃死信归还库存时持有同一把锁，修复期间不会出现只归还了一半的库存
+func reconcileLockName(couponID int64) string {
+	return fmt.Sprintf("reconcile:%d", couponID)
+}
+
+// Reconciler Redis/MySQL 库存对账
+//
+// 对每个进行中的优惠券计算应有库存：
+//   - MySQL 应有剩余库存 = 总库存 - 有效订单数
+//   - Redis 应有库存 = MySQL 应有剩余库存 - 在途订单数
+//     （在途订单数 = 已购用户数 - 有效订单数 - 已取消订单数，取消订单的用户仍保留在已购集合中）
+//
+// 公式假设每个已购用户对应 1 个库存：订单流程只通过 DecrStock/DecrStockForOrder 扣减 1 个；
+// DecrStockN 扣减多个库存时已购用户数少于已扣减数量，公式不成立，不能与对账修复同时使用
+//
+// 修复时在分布式锁内按差值调整，不直接覆盖，减小与秒杀请求并发时的影响
+// 秒杀扣减和回滚不持有锁，Redis 差值只有在间隔 settleDelay 的两次对账中一致时才修复
+type Reconciler struct {
+	repo   Repository
+	cache  CacheRepository
+	locker Locker
+
+	settleDelay time.Duration
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewReconciler 创建库存对账器
+func NewReconciler(repo Repository, cache CacheRepository, locker Locker) *Reconciler {
+	return &Reconciler{
+		repo:        repo,
+		cache:       cache,
+		locker:      locker,
+		settleDelay: reconcileSettleDelay,
+		stopCh:      make(chan struct{}),
+	}
+}
+
+// Start 启动定时对账（只报告，不修复）
+func (r *Reconciler) Start(ctx context.Context) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(reconcileInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.stopCh:
+				return
+			case <-ticker.C:
+				reports, err := r.Check(ctx)
+				if err != nil {
+					log.Printf("库存对账失败: %v", err)
+					continue
+				}
+				for _, report := range reports {
+					if report.MySQLDrift != 0 || report.RedisDrift != 0 || report.Error != "" {
+						log.Printf("库存不一致: couponID=%d, redisDrift=%d, mysqlDrift=%d, err=%s",
+							report.CouponID, report.RedisDrift, report.MySQLDrift, report.Error)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止定时对账
+func (r *Reconciler) Stop() {
+	close(r.stopCh)
+	r.wg.Wait()
+}
+
+// Check 对所有进行中的优惠券对账
+func (r *Reconciler) Check(ctx context.Context) ([]*StockReport, error) {
+	coupons, err := r.repo.ListActiveCoupons(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]*StockReport, 0, len(coupons))
+	for _, coupon := range coupons {
+		report, err := r.check(ctx, coupon)
+		if err != nil {
+			report = &StockReport{CouponID: coupon.ID, Error: err.Error()}
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// Repair 对所有进行中的优惠券对账并修复不一致的库存
+func (r *Reconciler) Repair(ctx context.Context) ([]*StockReport, error) {
+	coupons, err := r.repo.ListActiveCoupons(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]*StockReport, 0, len(coupons))
+	for _, coupon := range coupons {
+		report, err := r.repair(ctx, coupon.ID)
+		if err != nil {
+			report = &StockReport{CouponID: coupon.ID, Error: err.Error()}
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// check 计算单个优惠券的库存差异
+func (r *Reconciler) check(ctx context.Context, coupon *Coupon) (*StockReport, error) {
+	redisStock, err := r.cache.GetStock(ctx, coupon.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	bought, err := r.cache.CountBoughtUsers(ctx, coupon.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	active, cancelled, err := r.repo.CountOrders(ctx, coupon.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	inFlight := bought - active - cancelled
+	if inFlight < 0 {
+		inFlight = 0
+	}
+
+	expectedMySQL := coupon.TotalStock - active
+	expectedRedis := expectedMySQL - inFlight
+
+	return &StockReport{
+		CouponID:        coupon.ID,
+		TotalStock:      coupon.TotalStock,
+		RedisStock:      redisStock,
+		MySQLStock:      coupon.RemainStock,
+		ActiveOrders:    active,
+		CancelledOrders: cancelled,
+		InFlight:        inFlight,
+		MySQLDrift:      coupon.RemainStock - expectedMySQL,
+		RedisDrift:      redisStock - expectedRedis,
+	}, nil
+}
+
+// repair 在分布式锁内修复单个优惠券的库存
+func (r *Reconciler) repair(ctx context.Context, couponID int64) (*StockReport, error) {
+	unlock, err := r.locker.Lock(ctx, reconcileLockName(couponID))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	first, err := r.recheck(ctx, couponID)
+	if err != nil {
+		return nil, err
+	}
+	if first.MySQLDrift == 0 && first.RedisDrift == 0 {
+		return first, nil
+	}
+
+	// 等待进行中的秒杀请求和消费者完成，再次对账确认差异稳定
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(r.settleDelay):
+	}
+	report, err := r.recheck(ctx, couponID)
+	if err != nil {
+		return nil, err
+	}
+
+	// MySQL 按当前有效订单数原子修正，不受并发影响
+	if report.MySQLDrift != 0 {
+		if err := r.repo.RepairRemainStock(ctx, couponID); err != nil {
+			return nil, err
+		}
+		report.Repaired = true
+	}
+
+	if report.RedisDrift != 0 {
+		if report.RedisDrift != first.RedisDrift {
+			log.Printf("Redis 库存差异不稳定，跳过修复: couponID=%d, drift=%d -> %d",
+				couponID, first.RedisDrift, report.RedisDrift)
+		} else {
+			// AdjustStock 在分桶之间分摊差值，任何桶都不会被扣成负数
+			stock, err := r.cache.AdjustStock(ctx, couponID, -report.RedisDrift)
+			if err != nil {
+				return nil, err
+			}
+			switch stock {
+			case stockNotCached:
+				log.Printf("Redis 库存未缓存，跳过修复: couponID=%d", couponID)
+			case stockNotEnough:
+				return nil, fmt.Errorf("修正 Redis 库存失败: %w", ErrStockNotEnough)
+			default:
+				report.Repaired = true
+			}
+		}
+	}
+
+	if report.Repaired {
+		log.Printf("库存已修复: couponID=%d, redisDrift=%d, mysqlDrift=%d",
+			couponID, report.RedisDrift, report.MySQLDrift)
+	}
+	return report, nil
+}
+
+// recheck 重新读取优惠券并对账，避免使用过期数据
+func (r *Reconciler) recheck(ctx context.Context, couponID int64) (*StockReport, error) {
+	coupon, err := r.repo.GetCoupon(ctx, couponID)
+	if err != nil {
+		return nil, err
+	}
+	return r.check(ctx, coupon)
+}
@@ -0,0 +1,149 @@
+package seckill
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 构造对账场景：总库存 10，2 个有效订单、1 个已取消订单、1 个在途订单
+func setupReconcileEnv(t *testing.T) (*TestRepository, *TestOrderCache) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+
+	repo.coupons[1] = &Coupon{ID: 1, TotalStock: 10, Status: CouponActive}
+	repo.stocks[1] = 10
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, repo.CreateOrderWithStock(ctx, &Order{ID: i, UserID: 1000 + i, CouponID: 1}))
+	}
+	_, err := repo.TransitionOrder(ctx, &OrderTransition{OrderID: 3, From: OrderPending, To: OrderCancelled})
+	require.NoError(t, err)
+
+	// Redis：4 个用户扣减过库存（含 1 个在途），1 个订单取消后归还
+	cache.bought[1] = 4
+	cache.stocks[1] = 10 - 4 + 1
+
+	return repo, cache
+}
+
+// 测试库存一致时无差异
+func TestReconciler_CheckConsistent(t *testing.T) {
+	repo, cache := setupReconcileEnv(t)
+	r := NewReconciler(repo, cache, &TestLocker{})
+
+	reports, err := r.Check(context.Background())
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+
+	report := reports[0]
+	assert.Equal(t, int64(2), report.ActiveOrders)
+	assert.Equal(t, int64(1), report.CancelledOrders)
+	assert.Equal(t, int64(1), report.InFlight)
+	assert.Equal(t, int64(0), report.MySQLDrift)
+	assert.Equal(t, int64(0), report.RedisDrift)
+}
+
+// 测试检测并修复库存差异
+func TestReconciler_Repair(t *testing.T) {
+	repo, cache := setupReconcileEnv(t)
+	repo.stocks[1] = 5  // MySQL 少了 3 个
+	cache.stocks[1] = 9 // Redis 多了 2 个
+	r := NewReconciler(repo, cache, &TestLocker{})
+	r.settleDelay = 0
+
+	ctx := context.Background()
+	reports, err := r.Check(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-3), reports[0].MySQLDrift)
+	assert.Equal(t, int64(2), reports[0].RedisDrift)
+	assert.False(t, reports[0].Repaired)
+
+	reports, err = r.Repair(ctx)
+	require.NoError(t, err)
+	assert.True(t, reports[0].Repaired)
+	assert.Equal(t, int64(8), repo.stocks[1])
+	assert.Equal(t, int64(7), cache.stocks[1])
+
+	// 修复后再次对账无差异
+	reports, err = r.Check(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), reports[0].MySQLDrift)
+	assert.Equal(t, int64(0), reports[0].RedisDrift)
+}
+
+// 测试锁被占用时不修复
+func TestReconciler_RepairLocked(t *testing.T) {
+	repo, cache := setupReconcileEnv(t)
+	cache.stocks[1] = 9
+	locker := &TestLocker{}
+	_, err := locker.Lock(context.Background(), "reconcile:1")
+	require.NoError(t, err)
+
+	r := NewReconciler(repo, cache, locker)
+	reports, err := r.Repair(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, ErrLockFailed.Error(), reports[0].Error)
+	assert.Equal(t, int64(9), cache.stocks[1])
+}
+
+// 两次对账之间库存发生变化的缓存，模拟修复时有请求正在扣减
+type driftingStockCache struct {
+	*TestOrderCache
+	reads int
+}
+
+func (c *driftingStockCache) GetStock(ctx context.Context, couponID int64) (int64, error) {
+	stock, err := c.TestOrderCache.GetStock(ctx, couponID)
+	c.reads++
+	if c.reads == 2 {
+		stock--
+	}
+	return stock, err
+}
+
+// 测试两次对账的 Redis 差异不一致时不修复
+func TestReconciler_RepairUnstableDrift(t *testing.T) {
+	repo, cache := setupReconcileEnv(t)
+	cache.stocks[1] = 9
+	r := NewReconciler(repo, &driftingStockCache{TestOrderCache: cache}, &TestLocker{})
+	r.settleDelay = 0
+
+	reports, err := r.Repair(context.Background())
+	require.NoError(t, err)
+	assert.False(t, reports[0].Repaired)
+	assert.Equal(t, int64(1), reports[0].RedisDrift)
+	assert.Equal(t, int64(9), cache.stocks[1])
+}
+
+// 测试分桶模式下修复 Redis 多出的库存时不会把某个桶扣成负数
+func TestReconciler_RepairBuckets(t *testing.T) {
+	cacheRepo, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	repo := NewTestRepository()
+	repo.coupons[1] = &Coupon{ID: 1, TotalStock: 5, Status: CouponActive}
+	repo.stocks[1] = 5
+	require.NoError(t, cacheRepo.SetStockBuckets(ctx, 1, 4))
+	require.NoError(t, cacheRepo.SetStock(ctx, 1, 8)) // Redis 多了 3 个
+
+	r := NewReconciler(repo, cacheRepo, &TestLocker{})
+	r.settleDelay = 0
+	reports, err := r.Repair(ctx)
+	require.NoError(t, err)
+	require.True(t, reports[0].Repaired)
+	assert.Equal(t, int64(3), reports[0].RedisDrift)
+
+	// 修复后恰好还能扣减 5 次
+	for userID := int64(1); userID <= 5; userID++ {
+		stock, err := cacheRepo.DecrStock(ctx, 1, userID)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, stock, int64(0))
+	}
+	stock, err := cacheRepo.DecrStock(ctx, 1, 6)
+	require.NoError(t, err)
+	assert.Equal(t, int64(stockNotEnough), stock)
+}
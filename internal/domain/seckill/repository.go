@@ -1,32 +1,90 @@
 package seckill
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Repository 秒杀数据仓库接口
 type Repository interface {
 	// GetCoupon 获取优惠券信息
 	GetCoupon(ctx context.Context, couponID int64) (*Coupon, error)
 
+	// ListActiveCoupons 获取进行中的优惠券
+	ListActiveCoupons(ctx context.Context) ([]*Coupon, error)
+
+	// ListCoupons 分页获取优惠券列表，status 为 nil 时不过滤状态，返回列表和总数
+	ListCoupons(ctx context.Context, status *int, offset, limit int) ([]*Coupon, int64, error)
+
+	// CreateCoupon 创建优惠券
+	CreateCoupon(ctx context.Context, coupon *Coupon) error
+
+	// UpdateCoupon 更新优惠券基本信息、分桶数、活动时间和状态
+	UpdateCoupon(ctx context.Context, coupon *Coupon) error
+
+	// AdjustCouponStock 调整总库存，剩余库存同步增减；剩余库存不足时返回 ErrStockNotEnough
+	AdjustCouponStock(ctx context.Context, couponID int64, delta int64) error
+
+	// DeleteCoupon 软删除优惠券
+	DeleteCoupon(ctx context.Context, couponID int64) error
+
+	// ListCouponsToSchedule 获取需要调度的优惠券：未开始且开始时间不晚于 startBefore，或进行中且结束时间不晚于 endBefore
+	ListCouponsToSchedule(ctx context.Context, startBefore, endBefore time.Time) ([]*Coupon, error)
+
+	// UpdateCouponStatus 将优惠券状态从 from 改为 to，当前状态不是 from 时返回 ErrCouponStatusInvalid
+	UpdateCouponStatus(ctx context.Context, couponID int64, from, to int) error
+
+	// CountOrders 统计优惠券的订单数：有效订单（待支付、已支付）和已归还库存的订单（已取消、已退款）
+	CountOrders(ctx context.Context, couponID int64) (active int64, cancelled int64, err error)
+
+	// RepairRemainStock 按有效订单数修正 MySQL 剩余库存：remain_stock = total_stock - 有效订单数
+	RepairRemainStock(ctx context.Context, couponID int64) error
+
 	// DecrStock 减少库存
 	DecrStock(ctx context.Context, couponID int64) error
 
 	// CreateOrder 创建订单
 	CreateOrder(ctx context.Context, order *Order) error
 
-	// GetOrder 获取订单
+	// CreateOrderWithStock 在同一事务中扣减库存并创建订单
+	// 用户已存在该优惠券的订单时返回 ErrOrderExists
+	CreateOrderWithStock(ctx context.Context, order *Order) error
+
+	// GetOrder 获取订单，不存在时返回 ErrOrderNotFound
 	GetOrder(ctx context.Context, orderID int64) (*Order, error)
 
-	// UpdateOrderStatus 更新订单状态
-	UpdateOrderStatus(ctx context.Context, orderID int64, status int) error
+	// ListOrdersByUser 获取用户的订单列表（按创建时间倒序）
+	ListOrdersByUser(ctx context.Context, userID int64) ([]*Order, error)
+
+	// TransitionOrder 按订单状态机变更订单状态，在同一事务中写入状态变更日志，
+	// 变更为已取消或已退款时归还 MySQL 库存，返回变更后的订单
+	// 订单不存在返回 ErrOrderNotFound，状态机不允许或当前状态不是 From 返回 ErrOrderStatusInvalid
+	TransitionOrder(ctx context.Context, t *OrderTransition) (*Order, error)
+
+	// ListOrderStatusLogs 获取订单的状态变更日志（按时间正序）
+	ListOrderStatusLogs(ctx context.Context, orderID int64) ([]*OrderStatusLog, error)
 
 	// SaveCompensationTask 保存补偿任务
 	SaveCompensationTask(ctx context.Context, task *CompensationTask) error
 
-	// GetPendingCompensationTasks 获取待处理的补偿任务
-	GetPendingCompensationTasks(ctx context.Context, limit int) ([]*CompensationTask, error)
+	// GetPendingCompensationTasks 获取退避期已过的待处理补偿任务（退避时间见 compensationBackoff），
+	// 以及处理中超过 processingTimeout 未更新的任务（处理实例已崩溃或被取消）
+	GetPendingCompensationTasks(ctx context.Context, limit int, processingTimeout time.Duration) ([]*CompensationTask, error)
 
 	// UpdateCompensationTaskStatus 更新补偿任务状态
 	UpdateCompensationTaskStatus(ctx context.Context, taskID int64, status int, retryCount int) error
+
+	// SaveDeadLetter 保存死信消息
+	SaveDeadLetter(ctx context.Context, dl *DeadLetter) error
+
+	// GetDeadLetter 获取死信消息，不存在时返回 ErrDeadLetterNotFound
+	GetDeadLetter(ctx context.Context, id int64) (*DeadLetter, error)
+
+	// ListDeadLetters 分页获取死信消息（按 ID 倒序），status 为 nil 时不过滤状态，返回列表和总数
+	ListDeadLetters(ctx context.Context, status *int, offset, limit int) ([]*DeadLetter, int64, error)
+
+	// UpdateDeadLetterStatus 将死信状态从 from 改为 to，当前状态不是 from 时返回 ErrDeadLetterHandled
+	UpdateDeadLetterStatus(ctx context.Context, id int64, from, to int) error
 }
 
 // CacheRepository 缓存仓库接口
@@ -34,13 +92,114 @@ type CacheRepository interface {
 	// GetStock 获取缓存中的库存
 	GetStock(ctx context.Context, couponID int64) (int64, error)
 
-	// DecrStock 使用 Lua 脚本原子性扣减库存
-	// 返回扣减后的库存，如果库存不足返回 -1
-	DecrStock(ctx context.Context, couponID int64) (int64, error)
+	// GetStocks 批量获取多个优惠券的库存，未缓存的优惠券不出现在结果中
+	GetStocks(ctx context.Context, couponIDs []int64) (map[int64]int64, error)
+
+	// DecrStock 使用 Lua 脚本原子性校验活动时间、用户是否已购买并扣减库存
+	// 分桶模式下随机选择一个桶扣减，不足时依次尝试其他桶
+	// 返回扣减后的库存（分桶模式下为所扣减桶的剩余库存），如果库存不足返回 -1，用户已购买返回 -2，
+	// 活动未开始返回 -3，活动已结束返回 -4
+	DecrStock(ctx context.Context, couponID, userID int64) (int64, error)
+
+	// DecrStockN 与 DecrStock 相同，但一次购买扣减 quantity 个库存；库存少于 quantity 时返回 -1
+	// 已购用户集合只记录用户不记录数量，quantity 大于 1 的扣减不能与库存对账修复同时使用
+	DecrStockN(ctx context.Context, couponID, userID, quantity int64) (int64, error)
+
+	// DecrStockForOrder 与 DecrStock 相同，扣减成功时在同一个 Lua 脚本中写入订单扣减记录，供事务消息回查
+	DecrStockForOrder(ctx context.Context, couponID, userID, orderID int64) (int64, error)
+
+	// HasOrderDeduction 订单扣减记录是否存在
+	HasOrderDeduction(ctx context.Context, orderID int64) (bool, error)
 
 	// SetStock 设置缓存中的库存
 	SetStock(ctx context.Context, couponID int64, stock int64) error
 
-	// IncrStock 原子性增加库存
+	// SetStockBuckets 设置库存分桶数（<= 1 为单 key 模式），已缓存的库存按新的分桶数重新分配
+	SetStockBuckets(ctx context.Context, couponID int64, buckets int) error
+
+	// SetStockIfAbsent 库存未缓存时设置库存，返回是否设置成功
+	SetStockIfAbsent(ctx context.Context, couponID int64, stock int64) (bool, error)
+
+	// ExpireCouponKeys 为优惠券的库存、已购用户和活动信息 key 设置过期时间
+	ExpireCouponKeys(ctx context.Context, couponID int64, ttl time.Duration) error
+
+	// SetActivity 设置缓存中的活动时间窗口和状态
+	SetActivity(ctx context.Context, couponID int64, startTime, endTime time.Time, status int) error
+
+	// GetActivity 获取缓存中的活动时间窗口和状态，未缓存时返回 ErrCouponNotFound
+	GetActivity(ctx context.Context, couponID int64) (startTime, endTime time.Time, status int, err error)
+
+	// IncrStock 原子性增加库存，库存未缓存（未预热或已过期）时不处理
 	IncrStock(ctx context.Context, couponID int64, delta int64) error
+
+	// AdjustStock 原子性调整已缓存的库存，调整后库存不能为负
+	// 返回调整后的库存，库存不足返回 -1，库存未缓存返回 -5（不做调整）
+	AdjustStock(ctx context.Context, couponID int64, delta int64) (int64, error)
+
+	// SubscribeStockRestored 订阅库存归还通知（SetStock、IncrStock、RevertStock 等增加库存时发布），
+	// 返回的 channel 在 ctx 结束后关闭
+	SubscribeStockRestored(ctx context.Context) (<-chan int64, error)
+
+	// CountBoughtUsers 统计已购用户集合的大小（Redis 中成功扣减过库存的用户数）
+	CountBoughtUsers(ctx context.Context, couponID int64) (int64, error)
+
+	// RevertStock 回滚用户的扣减：移出已购用户集合并归还 1 个库存
+	// 用户不在集合中时不做任何操作，可重复调用
+	RevertStock(ctx context.Context, couponID, userID int64) error
+
+	// RevertStockN 回滚 DecrStockN 的扣减：移出已购用户集合并归还 quantity 个库存
+	RevertStockN(ctx context.Context, couponID, userID, quantity int64) error
+
+	// SetOrderProcessing 写入订单处理中标记（MQ 消息尚未被消费落库）
+	SetOrderProcessing(ctx context.Context, order *Order, ttl time.Duration) error
+
+	// GetProcessingOrder 获取处理中的订单，没有标记时返回 nil
+	GetProcessingOrder(ctx context.Context, orderID int64) (*Order, error)
+
+	// ListProcessingOrders 获取用户所有处理中的订单
+	ListProcessingOrders(ctx context.Context, userID int64) ([]*Order, error)
+
+	// ClearOrderProcessing 清除订单处理中标记
+	ClearOrderProcessing(ctx context.Context, order *Order) error
+
+	// ScheduleOrderTimeout 登记订单支付超时时间，已登记的订单不会被覆盖
+	ScheduleOrderTimeout(ctx context.Context, orderID int64, deadline time.Time) error
+
+	// ClaimExpiredOrders 原子性认领已到期的订单ID：到期时间推迟 lease，处理完成后需调用 RemoveOrderTimeout，
+	// 未移除的订单在租约到期后重新被认领（多实例下同一租约内每个订单只会被一个实例取到）
+	ClaimExpiredOrders(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]int64, error)
+
+	// RemoveOrderTimeout 移除订单支付超时登记
+	RemoveOrderTimeout(ctx context.Context, orderID int64) error
+
+	// JoinQueue 加入排队，返回排队号（按到达顺序递增，已在队列中时返回原排队号）
+	JoinQueue(ctx context.Context, couponID, userID int64) (int64, error)
+
+	// GetQueuePosition 查询排队状态
+	// 已放行时 position 为 0 并返回放行截止时间，排队中返回排名（从 1 开始），不在队列中返回 -1
+	GetQueuePosition(ctx context.Context, couponID, userID int64, now time.Time) (position int64, admittedUntil time.Time, err error)
+
+	// IsAdmitted 用户是否已被放行且未过期
+	IsAdmitted(ctx context.Context, couponID, userID int64, now time.Time) (bool, error)
+
+	// ListQueuedCoupons 获取有用户排队的优惠券
+	ListQueuedCoupons(ctx context.Context) ([]int64, error)
+
+	// AdmitFromQueue 按排队顺序放行最多 n 个用户，放行有效期截止到 until，返回放行的用户ID
+	AdmitFromQueue(ctx context.Context, couponID int64, n int, until, now time.Time) ([]int64, error)
+
+	// ConsumeToken 标记秒杀令牌已使用，保留到 expireAt；令牌已被使用时返回 false
+	ConsumeToken(ctx context.Context, nonce string, expireAt time.Time) (bool, error)
+}
+
+// Locker 分布式锁接口
+type Locker interface {
+	// Lock 获取名为 name 的锁，返回释放函数；锁已被占用时返回 ErrLockFailed
+	Lock(ctx context.Context, name string) (unlock func(), err error)
+}
+
+// LeaderElector leader 选举接口，多实例部署时只有 leader 执行定时调度
+type LeaderElector interface {
+	// IsLeader 当前实例是否为 leader
+	IsLeader() bool
 }
@@ -3,9 +3,17 @@ package seckill
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
 )
 
+// mysqlErrDupEntry MySQL 唯一键冲突错误码
+const mysqlErrDupEntry = 1062
+
 // MySQLRepository MySQL 秒杀仓库实现（秒杀专用）
 type MySQLRepository struct {
 	db *sql.DB
@@ -18,29 +26,46 @@ func NewMySQLRepository(db *sql.DB) Repository {
 	}
 }
 
-// GetCoupon 获取优惠券信息
-func (r *MySQLRepository) GetCoupon(ctx context.Context, couponID int64) (*Coupon, error) {
-	query := `
-		SELECT id, name, description, total_stock, remain_stock,
-		       start_time, end_time, status, created_at, updated_at
-		FROM coupons
-		WHERE id = ?
-	`
+// couponColumns 优惠券查询列，与 scanCoupon 的字段顺序一致
+const couponColumns = `id, name, description, total_stock, remain_stock, stock_buckets,
+		       start_time, end_time, status, created_at, updated_at`
+
+// rowScanner *sql.Row 和 *sql.Rows 的公共接口
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
+// scanCoupon 扫描一行优惠券数据
+func scanCoupon(row rowScanner) (*Coupon, error) {
 	var coupon Coupon
-	err := r.db.QueryRowContext(ctx, query, couponID).Scan(
+	err := row.Scan(
 		&coupon.ID,
 		&coupon.Name,
 		&coupon.Description,
 		&coupon.TotalStock,
 		&coupon.RemainStock,
+		&coupon.StockBuckets,
 		&coupon.StartTime,
 		&coupon.EndTime,
 		&coupon.Status,
 		&coupon.CreatedAt,
 		&coupon.UpdatedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// GetCoupon 获取优惠券信息（不包含已删除的优惠券）
+func (r *MySQLRepository) GetCoupon(ctx context.Context, couponID int64) (*Coupon, error) {
+	query := `
+		SELECT ` + couponColumns + `
+		FROM coupons
+		WHERE id = ? AND deleted_at IS NULL
+	`
 
+	coupon, err := scanCoupon(r.db.QueryRowContext(ctx, query, couponID))
 	if err == sql.ErrNoRows {
 		return nil, ErrCouponNotFound
 	}
@@ -48,7 +73,258 @@ func (r *MySQLRepository) GetCoupon(ctx context.Context, couponID int64) (*Coupo
 		return nil, fmt.Errorf("查询优惠券失败: %w", err)
 	}
 
-	return &coupon, nil
+	return coupon, nil
+}
+
+// ListActiveCoupons 获取进行中的优惠券
+func (r *MySQLRepository) ListActiveCoupons(ctx context.Context) ([]*Coupon, error) {
+	query := `
+		SELECT ` + couponColumns + `
+		FROM coupons
+		WHERE status = ? AND deleted_at IS NULL
+	`
+
+	return r.queryCoupons(ctx, query, CouponActive)
+}
+
+// ListCoupons 分页获取优惠券列表，status 为 nil 时不过滤状态
+func (r *MySQLRepository) ListCoupons(ctx context.Context, status *int, offset, limit int) ([]*Coupon, int64, error) {
+	where := "WHERE deleted_at IS NULL"
+	var args []any
+	if status != nil {
+		where += " AND status = ?"
+		args = append(args, *status)
+	}
+
+	var total int64
+	countQuery := "SELECT COUNT(*) FROM coupons " + where
+	if err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("统计优惠券失败: %w", err)
+	}
+
+	query := `
+		SELECT ` + couponColumns + `
+		FROM coupons
+		` + where + `
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	coupons, err := r.queryCoupons(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return coupons, total, nil
+}
+
+// queryCoupons 查询优惠券列表
+func (r *MySQLRepository) queryCoupons(ctx context.Context, query string, args ...any) ([]*Coupon, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询优惠券失败: %w", err)
+	}
+	defer rows.Close()
+
+	var coupons []*Coupon
+	for rows.Next() {
+		coupon, err := scanCoupon(rows)
+		if err != nil {
+			return nil, fmt.Errorf("解析优惠券失败: %w", err)
+		}
+		coupons = append(coupons, coupon)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历优惠券失败: %w", err)
+	}
+
+	return coupons, nil
+}
+
+// CreateCoupon 创建优惠券
+func (r *MySQLRepository) CreateCoupon(ctx context.Context, coupon *Coupon) error {
+	query := `
+		INSERT INTO coupons (name, description, total_stock, remain_stock, stock_buckets,
+		                     start_time, end_time, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		coupon.Name,
+		coupon.Description,
+		coupon.TotalStock,
+		coupon.RemainStock,
+		coupon.StockBuckets,
+		coupon.StartTime,
+		coupon.EndTime,
+		coupon.Status,
+	)
+	if err != nil {
+		return fmt.Errorf("创建优惠券失败: %w", err)
+	}
+
+	couponID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("获取优惠券ID失败: %w", err)
+	}
+
+	coupon.ID = couponID
+	return nil
+}
+
+// UpdateCoupon 更新优惠券基本信息、分桶数、活动时间和状态（库存通过 AdjustCouponStock 修改）
+func (r *MySQLRepository) UpdateCoupon(ctx context.Context, coupon *Coupon) error {
+	query := `
+		UPDATE coupons
+		SET name = ?,
+		    description = ?,
+		    stock_buckets = ?,
+		    start_time = ?,
+		    end_time = ?,
+		    status = ?,
+		    updated_at = NOW()
+		WHERE id = ? AND deleted_at IS NULL
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		coupon.Name,
+		coupon.Description,
+		coupon.StockBuckets,
+		coupon.StartTime,
+		coupon.EndTime,
+		coupon.Status,
+		coupon.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("更新优惠券失败: %w", err)
+	}
+
+	return nil
+}
+
+// AdjustCouponStock 调整总库存，剩余库存同步增减（剩余库存不足时返回 ErrStockNotEnough）
+func (r *MySQLRepository) AdjustCouponStock(ctx context.Context, couponID int64, delta int64) error {
+	query := `
+		UPDATE coupons
+		SET total_stock = total_stock + ?,
+		    remain_stock = remain_stock + ?,
+		    updated_at = NOW()
+		WHERE id = ? AND deleted_at IS NULL AND remain_stock + ? >= 0
+	`
+
+	result, err := r.db.ExecContext(ctx, query, delta, delta, couponID, delta)
+	if err != nil {
+		return fmt.Errorf("调整库存失败: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("获取影响行数失败: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrStockNotEnough
+	}
+
+	return nil
+}
+
+// DeleteCoupon 软删除优惠券
+func (r *MySQLRepository) DeleteCoupon(ctx context.Context, couponID int64) error {
+	query := `
+		UPDATE coupons
+		SET deleted_at = NOW(),
+		    updated_at = NOW()
+		WHERE id = ? AND deleted_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, couponID)
+	if err != nil {
+		return fmt.Errorf("删除优惠券失败: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("获取影响行数失败: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrCouponNotFound
+	}
+
+	return nil
+}
+
+// ListCouponsToSchedule 获取需要调度的优惠券：未开始且开始时间不晚于 startBefore，或进行中且结束时间不晚于 endBefore
+func (r *MySQLRepository) ListCouponsToSchedule(ctx context.Context, startBefore, endBefore time.Time) ([]*Coupon, error) {
+	query := `
+		SELECT ` + couponColumns + `
+		FROM coupons
+		WHERE deleted_at IS NULL
+		  AND ((status = ? AND start_time <= ?) OR (status = ? AND end_time <= ?))
+	`
+
+	return r.queryCoupons(ctx, query, CouponNotStarted, startBefore, CouponActive, endBefore)
+}
+
+// UpdateCouponStatus 将优惠券状态从 from 改为 to（乐观更新，当前状态不是 from 时返回 ErrCouponStatusInvalid）
+func (r *MySQLRepository) UpdateCouponStatus(ctx context.Context, couponID int64, from, to int) error {
+	query := `
+		UPDATE coupons
+		SET status = ?, updated_at = NOW()
+		WHERE id = ? AND status = ? AND deleted_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, to, couponID, from)
+	if err != nil {
+		return fmt.Errorf("更新优惠券状态失败: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("获取影响行数失败: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrCouponStatusInvalid
+	}
+
+	return nil
+}
+
+// CountOrders 统计优惠券的有效订单数和已归还库存的订单数（已取消、已退款）
+func (r *MySQLRepository) CountOrders(ctx context.Context, couponID int64) (active int64, cancelled int64, err error) {
+	query := `
+		SELECT COALESCE(SUM(status NOT IN (?, ?)), 0), COALESCE(SUM(status IN (?, ?)), 0)
+		FROM orders
+		WHERE coupon_id = ?
+	`
+
+	err = r.db.QueryRowContext(ctx, query, OrderCancelled, OrderRefunded, OrderCancelled, OrderRefunded, couponID).Scan(&active, &cancelled)
+	if err != nil {
+		return 0, 0, fmt.Errorf("统计订单数失败: %w", err)
+	}
+
+	return active, cancelled, nil
+}
+
+// RepairRemainStock 按有效订单数修正 MySQL 剩余库存（单条语句，基于当前订单数原子计算）
+func (r *MySQLRepository) RepairRemainStock(ctx context.Context, couponID int64) error {
+	query := `
+		UPDATE coupons
+		SET remain_stock = total_stock - (
+		        SELECT COUNT(*) FROM orders WHERE coupon_id = ? AND status NOT IN (?, ?)
+		    ),
+		    updated_at = NOW()
+		WHERE id = ?
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, couponID, OrderCancelled, OrderRefunded, couponID); err != nil {
+		return fmt.Errorf("修正库存失败: %w", err)
+	}
+
+	return nil
 }
 
 // DecrStock 减少库存（使用乐观锁防止超卖）
@@ -77,28 +353,84 @@ func (r *MySQLRepository) DecrStock(ctx context.Context, couponID int64) error {
 	return nil
 }
 
-// CreateOrder 创建订单
+// CreateOrder 创建订单（使用秒杀时生成的订单ID）
 func (r *MySQLRepository) CreateOrder(ctx context.Context, order *Order) error {
 	query := `
-		INSERT INTO orders (user_id, coupon_id, status, created_at, updated_at)
-		VALUES (?, ?, ?, NOW(), NOW())
+		INSERT INTO orders (id, user_id, coupon_id, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, NOW(), NOW())
 	`
 
-	result, err := r.db.ExecContext(ctx, query, order.UserID, order.CouponID, order.Status)
+	// 订单ID由 Snowflake 生成后显式插入
+	if _, err := r.db.ExecContext(ctx, query, order.ID, order.UserID, order.CouponID, order.Status); err != nil {
+		return fmt.Errorf("创建订单失败: %w", err)
+	}
+
+	return nil
+}
+
+// CreateOrderWithStock 在同一事务中扣减库存并创建订单
+// 订单ID由秒杀时生成，先插入订单再扣减库存：重复消息在主键或 uk_user_coupon
+// 冲突时直接返回，不会锁住优惠券行
+func (r *MySQLRepository) CreateOrderWithStock(ctx context.Context, order *Order) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+				err = fmt.Errorf("%w (回滚事务失败: %v)", err, rbErr)
+			}
+		}
+	}()
+
+	// 1. 创建订单（使用秒杀时生成的订单ID）
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO orders (id, user_id, coupon_id, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, NOW(), NOW())
+	`, order.ID, order.UserID, order.CouponID, order.Status)
+	if err != nil {
+		if isDuplicateOrder(err) {
+			return ErrOrderExists
+		}
 		return fmt.Errorf("创建订单失败: %w", err)
 	}
 
-	// 获取插入的订单ID
-	orderID, err := result.LastInsertId()
+	// 2. 扣减库存（乐观锁防止超卖）
+	result, err := tx.ExecContext(ctx, `
+		UPDATE coupons
+		SET remain_stock = remain_stock - 1,
+		    updated_at = NOW()
+		WHERE id = ? AND remain_stock > 0
+	`, order.CouponID)
 	if err != nil {
-		return fmt.Errorf("获取订单ID失败: %w", err)
+		return fmt.Errorf("扣减库存失败: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("获取影响行数失败: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrStockNotEnough
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
 	}
 
-	order.ID = orderID
 	return nil
 }
 
+// isDuplicateOrder 判断是否为订单主键或 uk_user_coupon 唯一键冲突
+func isDuplicateOrder(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != mysqlErrDupEntry {
+		return false
+	}
+	return strings.Contains(mysqlErr.Message, "uk_user_coupon") || strings.Contains(mysqlErr.Message, "PRIMARY")
+}
+
 // GetOrder 获取订单
 func (r *MySQLRepository) GetOrder(ctx context.Context, orderID int64) (*Order, error) {
 	query := `
@@ -118,7 +450,7 @@ func (r *MySQLRepository) GetOrder(ctx context.Context, orderID int64) (*Order,
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("订单不存在")
+		return nil, ErrOrderNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("查询订单失败: %w", err)
@@ -127,18 +459,247 @@ func (r *MySQLRepository) GetOrder(ctx context.Context, orderID int64) (*Order,
 	return &order, nil
 }
 
-// UpdateOrderStatus 更新订单状态
-func (r *MySQLRepository) UpdateOrderStatus(ctx context.Context, orderID int64, status int) error {
+// ListOrdersByUser 获取用户的订单列表（按创建时间倒序）
+func (r *MySQLRepository) ListOrdersByUser(ctx context.Context, userID int64) ([]*Order, error) {
 	query := `
+		SELECT id, user_id, coupon_id, status, created_at, updated_at
+		FROM orders
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("查询用户订单失败: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []*Order
+	for rows.Next() {
+		var order Order
+		if err := rows.Scan(
+			&order.ID,
+			&order.UserID,
+			&order.CouponID,
+			&order.Status,
+			&order.CreatedAt,
+			&order.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("解析订单失败: %w", err)
+		}
+		orders = append(orders, &order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历订单失败: %w", err)
+	}
+
+	return orders, nil
+}
+
+// TransitionOrder 按订单状态机变更订单状态
+// UPDATE ... WHERE status = From 做乐观并发控制，与状态变更日志、库存归还在同一事务中提交
+func (r *MySQLRepository) TransitionOrder(ctx context.Context, t *OrderTransition) (order *Order, err error) {
+	if err := validateOrderTransition(t.From, t.To); err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+				err = fmt.Errorf("%w (回滚事务失败: %v)", err, rbErr)
+			}
+		}
+	}()
+
+	// 1. 只有当前状态仍为 From 时才变更，并发的其他变更会使影响行数为 0
+	result, err := tx.ExecContext(ctx, `
 		UPDATE orders
 		SET status = ?,
 		    updated_at = NOW()
+		WHERE id = ? AND status = ?
+	`, t.To, t.OrderID, t.From)
+	if err != nil {
+		return nil, fmt.Errorf("更新订单状态失败: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("获取影响行数失败: %w", err)
+	}
+	if rowsAffected == 0 {
+		// 在同一事务中区分订单不存在和状态不匹配
+		var exists int
+		err = tx.QueryRowContext(ctx, `SELECT 1 FROM orders WHERE id = ?`, t.OrderID).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrderNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("查询订单失败: %w", err)
+		}
+		return nil, ErrOrderStatusInvalid
+	}
+
+	// 2. 读取变更后的订单（行锁已由 UPDATE 持有）
+	order = &Order{}
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, user_id, coupon_id, status, created_at, updated_at
+		FROM orders
 		WHERE id = ?
+	`, t.OrderID).Scan(
+		&order.ID,
+		&order.UserID,
+		&order.CouponID,
+		&order.Status,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("查询订单失败: %w", err)
+	}
+
+	// 3. 写入状态变更日志
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO order_status_log (order_id, from_status, to_status, reason, actor, created_at)
+		VALUES (?, ?, ?, ?, ?, NOW())
+	`, t.OrderID, t.From, t.To, t.Reason, t.Actor); err != nil {
+		return nil, fmt.Errorf("写入订单状态日志失败: %w", err)
+	}
+
+	// 4. 取消或退款时归还库存
+	if releasesStock(t.To) {
+		if _, err = tx.ExecContext(ctx, `
+			UPDATE coupons
+			SET remain_stock = remain_stock + 1,
+			    updated_at = NOW()
+			WHERE id = ?
+		`, order.CouponID); err != nil {
+			return nil, fmt.Errorf("归还库存失败: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %w", err)
+	}
+
+	return order, nil
+}
+
+// ListOrderStatusLogs 获取订单的状态变更日志（按时间正序）
+func (r *MySQLRepository) ListOrderStatusLogs(ctx context.Context, orderID int64) ([]*OrderStatusLog, error) {
+	query := `
+		SELECT id, order_id, from_status, to_status, reason, actor, created_at
+		FROM order_status_log
+		WHERE order_id = ?
+		ORDER BY id ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("查询订单状态日志失败: %w", err)
+	}
+	defer rows.Close()
+
+	var logs []*OrderStatusLog
+	for rows.Next() {
+		var l OrderStatusLog
+		if err := rows.Scan(&l.ID, &l.OrderID, &l.FromStatus, &l.ToStatus, &l.Reason, &l.Actor, &l.CreatedAt); err != nil {
+			return nil, fmt.Errorf("解析订单状态日志失败: %w", err)
+		}
+		logs = append(logs, &l)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历订单状态日志失败: %w", err)
+	}
+
+	return logs, nil
+}
+
+// SaveCompensationTask 保存补偿任务
+func (r *MySQLRepository) SaveCompensationTask(ctx context.Context, task *CompensationTask) error {
+	query := `
+		INSERT INTO compensation_tasks (user_id, coupon_id, order_id, order_created_at, status, retry_count, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, NOW(), NOW())
 	`
 
-	result, err := r.db.ExecContext(ctx, query, status, orderID)
+	result, err := r.db.ExecContext(ctx, query, task.UserID, task.CouponID, task.OrderID, task.OrderCreatedAt, task.Status, task.RetryCount)
 	if err != nil {
-		return fmt.Errorf("更新订单状态失败: %w", err)
+		return fmt.Errorf("保存补偿任务失败: %w", err)
+	}
+
+	taskID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("获取补偿任务ID失败: %w", err)
+	}
+
+	task.ID = taskID
+	return nil
+}
+
+// GetPendingCompensationTasks 获取退避期已过的待处理任务和处理超时的任务（按最近一次更新时间升序）
+// 退避期（与 compensationBackoff 相同的指数退避）和超时都以数据库时间计算，避免实例与数据库之间的时钟偏差
+func (r *MySQLRepository) GetPendingCompensationTasks(ctx context.Context, limit int, processingTimeout time.Duration) ([]*CompensationTask, error) {
+	query := `
+		SELECT id, user_id, coupon_id, order_id, order_created_at, status, retry_count, created_at, updated_at
+		FROM compensation_tasks
+		WHERE (status = ? AND (retry_count = 0 OR updated_at +
+		          INTERVAL CAST(LEAST(? * POW(2, retry_count - 1), ?) AS UNSIGNED) MICROSECOND <= NOW()))
+		   OR (status = ? AND updated_at < NOW() - INTERVAL ? MICROSECOND)
+		ORDER BY updated_at ASC
+		LIMIT ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query,
+		CompensationPending, compensationBaseBackoff.Microseconds(), compensationMaxBackoff.Microseconds(),
+		CompensationProcessing, processingTimeout.Microseconds(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询补偿任务失败: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []*CompensationTask
+	for rows.Next() {
+		var task CompensationTask
+		if err := rows.Scan(
+			&task.ID,
+			&task.UserID,
+			&task.CouponID,
+			&task.OrderID,
+			&task.OrderCreatedAt,
+			&task.Status,
+			&task.RetryCount,
+			&task.CreatedAt,
+			&task.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("解析补偿任务失败: %w", err)
+		}
+		tasks = append(tasks, &task)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历补偿任务失败: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// UpdateCompensationTaskStatus 更新补偿任务状态
+func (r *MySQLRepository) UpdateCompensationTaskStatus(ctx context.Context, taskID int64, status int, retryCount int) error {
+	query := `
+		UPDATE compensation_tasks
+		SET status = ?,
+		    retry_count = ?,
+		    updated_at = NOW()
+		WHERE id = ?
+	`
+
+	result, err := r.db.ExecContext(ctx, query, status, retryCount, taskID)
+	if err != nil {
+		return fmt.Errorf("更新补偿任务状态失败: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -147,26 +708,143 @@ func (r *MySQLRepository) UpdateOrderStatus(ctx context.Context, orderID int64,
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("订单不存在")
+		return fmt.Errorf("补偿任务不存在")
 	}
 
 	return nil
 }
 
-// SaveCompensationTask 保存补偿任务（暂不实现）
-func (r *MySQLRepository) SaveCompensationTask(ctx context.Context, task *CompensationTask) error {
-	// TODO: 后续实现
+// deadLetterColumns 死信查询列
+const deadLetterColumns = `id, msg_id, topic, tag, msg_keys, payload, error, reconsume_times, status, created_at, updated_at`
+
+// scanDeadLetter 扫描一行死信
+func scanDeadLetter(row rowScanner) (*DeadLetter, error) {
+	var dl DeadLetter
+	err := row.Scan(
+		&dl.ID,
+		&dl.MsgID,
+		&dl.Topic,
+		&dl.Tag,
+		&dl.Keys,
+		&dl.Payload,
+		&dl.Error,
+		&dl.ReconsumeTimes,
+		&dl.Status,
+		&dl.CreatedAt,
+		&dl.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
+
+// SaveDeadLetter 保存死信消息
+func (r *MySQLRepository) SaveDeadLetter(ctx context.Context, dl *DeadLetter) error {
+	query := `
+		INSERT INTO dead_letters (msg_id, topic, tag, msg_keys, payload, error, reconsume_times, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		dl.MsgID, dl.Topic, dl.Tag, dl.Keys, dl.Payload, dl.Error, dl.ReconsumeTimes, dl.Status)
+	if err != nil {
+		return fmt.Errorf("保存死信失败: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("获取死信ID失败: %w", err)
+	}
+
+	dl.ID = id
 	return nil
 }
 
-// GetPendingCompensationTasks 获取待处理的补偿任务（暂不实现）
-func (r *MySQLRepository) GetPendingCompensationTasks(ctx context.Context, limit int) ([]*CompensationTask, error) {
-	// TODO: 后续实现
-	return nil, nil
+// GetDeadLetter 获取死信消息
+func (r *MySQLRepository) GetDeadLetter(ctx context.Context, id int64) (*DeadLetter, error) {
+	query := `SELECT ` + deadLetterColumns + ` FROM dead_letters WHERE id = ?`
+
+	dl, err := scanDeadLetter(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询死信失败: %w", err)
+	}
+
+	return dl, nil
 }
 
-// UpdateCompensationTaskStatus 更新补偿任务状态（暂不实现）
-func (r *MySQLRepository) UpdateCompensationTaskStatus(ctx context.Context, taskID int64, status int, retryCount int) error {
-	// TODO: 后续实现
+// ListDeadLetters 分页获取死信消息
+func (r *MySQLRepository) ListDeadLetters(ctx context.Context, status *int, offset, limit int) ([]*DeadLetter, int64, error) {
+	where := ""
+	var args []any
+	if status != nil {
+		where = "WHERE status = ?"
+		args = append(args, *status)
+	}
+
+	var total int64
+	countQuery := "SELECT COUNT(*) FROM dead_letters " + where
+	if err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("统计死信失败: %w", err)
+	}
+
+	query := `
+		SELECT ` + deadLetterColumns + `
+		FROM dead_letters
+		` + where + `
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询死信失败: %w", err)
+	}
+	defer rows.Close()
+
+	var deadLetters []*DeadLetter
+	for rows.Next() {
+		dl, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("解析死信失败: %w", err)
+		}
+		deadLetters = append(deadLetters, dl)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("遍历死信失败: %w", err)
+	}
+
+	return deadLetters, total, nil
+}
+
+// UpdateDeadLetterStatus 将死信状态从 from 改为 to（乐观更新，死信不存在返回 ErrDeadLetterNotFound，当前状态不是 from 返回 ErrDeadLetterHandled）
+func (r *MySQLRepository) UpdateDeadLetterStatus(ctx context.Context, id int64, from, to int) error {
+	query := `
+		UPDATE dead_letters
+		SET status = ?, updated_at = NOW()
+		WHERE id = ? AND status = ?
+	`
+
+	result, err := r.db.ExecContext(ctx, query, to, id, from)
+	if err != nil {
+		return fmt.Errorf("更新死信状态失败: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("获取影响行数失败: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		if _, err := r.GetDeadLetter(ctx, id); err != nil {
+			return err
+		}
+		return ErrDeadLetterHandled
+	}
+
 	return nil
 }
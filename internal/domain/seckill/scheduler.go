@@ -0,0 +1,183 @@
+package seckill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"rag-agent/config"
+)
+
+// couponScheduleInterval 优惠券生命周期调度间隔
+const couponScheduleInterval = time.Second
+
+// CouponScheduler 优惠券生命周期调度器
+//
+//   - 开始前 WarmupLead：预热 Redis 库存和活动信息（已缓存的库存不覆盖，可重复执行）
+//   - 到达 StartTime：状态 未开始 → 进行中
+//   - 到达 EndTime：状态 进行中 → 已结束，Redis 活动置为已结束，库存相关 key 在 KeyRetention 后过期
+//
+// 只有 leader 实例执行调度；每个优惠券在与管理接口相同的分布式锁内处理，避免互相覆盖状态
+type CouponScheduler struct {
+	repo    Repository
+	cache   CacheRepository
+	locker  Locker
+	elector LeaderElector
+	cfg     *config.SeckillConfig
+
+	interval time.Duration
+	now      func() time.Time
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewCouponScheduler 创建优惠券生命周期调度器
+func NewCouponScheduler(repo Repository, cache CacheRepository, locker Locker, elector LeaderElector, cfg *config.SeckillConfig) *CouponScheduler {
+	return &CouponScheduler{
+		repo:     repo,
+		cache:    cache,
+		locker:   locker,
+		elector:  elector,
+		cfg:      cfg,
+		interval: couponScheduleInterval,
+		now:      time.Now,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start 启动后台调度
+func (s *CouponScheduler) Start(ctx context.Context) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.stopCh:
+				return
+			case <-ticker.C:
+				if err := s.RunOnce(ctx); err != nil {
+					log.Printf("优惠券调度失败: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止后台调度并等待当前批次处理完成
+func (s *CouponScheduler) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+}
+
+// RunOnce 处理一批需要调度的优惠券，当前实例不是 leader 时直接跳过
+func (s *CouponScheduler) RunOnce(ctx context.Context) error {
+	if !s.elector.IsLeader() {
+		return nil
+	}
+
+	now := s.now()
+	coupons, err := s.repo.ListCouponsToSchedule(ctx, now.Add(s.cfg.WarmupLead), now)
+	if err != nil {
+		return err
+	}
+
+	for _, coupon := range coupons {
+		if err := s.schedule(ctx, coupon.ID, now); err != nil {
+			log.Printf("调度优惠券失败: %v, couponID=%d", err, coupon.ID)
+		}
+	}
+
+	return nil
+}
+
+// schedule 在锁内按当前时间推进单个优惠券的生命周期
+func (s *CouponScheduler) schedule(ctx context.Context, couponID int64, now time.Time) error {
+	unlock, err := s.locker.Lock(ctx, fmt.Sprintf("coupon:%d", couponID))
+	if errors.Is(err, ErrLockFailed) {
+		// 管理接口正在修改，下一轮再处理
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// 加锁后重新读取，以最新状态为准
+	coupon, err := s.repo.GetCoupon(ctx, couponID)
+	if errors.Is(err, ErrCouponNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !now.Before(coupon.EndTime) && coupon.Status != CouponEnded:
+		return s.end(ctx, coupon)
+	case coupon.Status == CouponNotStarted:
+		if err := s.warmUp(ctx, coupon); err != nil {
+			return err
+		}
+		if now.Before(coupon.StartTime) {
+			return nil
+		}
+		if err := s.repo.UpdateCouponStatus(ctx, coupon.ID, CouponNotStarted, CouponActive); err != nil {
+			return err
+		}
+		log.Printf("秒杀活动已开始: couponID=%d", coupon.ID)
+	}
+
+	return nil
+}
+
+// warmUp 预热 Redis 库存和活动信息
+// 活动状态直接写为进行中，开始前由 Lua 脚本按开始时间拒绝，到点即可秒杀，不依赖调度延迟
+func (s *CouponScheduler) warmUp(ctx context.Context, coupon *Coupon) error {
+	if err := s.cache.SetActivity(ctx, coupon.ID, coupon.StartTime, coupon.EndTime, CouponActive); err != nil {
+		return err
+	}
+
+	if err := s.cache.SetStockBuckets(ctx, coupon.ID, coupon.StockBuckets); err != nil {
+		return err
+	}
+
+	warmed, err := s.cache.SetStockIfAbsent(ctx, coupon.ID, coupon.RemainStock)
+	if err != nil {
+		return err
+	}
+	if warmed {
+		log.Printf("库存预热完成: couponID=%d, stock=%d", coupon.ID, coupon.RemainStock)
+	}
+	return nil
+}
+
+// end 结束活动：更新状态，Redis 活动置为已结束，并为库存相关 key 设置过期时间
+func (s *CouponScheduler) end(ctx context.Context, coupon *Coupon) error {
+	if err := s.repo.UpdateCouponStatus(ctx, coupon.ID, coupon.Status, CouponEnded); err != nil {
+		return err
+	}
+
+	if err := s.cache.SetActivity(ctx, coupon.ID, coupon.StartTime, coupon.EndTime, CouponEnded); err != nil {
+		return err
+	}
+
+	// 保留一段时间供超时取消归还库存和对账，之后自动清理（未配置时不清理）
+	if s.cfg.KeyRetention > 0 {
+		if err := s.cache.ExpireCouponKeys(ctx, coupon.ID, s.cfg.KeyRetention); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("秒杀活动已结束: couponID=%d", coupon.ID)
+	return nil
+}
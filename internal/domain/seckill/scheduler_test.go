@@ -0,0 +1,88 @@
+package seckill
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rag-agent/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 固定 leader 身份（用于测试）
+type TestElector struct {
+	leader bool
+}
+
+func (e *TestElector) IsLeader() bool {
+	return e.leader
+}
+
+func newTestScheduler(leader bool) (*CouponScheduler, *TestRepository, *TestOrderCache) {
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	cfg := &config.SeckillConfig{WarmupLead: 5 * time.Minute, KeyRetention: time.Hour}
+	return NewCouponScheduler(repo, cache, &TestLocker{}, &TestElector{leader: leader}, cfg), repo, cache
+}
+
+// 测试开始前提前预热库存，到点后状态变为进行中
+func TestCouponScheduler_WarmUpAndStart(t *testing.T) {
+	ctx := context.Background()
+	scheduler, repo, cache := newTestScheduler(true)
+
+	start := time.Now().Add(2 * time.Minute)
+	repo.coupons[1] = &Coupon{ID: 1, TotalStock: 100, RemainStock: 100, StartTime: start, EndTime: start.Add(time.Hour), Status: CouponNotStarted}
+
+	// 提前量之前不处理
+	scheduler.now = func() time.Time { return start.Add(-10 * time.Minute) }
+	require.NoError(t, scheduler.RunOnce(ctx))
+	_, warmed := cache.stocks[1]
+	assert.False(t, warmed)
+
+	// 进入提前量：预热库存，状态不变
+	scheduler.now = func() time.Time { return start.Add(-time.Minute) }
+	require.NoError(t, scheduler.RunOnce(ctx))
+	assert.Equal(t, int64(100), cache.stocks[1])
+	assert.Equal(t, CouponActive, cache.activities[1])
+	assert.Equal(t, CouponNotStarted, repo.coupons[1].Status)
+
+	// 重复预热不覆盖已缓存的库存
+	cache.stocks[1] = 99
+	require.NoError(t, scheduler.RunOnce(ctx))
+	assert.Equal(t, int64(99), cache.stocks[1])
+
+	// 到达开始时间
+	scheduler.now = func() time.Time { return start }
+	require.NoError(t, scheduler.RunOnce(ctx))
+	assert.Equal(t, CouponActive, repo.coupons[1].Status)
+}
+
+// 测试到达结束时间后结束活动并设置 key 过期
+func TestCouponScheduler_End(t *testing.T) {
+	ctx := context.Background()
+	scheduler, repo, cache := newTestScheduler(true)
+
+	end := time.Now()
+	repo.coupons[1] = &Coupon{ID: 1, TotalStock: 100, StartTime: end.Add(-time.Hour), EndTime: end, Status: CouponActive}
+
+	scheduler.now = func() time.Time { return end }
+	require.NoError(t, scheduler.RunOnce(ctx))
+
+	assert.Equal(t, CouponEnded, repo.coupons[1].Status)
+	assert.Equal(t, CouponEnded, cache.activities[1])
+	assert.Equal(t, time.Hour, cache.expires[1])
+}
+
+// 测试非 leader 实例不调度
+func TestCouponScheduler_NotLeader(t *testing.T) {
+	ctx := context.Background()
+	scheduler, repo, cache := newTestScheduler(false)
+
+	repo.coupons[1] = &Coupon{ID: 1, TotalStock: 100, StartTime: time.Now().Add(-time.Minute), EndTime: time.Now().Add(time.Hour), Status: CouponNotStarted}
+
+	require.NoError(t, scheduler.RunOnce(ctx))
+	assert.Equal(t, CouponNotStarted, repo.coupons[1].Status)
+	assert.Empty(t, cache.stocks)
+}
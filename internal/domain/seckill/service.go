@@ -3,15 +3,42 @@ package seckill
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"rag-agent/config"
+	"rag-agent/internal/infrastructure/mq"
+	"sort"
+	"time"
 )
 
+// processingMarkerTTL 订单处理中标记的有效期，需覆盖 MQ 投递和补偿重试的最长耗时
+const processingMarkerTTL = time.Hour
+
+// orderDeductionTTL 订单扣减记录的有效期，需覆盖事务消息回查的时间窗口
+const orderDeductionTTL = 24 * time.Hour
+
 var (
-	ErrStockNotEnough = errors.New("库存不足")
-	ErrCouponNotFound = errors.New("优惠券不存在")
-	ErrCouponExpired  = errors.New("优惠券已过期")
-	ErrLockFailed     = errors.New("获取锁失败")
+	ErrStockNotEnough      = errors.New("库存不足")
+	ErrCouponNotFound      = errors.New("优惠券不存在")
+	ErrCouponExpired       = errors.New("优惠券已过期")
+	ErrCouponInvalid       = errors.New("优惠券参数错误")
+	ErrCouponStatusInvalid = errors.New("优惠券状态不允许该操作")
+	ErrLockFailed          = errors.New("获取锁失败")
+	ErrOrderExists         = errors.New("订单已存在")
+	ErrOrderNotFound       = errors.New("订单不存在")
+	ErrOrderStatusInvalid  = errors.New("订单状态不允许该操作")
+	ErrAlreadyBought       = errors.New("已抢购过该优惠券")
+	ErrNotStarted          = errors.New("秒杀活动未开始")
+	ErrEnded               = errors.New("秒杀活动已结束")
+	ErrNotAdmitted         = errors.New("尚未轮到，请先排队")
+	ErrNotInQueue          = errors.New("不在排队队列中")
+	ErrTokenInvalid        = errors.New("秒杀令牌无效")
+	ErrTokenExpired        = errors.New("秒杀令牌已过期")
+	ErrTokenUsed           = errors.New("秒杀令牌已使用")
+	ErrDeadLetterNotFound  = errors.New("死信不存在")
+	ErrDeadLetterHandled   = errors.New("死信已处理")
+	ErrDeadLetterInvalid   = errors.New("死信消息体无法解析为订单")
+	ErrLocalTxNotExecuted  = errors.New("本地事务未执行")
 )
 
 // Service 秒杀服务
@@ -19,28 +46,143 @@ type Service struct {
 	repo       Repository
 	cache      CacheRepository
 	mqProducer MQProducer
+	idGen      IDGenerator
+	locker     Locker
 	cfg        *config.SeckillConfig
+
+	soldOut *soldOutCache
+	tokens  *tokenSigner
 }
 
 // MQProducer 消息队列生产者接口
 type MQProducer interface {
 	SendOrderMessage(ctx context.Context, order *Order) error
+	// SendOrderMessageOrderly 按优惠券顺序发送订单消息，同一优惠券的消息进入同一队列
+	SendOrderMessageOrderly(ctx context.Context, order *Order) error
+	// SendOrderMessages 批量发送订单消息，全部成功或全部失败
+	SendOrderMessages(ctx context.Context, orders []*Order) error
+	// SendOrderMessageAsync 异步发送订单消息，发送结果通过 callback 通知；返回错误时不会调用 callback
+	SendOrderMessageAsync(ctx context.Context, order *Order, callback func(err error)) error
+}
+
+// TransactionalMQProducer 支持事务消息的订单消息生产者
+// 秒杀在事务消息的本地事务中扣减 Redis 库存：扣减成功提交消息，失败回滚，结果未知时由回查决定
+type TransactionalMQProducer interface {
+	MQProducer
+	// SendOrderMessageInTransaction 发送订单半消息，执行本地事务 execute 并按返回状态提交或回滚
+	SendOrderMessageInTransaction(ctx context.Context, order *Order, execute func(ctx context.Context) mq.TransactionState) (mq.TransactionState, error)
+}
+
+// IDGenerator 订单 ID 生成器接口（分布式唯一）
+type IDGenerator interface {
+	NextID() (int64, error)
 }
 
 // NewService 创建秒杀服务
-func NewService(repo Repository, cache CacheRepository, mq MQProducer, cfg *config.SeckillConfig) *Service {
+func NewService(repo Repository, cache CacheRepository, mq MQProducer, idGen IDGenerator, locker Locker, cfg *config.SeckillConfig) *Service {
 	return &Service{
 		repo:       repo,
 		cache:      cache,
 		mqProducer: mq,
+		idGen:      idGen,
+		locker:     locker,
 		cfg:        cfg,
+		soldOut:    newSoldOutCache(soldOutTTL),
+		tokens:     newTokenSigner(cfg.TokenSecret),
+	}
+}
+
+// deductionFailed 将库存扣减脚本的失败返回码（负数）转换为秒杀响应
+func (s *Service) deductionFailed(couponID, stock int64) (*SeckillResponse, error) {
+	switch stock {
+	case activityNotStart:
+		return &SeckillResponse{
+			Success: false,
+			Message: "秒杀活动未开始",
+		}, ErrNotStarted
+	case activityEnded:
+		return &SeckillResponse{
+			Success: false,
+			Message: "秒杀活动已结束",
+		}, ErrEnded
+	case alreadyPurchased:
+		return &SeckillResponse{
+			Success: false,
+			Message: "每人限抢一张",
+		}, ErrAlreadyBought
+	default:
+		s.soldOut.mark(couponID, time.Now())
+		return &SeckillResponse{
+			Success: false,
+			Message: "库存不足",
+		}, ErrStockNotEnough
 	}
 }
 
 // Seckill 秒杀接口
 func (s *Service) Seckill(ctx context.Context, req *SeckillRequest) (*SeckillResponse, error) {
-	// 1. 使用 Lua 脚本原子性扣减库存
-	stock, err := s.cache.DecrStock(ctx, req.CouponID)
+	// 开启令牌校验时先在本地校验签名，伪造和过期的令牌不访问 Redis
+	var (
+		tokenNonce    string
+		tokenExpireAt time.Time
+	)
+	if s.cfg.TokenEnabled {
+		var err error
+		tokenNonce, tokenExpireAt, err = s.verifyToken(req, time.Now())
+		if err != nil {
+			return &SeckillResponse{
+				Success: false,
+				Message: err.Error(),
+			}, err
+		}
+	}
+
+	// 0. 本地已标记售罄，直接拒绝，不访问 Redis
+	if s.soldOut.isSoldOut(req.CouponID, time.Now()) {
+		return &SeckillResponse{
+			Success: false,
+			Message: "库存不足",
+		}, ErrStockNotEnough
+	}
+
+	// 排队模式下只有已放行的用户才能进入库存扣减
+	if s.cfg.QueueEnabled {
+		admitted, err := s.cache.IsAdmitted(ctx, req.CouponID, req.UserID, time.Now())
+		if err != nil {
+			return &SeckillResponse{
+				Success: false,
+				Message: "系统错误",
+			}, err
+		}
+		if !admitted {
+			return &SeckillResponse{
+				Success: false,
+				Message: "尚未轮到，请先排队",
+			}, ErrNotAdmitted
+		}
+	}
+
+	// 令牌一次性使用，重放的请求在扣减库存前拒绝
+	if s.cfg.TokenEnabled {
+		if err := s.consumeToken(ctx, tokenNonce, tokenExpireAt); err != nil {
+			message := "系统错误"
+			if errors.Is(err, ErrTokenUsed) {
+				message = err.Error()
+			}
+			return &SeckillResponse{
+				Success: false,
+				Message: message,
+			}, err
+		}
+	}
+
+	// 生产者支持事务消息时，库存扣减在事务消息的本地事务中执行，扣减成功与订单消息提交一一对应
+	if producer, ok := s.mqProducer.(TransactionalMQProducer); ok {
+		return s.seckillInTransaction(ctx, producer, req)
+	}
+
+	// 1. 使用 Lua 脚本原子性校验活动时间、一人一单并扣减库存
+	stock, err := s.cache.DecrStock(ctx, req.CouponID, req.UserID)
 	if err != nil {
 		return &SeckillResponse{
 			Success: false,
@@ -48,29 +190,66 @@ func (s *Service) Seckill(ctx context.Context, req *SeckillRequest) (*SeckillRes
 		}, err
 	}
 
-	// 2. 检查库存是否充足（Lua 脚本返回 -1 表示库存不足）
+	// 2. 检查活动时间（-3/-4）、是否重复购买（-2）以及库存是否充足（-1）
 	if stock < 0 {
+		return s.deductionFailed(req.CouponID, stock)
+	}
+
+	// 3. 生成订单ID并创建订单，客户端可以立即用该ID查询订单
+	orderID, err := s.idGen.NextID()
+	if err != nil {
+		log.Printf("生成订单ID失败: %v, 回滚Redis库存", err)
+		if revertErr := s.cache.RevertStock(ctx, req.CouponID, req.UserID); revertErr != nil {
+			log.Printf("回滚库存失败: %v", revertErr)
+		}
 		return &SeckillResponse{
 			Success: false,
-			Message: "库存不足",
-		}, ErrStockNotEnough
+			Message: "系统错误",
+		}, err
 	}
 
-	// 3. 创建订单
 	order := &Order{
-		UserID:   req.UserID,
-		CouponID: req.CouponID,
-		Status:   0, // 待支付
+		ID:        orderID,
+		UserID:    req.UserID,
+		CouponID:  req.CouponID,
+		Status:    OrderPending,
+		CreatedAt: time.Now(),
 	}
 
-	// 4. 发送到MQ
+	// 4. 写入处理中标记，供客户端轮询订单状态（由 OrderConsumer 落库后清除）
+	if markErr := s.cache.SetOrderProcessing(ctx, order, processingMarkerTTL); markErr != nil {
+		log.Printf("写入订单处理中标记失败: %v, orderID=%d", markErr, order.ID)
+	}
+
+	// 5. 发送到MQ
 	err = s.mqProducer.SendOrderMessage(ctx, order)
 	if err != nil {
-		log.Printf("发送MQ失败: %v, 回滚Redis库存", err)
+		log.Printf("发送MQ失败: %v, 写入补偿任务", err)
+
+		// 写入补偿任务，由 CompensationWorker 重新投递，避免短暂故障丢失用户的秒杀结果
+		task := &CompensationTask{
+			UserID:         order.UserID,
+			CouponID:       order.CouponID,
+			OrderID:        order.ID,
+			OrderCreatedAt: order.CreatedAt,
+			Status:         CompensationPending,
+		}
+		saveErr := s.repo.SaveCompensationTask(ctx, task)
+		if saveErr == nil {
+			return &SeckillResponse{
+				Success: true,
+				Message: "秒杀成功，订单处理中",
+				OrderID: order.ID,
+			}, nil
+		}
+		log.Printf("保存补偿任务失败: %v, 回滚Redis库存", saveErr)
 
-		// 原子性回滚 Redis 库存（+1）
-		if incrErr := s.cache.IncrStock(ctx, req.CouponID, 1); incrErr != nil {
-			log.Printf("回滚库存失败: %v", incrErr)
+		// 补偿任务也无法保存，原子性回滚 Redis 库存（+1）并移出已购用户集合
+		if revertErr := s.cache.RevertStock(ctx, req.CouponID, req.UserID); revertErr != nil {
+			log.Printf("回滚库存失败: %v", revertErr)
+		}
+		if clearErr := s.cache.ClearOrderProcessing(ctx, order); clearErr != nil {
+			log.Printf("清除订单处理中标记失败: %v", clearErr)
 		}
 
 		// 返回失败
@@ -80,7 +259,7 @@ func (s *Service) Seckill(ctx context.Context, req *SeckillRequest) (*SeckillRes
 		}, err
 	}
 
-	// 5. 发送成功
+	// 6. 发送成功
 	return &SeckillResponse{
 		Success: true,
 		Message: "秒杀成功，订单处理中",
@@ -88,17 +267,149 @@ func (s *Service) Seckill(ctx context.Context, req *SeckillRequest) (*SeckillRes
 	}, nil
 }
 
+// WatchStockRestored 订阅库存归还通知并清除本地售罄标记，阻塞直到 ctx 结束
+func (s *Service) WatchStockRestored(ctx context.Context) error {
+	couponIDs, err := s.cache.SubscribeStockRestored(ctx)
+	if err != nil {
+		return err
+	}
+
+	for couponID := range couponIDs {
+		s.soldOut.clear(couponID)
+	}
+	return nil
+}
+
 // GetCoupon 获取优惠券信息
 func (s *Service) GetCoupon(ctx context.Context, couponID int64) (*Coupon, error) {
 	return s.repo.GetCoupon(ctx, couponID)
 }
 
-// InitStock 初始化库存到Redis
+// PayOrder 支付订单：待支付 → 已支付，并移除支付超时登记
+func (s *Service) PayOrder(ctx context.Context, orderID int64) error {
+	_, err := s.repo.TransitionOrder(ctx, &OrderTransition{
+		OrderID: orderID,
+		From:    OrderPending,
+		To:      OrderPaid,
+		Reason:  "用户支付",
+		Actor:   OrderActorUser,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.cache.RemoveOrderTimeout(ctx, orderID); err != nil {
+		// 超时取消时会校验订单状态，移除失败不影响正确性
+		log.Printf("移除订单超时登记失败: %v, orderID=%d", err, orderID)
+	}
+	return nil
+}
+
+// GetOrder 查询订单状态
+// 订单已落库时以 MySQL 为准，否则查看 Redis 处理中标记
+func (s *Service) GetOrder(ctx context.Context, orderID int64) (*OrderResponse, error) {
+	order, err := s.repo.GetOrder(ctx, orderID)
+	if err == nil {
+		return newOrderResponse(order, false), nil
+	}
+	if !errors.Is(err, ErrOrderNotFound) {
+		return nil, err
+	}
+
+	processing, err := s.cache.GetProcessingOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if processing == nil {
+		return nil, ErrOrderNotFound
+	}
+	return newOrderResponse(processing, true), nil
+}
+
+// ListUserOrders 查询用户的订单列表（包含处理中的订单，按创建时间倒序）
+func (s *Service) ListUserOrders(ctx context.Context, userID int64) ([]*OrderResponse, error) {
+	orders, err := s.repo.ListOrdersByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	processing, err := s.cache.ListProcessingOrders(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*OrderResponse, 0, len(orders)+len(processing))
+	persisted := make(map[int64]struct{}, len(orders))
+	for _, order := range orders {
+		persisted[order.ID] = struct{}{}
+		result = append(result, newOrderResponse(order, false))
+	}
+	for _, order := range processing {
+		// 已落库但标记尚未清除的订单以 MySQL 为准
+		if _, ok := persisted[order.ID]; ok {
+			continue
+		}
+		result = append(result, newOrderResponse(order, true))
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result, nil
+}
+
+// newOrderResponse 构建订单查询响应
+func newOrderResponse(order *Order, processing bool) *OrderResponse {
+	resp := &OrderResponse{
+		OrderID:   order.ID,
+		UserID:    order.UserID,
+		CouponID:  order.CouponID,
+		Status:    order.Status,
+		CreatedAt: order.CreatedAt,
+	}
+
+	switch {
+	case processing:
+		resp.State = OrderStateProcessing
+	case order.Status == OrderPaid:
+		resp.State = OrderStatePaid
+	case order.Status == OrderCancelled:
+		resp.State = OrderStateCancelled
+	case order.Status == OrderRefunded:
+		resp.State = OrderStateRefunded
+	default:
+		resp.State = OrderStatePending
+	}
+	return resp
+}
+
+// InitStock 初始化库存和活动信息到Redis
+// 在分布式锁内执行，避免多个实例同时覆盖库存
 func (s *Service) InitStock(ctx context.Context, couponID int64) error {
+	unlock, err := s.locker.Lock(ctx, fmt.Sprintf("init-stock:%d", couponID))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	coupon, err := s.repo.GetCoupon(ctx, couponID)
 	if err != nil {
 		return err
 	}
 
-	return s.cache.SetStock(ctx, couponID, coupon.RemainStock)
+	if err := s.cache.SetActivity(ctx, couponID, coupon.StartTime, coupon.EndTime, coupon.Status); err != nil {
+		return err
+	}
+
+	if err := s.cache.SetStockBuckets(ctx, couponID, coupon.StockBuckets); err != nil {
+		return err
+	}
+
+	if err := s.cache.SetStock(ctx, couponID, coupon.RemainStock); err != nil {
+		return err
+	}
+
+	// 本实例立即生效，其他实例通过库存归还通知清除
+	s.soldOut.clear(couponID)
+	return nil
 }
@@ -2,7 +2,11 @@ package seckill
 
 import (
 	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"rag-agent/config"
 
@@ -12,7 +16,7 @@ import (
 )
 
 // 设置测试环境
-func setupTestEnv(t *testing.T) (CacheRepository, *redis.Client, func()) {
+func setupTestEnv(t testing.TB) (CacheRepository, *redis.Client, func()) {
 	// 连接 Redis
 	client := redis.NewClient(&redis.Options{
 		Addr: "localhost:6379",
@@ -42,13 +46,746 @@ func setupTestEnv(t *testing.T) (CacheRepository, *redis.Client, func()) {
 
 // 简单的 MQ Producer（用于测试）
 type TestMQProducer struct {
+	mu         sync.Mutex
 	shouldFail bool
+	sent       []*Order
+	batches    int
 }
 
 func (p *TestMQProducer) SendOrderMessage(ctx context.Context, order *Order) error {
 	if p.shouldFail {
 		return assert.AnError
 	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sent = append(p.sent, order)
+	return nil
+}
+
+func (p *TestMQProducer) SendOrderMessageOrderly(ctx context.Context, order *Order) error {
+	return p.SendOrderMessage(ctx, order)
+}
+
+func (p *TestMQProducer) SendOrderMessages(ctx context.Context, orders []*Order) error {
+	if p.shouldFail {
+		return assert.AnError
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.batches++
+	p.sent = append(p.sent, orders...)
+	return nil
+}
+
+func (p *TestMQProducer) SendOrderMessageAsync(ctx context.Context, order *Order, callback func(err error)) error {
+	err := p.SendOrderMessage(ctx, order)
+	go callback(err)
+	return nil
+}
+
+// 自增 ID 生成器（用于测试）
+type TestIDGenerator struct {
+	next int64
+}
+
+func (g *TestIDGenerator) NextID() (int64, error) {
+	return atomic.AddInt64(&g.next, 1), nil
+}
+
+// 只实现订单相关方法的内存缓存（用于不依赖 Redis 的测试，其余方法未实现）
+type TestOrderCache struct {
+	CacheRepository
+	mu         sync.Mutex
+	stocks     map[int64]int64
+	bought     map[int64]int64
+	processing map[int64]*Order
+	timeouts   map[int64]time.Time
+	activities map[int64]int
+	windows    map[int64][2]time.Time
+	expires    map[int64]time.Duration
+	buckets    map[int64]int
+	decrCalls  int
+	restored   chan int64
+	queues     map[int64][]int64
+	admitted   map[int64]map[int64]time.Time
+	tokens     map[string]time.Time
+	deductions map[int64]bool
+}
+
+func NewTestOrderCache() *TestOrderCache {
+	return &TestOrderCache{
+		stocks:     make(map[int64]int64),
+		bought:     make(map[int64]int64),
+		processing: make(map[int64]*Order),
+		timeouts:   make(map[int64]time.Time),
+		activities: make(map[int64]int),
+		windows:    make(map[int64][2]time.Time),
+		expires:    make(map[int64]time.Duration),
+		buckets:    make(map[int64]int),
+		restored:   make(chan int64),
+		queues:     make(map[int64][]int64),
+		admitted:   make(map[int64]map[int64]time.Time),
+		tokens:     make(map[string]time.Time),
+		deductions: make(map[int64]bool),
+	}
+}
+
+func (c *TestOrderCache) GetStock(ctx context.Context, couponID int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stocks[couponID], nil
+}
+
+func (c *TestOrderCache) CountBoughtUsers(ctx context.Context, couponID int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bought[couponID], nil
+}
+
+func (c *TestOrderCache) IncrStock(ctx context.Context, couponID int64, delta int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stocks[couponID] += delta
+	return nil
+}
+
+func (c *TestOrderCache) SetStock(ctx context.Context, couponID int64, stock int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stocks[couponID] = stock
+	return nil
+}
+
+func (c *TestOrderCache) DecrStock(ctx context.Context, couponID, userID int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.decrCalls++
+	if c.stocks[couponID] <= 0 {
+		return stockNotEnough, nil
+	}
+	c.stocks[couponID]--
+	c.bought[couponID]++
+	return c.stocks[couponID], nil
+}
+
+func (c *TestOrderCache) DecrStockForOrder(ctx context.Context, couponID, userID, orderID int64) (int64, error) {
+	stock, err := c.DecrStock(ctx, couponID, userID)
+	if err == nil && stock >= 0 {
+		c.mu.Lock()
+		c.deductions[orderID] = true
+		c.mu.Unlock()
+	}
+	return stock, err
+}
+
+func (c *TestOrderCache) HasOrderDeduction(ctx context.Context, orderID int64) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deductions[orderID], nil
+}
+
+func (c *TestOrderCache) SubscribeStockRestored(ctx context.Context) (<-chan int64, error) {
+	couponIDs := make(chan int64)
+	go func() {
+		defer close(couponIDs)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case couponID := <-c.restored:
+				couponIDs <- couponID
+			}
+		}
+	}()
+	return couponIDs, nil
+}
+
+func (c *TestOrderCache) SetStockBuckets(ctx context.Context, couponID int64, buckets int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buckets[couponID] = buckets
+	return nil
+}
+
+func (c *TestOrderCache) SetStockIfAbsent(ctx context.Context, couponID int64, stock int64) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.stocks[couponID]; ok {
+		return false, nil
+	}
+	c.stocks[couponID] = stock
+	return true, nil
+}
+
+func (c *TestOrderCache) ExpireCouponKeys(ctx context.Context, couponID int64, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expires[couponID] = ttl
+	return nil
+}
+
+func (c *TestOrderCache) AdjustStock(ctx context.Context, couponID int64, delta int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stock, ok := c.stocks[couponID]
+	if !ok {
+		return stockNotCached, nil
+	}
+	if stock+delta < 0 {
+		return stockNotEnough, nil
+	}
+	c.stocks[couponID] = stock + delta
+	return stock + delta, nil
+}
+
+func (c *TestOrderCache) SetActivity(ctx context.Context, couponID int64, start, end time.Time, status int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.activities[couponID] = status
+	c.windows[couponID] = [2]time.Time{start, end}
+	return nil
+}
+
+func (c *TestOrderCache) GetActivity(ctx context.Context, couponID int64) (time.Time, time.Time, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status, ok := c.activities[couponID]
+	if !ok {
+		return time.Time{}, time.Time{}, 0, ErrCouponNotFound
+	}
+	window := c.windows[couponID]
+	return window[0], window[1], status, nil
+}
+
+func (c *TestOrderCache) ConsumeToken(ctx context.Context, nonce string, expireAt time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.tokens[nonce]; ok {
+		return false, nil
+	}
+	c.tokens[nonce] = expireAt
+	return true, nil
+}
+
+func (c *TestOrderCache) ScheduleOrderTimeout(ctx context.Context, orderID int64, deadline time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.timeouts[orderID]; !ok {
+		c.timeouts[orderID] = deadline
+	}
+	return nil
+}
+
+func (c *TestOrderCache) ClaimExpiredOrders(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ids []int64
+	for id, deadline := range c.timeouts {
+		if !deadline.After(now) && len(ids) < limit {
+			ids = append(ids, id)
+			c.timeouts[id] = now.Add(lease)
+		}
+	}
+	return ids, nil
+}
+
+func (c *TestOrderCache) RemoveOrderTimeout(ctx context.Context, orderID int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.timeouts, orderID)
+	return nil
+}
+
+func (c *TestOrderCache) RevertStock(ctx context.Context, couponID, userID int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stocks[couponID]++
+	c.bought[couponID]--
+	return nil
+}
+
+func (c *TestOrderCache) SetOrderProcessing(ctx context.Context, order *Order, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	o := *order
+	c.processing[order.ID] = &o
+	return nil
+}
+
+func (c *TestOrderCache) GetProcessingOrder(ctx context.Context, orderID int64) (*Order, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.processing[orderID], nil
+}
+
+func (c *TestOrderCache) ListProcessingOrders(ctx context.Context, userID int64) ([]*Order, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var orders []*Order
+	for _, order := range c.processing {
+		if order.UserID == userID {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func (c *TestOrderCache) ClearOrderProcessing(ctx context.Context, order *Order) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.processing, order.ID)
+	return nil
+}
+
+func (c *TestOrderCache) JoinQueue(ctx context.Context, couponID, userID int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, id := range c.queues[couponID] {
+		if id == userID {
+			return int64(i + 1), nil
+		}
+	}
+	c.queues[couponID] = append(c.queues[couponID], userID)
+	return int64(len(c.queues[couponID])), nil
+}
+
+func (c *TestOrderCache) GetQueuePosition(ctx context.Context, couponID, userID int64, now time.Time) (int64, time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if until, ok := c.admitted[couponID][userID]; ok && until.After(now) {
+		return 0, until, nil
+	}
+	for i, id := range c.queues[couponID] {
+		if id == userID {
+			return int64(i + 1), time.Time{}, nil
+		}
+	}
+	return -1, time.Time{}, nil
+}
+
+func (c *TestOrderCache) IsAdmitted(ctx context.Context, couponID, userID int64, now time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	until, ok := c.admitted[couponID][userID]
+	return ok && until.After(now), nil
+}
+
+func (c *TestOrderCache) ListQueuedCoupons(ctx context.Context) ([]int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var couponIDs []int64
+	for couponID, queue := range c.queues {
+		if len(queue) > 0 {
+			couponIDs = append(couponIDs, couponID)
+		}
+	}
+	return couponIDs, nil
+}
+
+func (c *TestOrderCache) AdmitFromQueue(ctx context.Context, couponID int64, n int, until, now time.Time) ([]int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	queue := c.queues[couponID]
+	n = min(n, len(queue))
+	userIDs := append([]int64(nil), queue[:n]...)
+	c.queues[couponID] = queue[n:]
+	if c.admitted[couponID] == nil {
+		c.admitted[couponID] = make(map[int64]time.Time)
+	}
+	for _, userID := range userIDs {
+		c.admitted[couponID][userID] = until
+	}
+	return userIDs, nil
+}
+
+// 内存版分布式锁（用于测试）
+type TestLocker struct {
+	mu     sync.Mutex
+	locked map[string]bool
+}
+
+func (l *TestLocker) Lock(ctx context.Context, name string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locked == nil {
+		l.locked = make(map[string]bool)
+	}
+	if l.locked[name] {
+		return nil, ErrLockFailed
+	}
+	l.locked[name] = true
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.locked, name)
+	}, nil
+}
+
+// 内存版 Repository（用于测试）
+type TestRepository struct {
+	mu                   sync.Mutex
+	coupons              map[int64]*Coupon
+	stocks               map[int64]int64
+	orders               map[int64]*Order
+	tasks                map[int64]*CompensationTask
+	statusLogs           []*OrderStatusLog
+	deadLetters          map[int64]*DeadLetter
+	nextTaskID           int64
+	nextCouponID         int64
+	failSaveCompensation bool
+	failSaveDeadLetter   bool
+}
+
+func NewTestRepository() *TestRepository {
+	return &TestRepository{
+		coupons:     make(map[int64]*Coupon),
+		stocks:      make(map[int64]int64),
+		orders:      make(map[int64]*Order),
+		tasks:       make(map[int64]*CompensationTask),
+		deadLetters: make(map[int64]*DeadLetter),
+	}
+}
+
+func (r *TestRepository) GetCoupon(ctx context.Context, couponID int64) (*Coupon, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	coupon, ok := r.coupons[couponID]
+	if !ok {
+		return nil, ErrCouponNotFound
+	}
+	return r.copyCoupon(coupon), nil
+}
+
+// copyCoupon 复制优惠券，剩余库存以 stocks 为准
+func (r *TestRepository) copyCoupon(coupon *Coupon) *Coupon {
+	c := *coupon
+	if stock, ok := r.stocks[coupon.ID]; ok {
+		c.RemainStock = stock
+	}
+	return &c
+}
+
+func (r *TestRepository) ListActiveCoupons(ctx context.Context) ([]*Coupon, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var coupons []*Coupon
+	for _, coupon := range r.coupons {
+		if coupon.Status == CouponActive {
+			coupons = append(coupons, r.copyCoupon(coupon))
+		}
+	}
+	return coupons, nil
+}
+
+func (r *TestRepository) ListCoupons(ctx context.Context, status *int, offset, limit int) ([]*Coupon, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var coupons []*Coupon
+	for _, coupon := range r.coupons {
+		if status == nil || coupon.Status == *status {
+			coupons = append(coupons, r.copyCoupon(coupon))
+		}
+	}
+	sort.Slice(coupons, func(i, j int) bool { return coupons[i].ID > coupons[j].ID })
+
+	total := int64(len(coupons))
+	if offset >= len(coupons) {
+		return nil, total, nil
+	}
+	end := min(offset+limit, len(coupons))
+	return coupons[offset:end], total, nil
+}
+
+func (r *TestRepository) CreateCoupon(ctx context.Context, coupon *Coupon) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextCouponID++
+	coupon.ID = r.nextCouponID
+	c := *coupon
+	r.coupons[c.ID] = &c
+	r.stocks[c.ID] = c.RemainStock
+	return nil
+}
+
+func (r *TestRepository) UpdateCoupon(ctx context.Context, coupon *Coupon) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.coupons[coupon.ID]
+	if !ok {
+		return ErrCouponNotFound
+	}
+	c.Name = coupon.Name
+	c.Description = coupon.Description
+	c.StartTime = coupon.StartTime
+	c.EndTime = coupon.EndTime
+	c.Status = coupon.Status
+	return nil
+}
+
+func (r *TestRepository) AdjustCouponStock(ctx context.Context, couponID int64, delta int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.coupons[couponID]
+	if !ok {
+		return ErrStockNotEnough
+	}
+	remain := r.copyCoupon(c).RemainStock
+	if remain+delta < 0 {
+		return ErrStockNotEnough
+	}
+	c.TotalStock += delta
+	r.stocks[couponID] = remain + delta
+	return nil
+}
+
+func (r *TestRepository) DeleteCoupon(ctx context.Context, couponID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.coupons[couponID]; !ok {
+		return ErrCouponNotFound
+	}
+	delete(r.coupons, couponID)
+	return nil
+}
+
+func (r *TestRepository) ListCouponsToSchedule(ctx context.Context, startBefore, endBefore time.Time) ([]*Coupon, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var coupons []*Coupon
+	for _, coupon := range r.coupons {
+		if (coupon.Status == CouponNotStarted && !coupon.StartTime.After(startBefore)) ||
+			(coupon.Status == CouponActive && !coupon.EndTime.After(endBefore)) {
+			coupons = append(coupons, r.copyCoupon(coupon))
+		}
+	}
+	return coupons, nil
+}
+
+func (r *TestRepository) UpdateCouponStatus(ctx context.Context, couponID int64, from, to int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	coupon, ok := r.coupons[couponID]
+	if !ok || coupon.Status != from {
+		return ErrCouponStatusInvalid
+	}
+	coupon.Status = to
+	return nil
+}
+
+func (r *TestRepository) CountOrders(ctx context.Context, couponID int64) (int64, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var active, cancelled int64
+	for _, order := range r.orders {
+		if order.CouponID != couponID {
+			continue
+		}
+		if releasesStock(order.Status) {
+			cancelled++
+		} else {
+			active++
+		}
+	}
+	return active, cancelled, nil
+}
+
+func (r *TestRepository) RepairRemainStock(ctx context.Context, couponID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var active int64
+	for _, order := range r.orders {
+		if order.CouponID == couponID && order.Status != OrderCancelled {
+			active++
+		}
+	}
+	r.stocks[couponID] = r.coupons[couponID].TotalStock - active
+	return nil
+}
+
+func (r *TestRepository) DecrStock(ctx context.Context, couponID int64) error {
+	return nil
+}
+
+func (r *TestRepository) CreateOrder(ctx context.Context, order *Order) error {
+	return nil
+}
+
+func (r *TestRepository) CreateOrderWithStock(ctx context.Context, order *Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, o := range r.orders {
+		if o.ID == order.ID || (o.UserID == order.UserID && o.CouponID == order.CouponID) {
+			return ErrOrderExists
+		}
+	}
+	if r.stocks[order.CouponID] <= 0 {
+		return ErrStockNotEnough
+	}
+	r.stocks[order.CouponID]--
+	saved := *order
+	r.orders[order.ID] = &saved
+	return nil
+}
+
+func (r *TestRepository) GetOrder(ctx context.Context, orderID int64) (*Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[orderID]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	o := *order
+	return &o, nil
+}
+
+func (r *TestRepository) ListOrdersByUser(ctx context.Context, userID int64) ([]*Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var orders []*Order
+	for _, order := range r.orders {
+		if order.UserID == userID {
+			o := *order
+			orders = append(orders, &o)
+		}
+	}
+	return orders, nil
+}
+
+func (r *TestRepository) TransitionOrder(ctx context.Context, t *OrderTransition) (*Order, error) {
+	if err := validateOrderTransition(t.From, t.To); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[t.OrderID]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	if order.Status != t.From {
+		return nil, ErrOrderStatusInvalid
+	}
+	order.Status = t.To
+	r.statusLogs = append(r.statusLogs, &OrderStatusLog{
+		ID:         int64(len(r.statusLogs) + 1),
+		OrderID:    t.OrderID,
+		FromStatus: t.From,
+		ToStatus:   t.To,
+		Reason:     t.Reason,
+		Actor:      t.Actor,
+	})
+	if releasesStock(t.To) {
+		r.stocks[order.CouponID]++
+	}
+	o := *order
+	return &o, nil
+}
+
+func (r *TestRepository) ListOrderStatusLogs(ctx context.Context, orderID int64) ([]*OrderStatusLog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var logs []*OrderStatusLog
+	for _, l := range r.statusLogs {
+		if l.OrderID == orderID {
+			copied := *l
+			logs = append(logs, &copied)
+		}
+	}
+	return logs, nil
+}
+
+func (r *TestRepository) SaveCompensationTask(ctx context.Context, task *CompensationTask) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failSaveCompensation {
+		return assert.AnError
+	}
+	r.nextTaskID++
+	task.ID = r.nextTaskID
+	saved := *task
+	r.tasks[task.ID] = &saved
+	return nil
+}
+
+func (r *TestRepository) GetPendingCompensationTasks(ctx context.Context, limit int, processingTimeout time.Duration) ([]*CompensationTask, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var tasks []*CompensationTask
+	for _, task := range r.tasks {
+		due := task.Status == CompensationPending && !time.Now().Before(task.UpdatedAt.Add(compensationBackoff(task.RetryCount)))
+		stuck := task.Status == CompensationProcessing && task.UpdatedAt.Before(time.Now().Add(-processingTimeout))
+		if (due || stuck) && len(tasks) < limit {
+			t := *task
+			tasks = append(tasks, &t)
+		}
+	}
+	return tasks, nil
+}
+
+func (r *TestRepository) UpdateCompensationTaskStatus(ctx context.Context, taskID int64, status int, retryCount int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	task, ok := r.tasks[taskID]
+	if !ok {
+		return assert.AnError
+	}
+	task.Status = status
+	task.RetryCount = retryCount
+	task.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *TestRepository) SaveDeadLetter(ctx context.Context, dl *DeadLetter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failSaveDeadLetter {
+		return assert.AnError
+	}
+	dl.ID = int64(len(r.deadLetters) + 1)
+	saved := *dl
+	r.deadLetters[dl.ID] = &saved
+	return nil
+}
+
+func (r *TestRepository) GetDeadLetter(ctx context.Context, id int64) (*DeadLetter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dl, ok := r.deadLetters[id]
+	if !ok {
+		return nil, ErrDeadLetterNotFound
+	}
+	d := *dl
+	return &d, nil
+}
+
+func (r *TestRepository) ListDeadLetters(ctx context.Context, status *int, offset, limit int) ([]*DeadLetter, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var matched []*DeadLetter
+	for id := int64(len(r.deadLetters)); id >= 1; id-- {
+		dl := r.deadLetters[id]
+		if status == nil || dl.Status == *status {
+			d := *dl
+			matched = append(matched, &d)
+		}
+	}
+	total := int64(len(matched))
+	if offset >= len(matched) {
+		return nil, total, nil
+	}
+	return matched[offset:min(offset+limit, len(matched))], total, nil
+}
+
+func (r *TestRepository) UpdateDeadLetterStatus(ctx context.Context, id int64, from, to int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dl, ok := r.deadLetters[id]
+	if !ok {
+		return ErrDeadLetterNotFound
+	}
+	if dl.Status != from {
+		return ErrDeadLetterHandled
+	}
+	dl.Status = to
 	return nil
 }
 
@@ -58,7 +795,7 @@ func TestSeckill_Success(t *testing.T) {
 	defer cleanup()
 
 	mqProducer := &TestMQProducer{shouldFail: false}
-	service := NewService(nil, cacheRepo, mqProducer, &config.SeckillConfig{})
+	service := NewService(nil, cacheRepo, mqProducer, &TestIDGenerator{}, &TestLocker{}, &config.SeckillConfig{})
 
 	ctx := context.Background()
 
@@ -77,6 +814,7 @@ func TestSeckill_Success(t *testing.T) {
 	assert.NoError(t, err)
 	assert.True(t, resp.Success)
 	assert.Equal(t, "秒杀成功，订单处理中", resp.Message)
+	assert.Equal(t, int64(1), resp.OrderID, "应返回生成的订单ID")
 
 	// 验证库存被扣减
 	stock, err := cacheRepo.GetStock(ctx, 1)
@@ -90,7 +828,7 @@ func TestSeckill_StockNotEnough(t *testing.T) {
 	defer cleanup()
 
 	mqProducer := &TestMQProducer{shouldFail: false}
-	service := NewService(nil, cacheRepo, mqProducer, &config.SeckillConfig{})
+	service := NewService(nil, cacheRepo, mqProducer, &TestIDGenerator{}, &TestLocker{}, &config.SeckillConfig{})
 
 	ctx := context.Background()
 
@@ -117,13 +855,54 @@ func TestSeckill_StockNotEnough(t *testing.T) {
 	assert.Equal(t, int64(0), stock)
 }
 
-// 测试 MQ 发送失败并回滚
+// 测试 MQ 发送失败时写入补偿任务
+func TestSeckill_MQFailedSavesCompensationTask(t *testing.T) {
+	cacheRepo, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	repo := NewTestRepository()
+	mqProducer := &TestMQProducer{shouldFail: true} // MQ 失败
+	service := NewService(repo, cacheRepo, mqProducer, &TestIDGenerator{}, &TestLocker{}, &config.SeckillConfig{})
+
+	ctx := context.Background()
+
+	// 初始化库存为 50
+	err := cacheRepo.SetStock(ctx, 1, 50)
+	require.NoError(t, err)
+
+	// 执行秒杀
+	req := &SeckillRequest{
+		UserID:   1001,
+		CouponID: 1,
+	}
+	resp, err := service.Seckill(ctx, req)
+
+	// 验证秒杀成功，订单交给补偿任务投递
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+
+	tasks, err := repo.GetPendingCompensationTasks(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, int64(1001), tasks[0].UserID)
+	assert.Equal(t, int64(1), tasks[0].CouponID)
+	assert.Equal(t, resp.OrderID, tasks[0].OrderID)
+
+	// 验证库存未回滚（应该是 49）
+	stock, err := cacheRepo.GetStock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(49), stock)
+}
+
+// 测试 MQ 发送失败且补偿任务保存失败时回滚
 func TestSeckill_MQFailedWithRollback(t *testing.T) {
 	cacheRepo, _, cleanup := setupTestEnv(t)
 	defer cleanup()
 
+	repo := NewTestRepository()
+	repo.failSaveCompensation = true
 	mqProducer := &TestMQProducer{shouldFail: true} // MQ 失败
-	service := NewService(nil, cacheRepo, mqProducer, &config.SeckillConfig{})
+	service := NewService(repo, cacheRepo, mqProducer, &TestIDGenerator{}, &TestLocker{}, &config.SeckillConfig{})
 
 	ctx := context.Background()
 
@@ -147,6 +926,46 @@ func TestSeckill_MQFailedWithRollback(t *testing.T) {
 	stock, err := cacheRepo.GetStock(ctx, 1)
 	require.NoError(t, err)
 	assert.Equal(t, int64(50), stock, "库存应该回滚到初始值")
+
+	// 回滚后用户已移出已购集合，可以重新抢购
+	stock, err = cacheRepo.DecrStock(ctx, 1, 1001)
+	require.NoError(t, err)
+	assert.Equal(t, int64(49), stock)
+}
+
+// 测试同一用户重复秒杀
+func TestSeckill_AlreadyBought(t *testing.T) {
+	cacheRepo, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	mqProducer := &TestMQProducer{shouldFail: false}
+	service := NewService(nil, cacheRepo, mqProducer, &TestIDGenerator{}, &TestLocker{}, &config.SeckillConfig{})
+
+	ctx := context.Background()
+
+	// 初始化库存为 10
+	err := cacheRepo.SetStock(ctx, 1, 10)
+	require.NoError(t, err)
+
+	req := &SeckillRequest{
+		UserID:   1001,
+		CouponID: 1,
+	}
+
+	// 第一次秒杀成功
+	resp, err := service.Seckill(ctx, req)
+	require.NoError(t, err)
+	assert.True(t, resp.Success)
+
+	// 第二次秒杀被拒绝
+	resp, err = service.Seckill(ctx, req)
+	assert.Equal(t, ErrAlreadyBought, err)
+	assert.False(t, resp.Success)
+
+	// 验证库存只扣减一次
+	stock, err := cacheRepo.GetStock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), stock)
 }
 
 // 测试并发秒杀
@@ -155,7 +974,7 @@ func TestSeckill_Concurrent(t *testing.T) {
 	defer cleanup()
 
 	mqProducer := &TestMQProducer{shouldFail: false}
-	service := NewService(nil, cacheRepo, mqProducer, &config.SeckillConfig{})
+	service := NewService(nil, cacheRepo, mqProducer, &TestIDGenerator{}, &TestLocker{}, &config.SeckillConfig{})
 
 	ctx := context.Background()
 
@@ -211,3 +1030,164 @@ func TestInitStock(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, int64(100), stock)
 }
+
+// 测试活动未开始和已结束
+func TestSeckill_ActivityWindow(t *testing.T) {
+	cacheRepo, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	mqProducer := &TestMQProducer{shouldFail: false}
+	service := NewService(nil, cacheRepo, mqProducer, &TestIDGenerator{}, &TestLocker{}, &config.SeckillConfig{})
+
+	ctx := context.Background()
+	now := time.Now()
+
+	err := cacheRepo.SetStock(ctx, 1, 10)
+	require.NoError(t, err)
+
+	req := &SeckillRequest{
+		UserID:   1001,
+		CouponID: 1,
+	}
+
+	// 未开始：开始时间在未来
+	err = cacheRepo.SetActivity(ctx, 1, now.Add(time.Hour), now.Add(2*time.Hour), CouponActive)
+	require.NoError(t, err)
+	_, err = service.Seckill(ctx, req)
+	assert.Equal(t, ErrNotStarted, err)
+
+	// 未开始：状态未切换为进行中
+	err = cacheRepo.SetActivity(ctx, 1, now.Add(-time.Hour), now.Add(time.Hour), CouponNotStarted)
+	require.NoError(t, err)
+	_, err = service.Seckill(ctx, req)
+	assert.Equal(t, ErrNotStarted, err)
+
+	// 已结束：结束时间已过
+	err = cacheRepo.SetActivity(ctx, 1, now.Add(-2*time.Hour), now.Add(-time.Hour), CouponActive)
+	require.NoError(t, err)
+	_, err = service.Seckill(ctx, req)
+	assert.Equal(t, ErrEnded, err)
+
+	// 已结束：状态为已结束
+	err = cacheRepo.SetActivity(ctx, 1, now.Add(-time.Hour), now.Add(time.Hour), CouponEnded)
+	require.NoError(t, err)
+	_, err = service.Seckill(ctx, req)
+	assert.Equal(t, ErrEnded, err)
+
+	// 验证库存未被扣减
+	stock, err := cacheRepo.GetStock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), stock)
+
+	// 进行中：秒杀成功
+	err = cacheRepo.SetActivity(ctx, 1, now.Add(-time.Hour), now.Add(time.Hour), CouponActive)
+	require.NoError(t, err)
+	resp, err := service.Seckill(ctx, req)
+	require.NoError(t, err)
+	assert.True(t, resp.Success)
+}
+
+// 测试从 MySQL 初始化库存和活动信息
+func TestService_InitStock(t *testing.T) {
+	cacheRepo, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	repo := NewTestRepository()
+	now := time.Now()
+	repo.coupons[1] = &Coupon{
+		ID:          1,
+		TotalStock:  100,
+		RemainStock: 80,
+		StartTime:   now.Add(time.Hour),
+		EndTime:     now.Add(2 * time.Hour),
+		Status:      CouponNotStarted,
+	}
+	service := NewService(repo, cacheRepo, &TestMQProducer{}, &TestIDGenerator{}, &TestLocker{}, &config.SeckillConfig{})
+
+	ctx := context.Background()
+	require.NoError(t, service.InitStock(ctx, 1))
+
+	stock, err := cacheRepo.GetStock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(80), stock)
+
+	// 活动信息同步写入，未开始时拒绝秒杀
+	_, err = service.Seckill(ctx, &SeckillRequest{UserID: 1001, CouponID: 1})
+	assert.Equal(t, ErrNotStarted, err)
+}
+
+// 测试订单处理中状态查询
+func TestService_GetOrder(t *testing.T) {
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	service := NewService(repo, cache, &TestMQProducer{}, &TestIDGenerator{}, &TestLocker{}, &config.SeckillConfig{})
+
+	ctx := context.Background()
+
+	// 没有任何记录
+	_, err := service.GetOrder(ctx, 1)
+	assert.Equal(t, ErrOrderNotFound, err)
+
+	// MQ 消息处理中
+	order := &Order{ID: 1, UserID: 1001, CouponID: 1, Status: OrderPending}
+	require.NoError(t, cache.SetOrderProcessing(ctx, order, time.Minute))
+	resp, err := service.GetOrder(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, OrderStateProcessing, resp.State)
+
+	// 订单已落库
+	repo.stocks[1] = 10
+	require.NoError(t, repo.CreateOrderWithStock(ctx, order))
+	resp, err = service.GetOrder(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, OrderStatePending, resp.State)
+}
+
+// 测试用户订单列表合并处理中的订单
+func TestService_ListUserOrders(t *testing.T) {
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	service := NewService(repo, cache, &TestMQProducer{}, &TestIDGenerator{}, &TestLocker{}, &config.SeckillConfig{})
+
+	ctx := context.Background()
+	now := time.Now()
+	repo.stocks[1] = 10
+
+	persisted := &Order{ID: 1, UserID: 1001, CouponID: 1, Status: OrderPaid, CreatedAt: now.Add(-time.Minute)}
+	require.NoError(t, repo.CreateOrderWithStock(ctx, persisted))
+	// 已落库但标记尚未清除
+	require.NoError(t, cache.SetOrderProcessing(ctx, persisted, time.Minute))
+	// 仍在处理中
+	require.NoError(t, cache.SetOrderProcessing(ctx, &Order{ID: 2, UserID: 1001, CouponID: 2, CreatedAt: now}, time.Minute))
+	// 其他用户
+	require.NoError(t, cache.SetOrderProcessing(ctx, &Order{ID: 3, UserID: 1002, CouponID: 2, CreatedAt: now}, time.Minute))
+
+	orders, err := service.ListUserOrders(ctx, 1001)
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	assert.Equal(t, int64(2), orders[0].OrderID)
+	assert.Equal(t, OrderStateProcessing, orders[0].State)
+	assert.Equal(t, int64(1), orders[1].OrderID)
+	assert.Equal(t, OrderStatePaid, orders[1].State)
+}
+
+// 测试支付订单
+func TestService_PayOrder(t *testing.T) {
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	service := NewService(repo, cache, &TestMQProducer{}, &TestIDGenerator{}, &TestLocker{}, &config.SeckillConfig{})
+
+	ctx := context.Background()
+	repo.stocks[1] = 10
+	require.NoError(t, repo.CreateOrderWithStock(ctx, &Order{ID: 1, UserID: 1001, CouponID: 1}))
+	require.NoError(t, cache.ScheduleOrderTimeout(ctx, 1, time.Now().Add(time.Minute)))
+
+	require.NoError(t, service.PayOrder(ctx, 1))
+	assert.Equal(t, OrderPaid, repo.orders[1].Status)
+	assert.Empty(t, cache.timeouts, "支付后应移除超时登记")
+
+	// 重复支付
+	assert.Equal(t, ErrOrderStatusInvalid, service.PayOrder(ctx, 1))
+	// 订单不存在
+	assert.Equal(t, ErrOrderNotFound, service.PayOrder(ctx, 2))
+}
@@ -0,0 +1,44 @@
+package seckill
+
+import (
+	"sync"
+	"time"
+)
+
+// soldOutTTL 本地售罄标记有效期，库存归还通知丢失时最多在该时间后重新访问 Redis
+const soldOutTTL = 5 * time.Second
+
+// soldOutCache 进程内售罄标记
+// Redis 扣减返回库存不足后标记，之后的请求直接在本地拒绝，不再访问 Redis；
+// 库存归还时通过 Redis pub/sub 通知各实例清除标记
+type soldOutCache struct {
+	ttl   time.Duration
+	marks sync.Map // couponID -> 过期时间（UnixNano）
+}
+
+func newSoldOutCache(ttl time.Duration) *soldOutCache {
+	return &soldOutCache{ttl: ttl}
+}
+
+// isSoldOut 优惠券是否已标记售罄
+func (c *soldOutCache) isSoldOut(couponID int64, now time.Time) bool {
+	expireAt, ok := c.marks.Load(couponID)
+	if !ok {
+		return false
+	}
+	if now.UnixNano() >= expireAt.(int64) {
+		c.marks.CompareAndDelete(couponID, expireAt)
+		return false
+	}
+	return true
+}
+
+// mark 标记优惠券售罄
+func (c *soldOutCache) mark(couponID int64, now time.Time) {
+	c.marks.Store(couponID, now.Add(c.ttl).UnixNano())
+}
+
+// clear 清除售罄标记
+func (c *soldOutCache) clear(couponID int64) {
+	c.marks.Delete(couponID)
+}
@@ -0,0 +1,86 @@
+package seckill
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rag-agent/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 测试售罄标记过期
+func TestSoldOutCache_TTL(t *testing.T) {
+	cache := newSoldOutCache(time.Second)
+	now := time.Now()
+
+	assert.False(t, cache.isSoldOut(1, now))
+
+	cache.mark(1, now)
+	assert.True(t, cache.isSoldOut(1, now))
+	assert.False(t, cache.isSoldOut(2, now))
+	assert.False(t, cache.isSoldOut(1, now.Add(time.Second)))
+
+	cache.mark(1, now)
+	cache.clear(1)
+	assert.False(t, cache.isSoldOut(1, now))
+}
+
+// 测试售罄后本地拒绝，收到库存归还通知后恢复访问 Redis
+func TestSeckill_SoldOutLocalReject(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewTestOrderCache()
+	cache.stocks[1] = 1
+	service := NewService(NewTestRepository(), cache, &TestMQProducer{}, &TestIDGenerator{}, &TestLocker{}, &config.SeckillConfig{})
+
+	_, err := service.Seckill(ctx, &SeckillRequest{UserID: 1001, CouponID: 1})
+	require.NoError(t, err)
+
+	_, err = service.Seckill(ctx, &SeckillRequest{UserID: 1002, CouponID: 1})
+	assert.ErrorIs(t, err, ErrStockNotEnough)
+	assert.Equal(t, 2, cache.decrCalls)
+
+	// 已标记售罄，不再访问 Redis
+	_, err = service.Seckill(ctx, &SeckillRequest{UserID: 1003, CouponID: 1})
+	assert.ErrorIs(t, err, ErrStockNotEnough)
+	assert.Equal(t, 2, cache.decrCalls)
+
+	go service.WatchStockRestored(ctx)
+
+	// 库存归还后清除售罄标记
+	require.NoError(t, cache.IncrStock(ctx, 1, 1))
+	cache.restored <- 1
+	require.Eventually(t, func() bool {
+		return !service.soldOut.isSoldOut(1, time.Now())
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = service.Seckill(ctx, &SeckillRequest{UserID: 1003, CouponID: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 3, cache.decrCalls)
+}
+
+// 测试 Redis 增加库存时发布库存归还通知
+func TestRedisCache_StockRestoredNotification(t *testing.T) {
+	cacheRepo, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	couponIDs, err := cacheRepo.SubscribeStockRestored(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, cacheRepo.SetStock(ctx, 1, 0))
+	assert.Equal(t, int64(1), <-couponIDs)
+
+	require.NoError(t, cacheRepo.IncrStock(ctx, 1, 1))
+	assert.Equal(t, int64(1), <-couponIDs)
+
+	cancel()
+	_, ok := <-couponIDs
+	assert.False(t, ok)
+}
@@ -0,0 +1,169 @@
+package seckill
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"rag-agent/config"
+)
+
+const (
+	defaultTokenTTL      = 10 * time.Second // 未配置 token_ttl 时秒杀令牌的有效期
+	minTokenSecretLength = 16               // 签名密钥最小长度（字节）
+)
+
+// ValidateTokenConfig 校验秒杀令牌配置：开启令牌校验时签名密钥不能是弱密钥，否则令牌可被伪造
+// 弱密钥包括空值、短于 16 字节以及 change-me 开头的占位值
+func ValidateTokenConfig(cfg *config.SeckillConfig) error {
+	if !cfg.TokenEnabled {
+		return nil
+	}
+	secret := cfg.TokenSecret
+	if len(secret) < minTokenSecretLength || strings.HasPrefix(strings.ToLower(secret), "change-me") {
+		return fmt.Errorf("开启秒杀令牌时必须配置至少 %d 字节且非占位值的 token_secret", minTokenSecretLength)
+	}
+	return nil
+}
+
+// tokenSigner 秒杀令牌签名器
+// 令牌格式: base64url("couponID:userID:过期时间毫秒:nonce") + "." + base64url(HMAC-SHA256)，
+// 与用户和优惠券绑定，nonce 用于 Redis 判重保证一次性
+type tokenSigner struct {
+	secret []byte
+}
+
+func newTokenSigner(secret string) *tokenSigner {
+	return &tokenSigner{secret: []byte(secret)}
+}
+
+// sign 生成令牌
+func (t *tokenSigner) sign(couponID, userID int64, expireAt time.Time, nonce string) string {
+	payload := fmt.Sprintf("%d:%d:%d:%s", couponID, userID, expireAt.UnixMilli(), nonce)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(t.mac(payload))
+}
+
+// verify 校验令牌签名、绑定的用户和优惠券以及有效期，返回 nonce 和过期时间
+func (t *tokenSigner) verify(token string, couponID, userID int64, now time.Time) (string, time.Time, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", time.Time{}, ErrTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", time.Time{}, ErrTokenInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, t.mac(string(payload))) {
+		return "", time.Time{}, ErrTokenInvalid
+	}
+
+	fields := strings.Split(string(payload), ":")
+	if len(fields) != 4 {
+		return "", time.Time{}, ErrTokenInvalid
+	}
+	if fields[0] != strconv.FormatInt(couponID, 10) || fields[1] != strconv.FormatInt(userID, 10) {
+		return "", time.Time{}, ErrTokenInvalid
+	}
+	expireMs, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return "", time.Time{}, ErrTokenInvalid
+	}
+	expireAt := time.UnixMilli(expireMs)
+	if !now.Before(expireAt) {
+		return "", time.Time{}, ErrTokenExpired
+	}
+
+	return fields[3], expireAt, nil
+}
+
+func (t *tokenSigner) mac(payload string) []byte {
+	h := hmac.New(sha256.New, t.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// newTokenNonce 生成随机 nonce
+func newTokenNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成令牌随机数失败: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// IssueToken 签发秒杀令牌，只在活动时间窗口内签发
+func (s *Service) IssueToken(ctx context.Context, couponID, userID int64) (*SeckillToken, error) {
+	now := time.Now()
+	if err := s.checkActivityWindow(ctx, couponID, now); err != nil {
+		return nil, err
+	}
+
+	nonce, err := newTokenNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := s.cfg.TokenTTL
+	if ttl <= 0 {
+		ttl = defaultTokenTTL
+	}
+	expireAt := now.Add(ttl)
+
+	return &SeckillToken{
+		Token:    s.tokens.sign(couponID, userID, expireAt, nonce),
+		ExpireAt: expireAt,
+	}, nil
+}
+
+// checkActivityWindow 检查活动是否在进行中，与秒杀 Lua 脚本的判断一致
+// 优先读取 Redis 活动信息，未缓存时回退到 MySQL
+func (s *Service) checkActivityWindow(ctx context.Context, couponID int64, now time.Time) error {
+	start, end, status, err := s.cache.GetActivity(ctx, couponID)
+	if errors.Is(err, ErrCouponNotFound) {
+		coupon, getErr := s.repo.GetCoupon(ctx, couponID)
+		if getErr != nil {
+			return getErr
+		}
+		start, end, status, err = coupon.StartTime, coupon.EndTime, coupon.Status, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if status == CouponEnded || now.After(end) {
+		return ErrEnded
+	}
+	if status != CouponActive || now.Before(start) {
+		return ErrNotStarted
+	}
+	return nil
+}
+
+// verifyToken 校验秒杀令牌签名，返回 nonce 和过期时间（消费前调用，不访问 Redis）
+func (s *Service) verifyToken(req *SeckillRequest, now time.Time) (string, time.Time, error) {
+	if req.Token == "" {
+		return "", time.Time{}, ErrTokenInvalid
+	}
+	return s.tokens.verify(req.Token, req.CouponID, req.UserID, now)
+}
+
+// consumeToken 在 Redis 中标记令牌已使用，重复使用返回 ErrTokenUsed
+func (s *Service) consumeToken(ctx context.Context, nonce string, expireAt time.Time) error {
+	ok, err := s.cache.ConsumeToken(ctx, nonce, expireAt)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrTokenUsed
+	}
+	return nil
+}
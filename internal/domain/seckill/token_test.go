@@ -0,0 +1,139 @@
+package seckill
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rag-agent/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTokenService() (*Service, *TestRepository, *TestOrderCache) {
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	cfg := &config.SeckillConfig{TokenEnabled: true, TokenSecret: "test-secret", TokenTTL: time.Minute}
+	return NewService(repo, cache, &TestMQProducer{}, &TestIDGenerator{}, &TestLocker{}, cfg), repo, cache
+}
+
+// 测试开启令牌时拒绝弱密钥：空值、过短和占位值
+func TestValidateTokenConfig(t *testing.T) {
+	assert.NoError(t, ValidateTokenConfig(&config.SeckillConfig{}))
+	assert.NoError(t, ValidateTokenConfig(&config.SeckillConfig{TokenEnabled: true, TokenSecret: "3f9c1e7a5b2d8046"}))
+	assert.Error(t, ValidateTokenConfig(&config.SeckillConfig{TokenEnabled: true}))
+	assert.Error(t, ValidateTokenConfig(&config.SeckillConfig{TokenEnabled: true, TokenSecret: "test-secret"}))
+	assert.Error(t, ValidateTokenConfig(&config.SeckillConfig{TokenEnabled: true, TokenSecret: "change-me-seckill-token-secret"}))
+}
+
+// 测试令牌签名校验：篡改、绑定其他用户或优惠券、过期均无效
+func TestTokenSigner_Verify(t *testing.T) {
+	signer := newTokenSigner("test-secret")
+	now := time.Now()
+	token := signer.sign(1, 1001, now.Add(time.Minute), "nonce")
+
+	nonce, expireAt, err := signer.verify(token, 1, 1001, now)
+	require.NoError(t, err)
+	assert.Equal(t, "nonce", nonce)
+	assert.Equal(t, now.Add(time.Minute).UnixMilli(), expireAt.UnixMilli())
+
+	_, _, err = signer.verify(token, 1, 1002, now)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+	_, _, err = signer.verify(token, 2, 1001, now)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+	_, _, err = signer.verify(token, 1, 1001, now.Add(time.Minute))
+	assert.ErrorIs(t, err, ErrTokenExpired)
+
+	_, _, err = newTokenSigner("other-secret").verify(token, 1, 1001, now)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+	_, _, err = signer.verify(token+"x", 1, 1001, now)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+	_, _, err = signer.verify("invalid", 1, 1001, now)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+}
+
+// 测试只在活动时间窗口内签发令牌，Redis 未缓存活动信息时回退到 MySQL
+func TestService_IssueToken_ActivityWindow(t *testing.T) {
+	ctx := context.Background()
+	service, repo, cache := newTestTokenService()
+	now := time.Now()
+
+	require.NoError(t, cache.SetActivity(ctx, 1, now.Add(time.Minute), now.Add(time.Hour), CouponActive))
+	_, err := service.IssueToken(ctx, 1, 1001)
+	assert.ErrorIs(t, err, ErrNotStarted)
+
+	require.NoError(t, cache.SetActivity(ctx, 1, now.Add(-time.Hour), now.Add(-time.Minute), CouponActive))
+	_, err = service.IssueToken(ctx, 1, 1001)
+	assert.ErrorIs(t, err, ErrEnded)
+
+	require.NoError(t, cache.SetActivity(ctx, 1, now.Add(-time.Minute), now.Add(time.Hour), CouponActive))
+	token, err := service.IssueToken(ctx, 1, 1001)
+	require.NoError(t, err)
+	assert.NotEmpty(t, token.Token)
+	assert.WithinDuration(t, now.Add(time.Minute), token.ExpireAt, time.Second)
+
+	// 未缓存活动信息
+	repo.coupons[2] = &Coupon{ID: 2, StartTime: now.Add(-time.Minute), EndTime: now.Add(time.Hour), Status: CouponActive}
+	_, err = service.IssueToken(ctx, 2, 1001)
+	require.NoError(t, err)
+
+	_, err = service.IssueToken(ctx, 3, 1001)
+	assert.ErrorIs(t, err, ErrCouponNotFound)
+}
+
+// 测试秒杀校验并消费令牌，令牌不能重复使用
+func TestSeckill_Token(t *testing.T) {
+	ctx := context.Background()
+	service, _, cache := newTestTokenService()
+	now := time.Now()
+	cache.stocks[1] = 10
+	require.NoError(t, cache.SetActivity(ctx, 1, now.Add(-time.Minute), now.Add(time.Hour), CouponActive))
+
+	resp, err := service.Seckill(ctx, &SeckillRequest{UserID: 1001, CouponID: 1})
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+	assert.False(t, resp.Success)
+	assert.Equal(t, 0, cache.decrCalls)
+
+	// 其他用户的令牌不能使用
+	other, err := service.IssueToken(ctx, 1, 1002)
+	require.NoError(t, err)
+	_, err = service.Seckill(ctx, &SeckillRequest{UserID: 1001, CouponID: 1, Token: other.Token})
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+
+	token, err := service.IssueToken(ctx, 1, 1001)
+	require.NoError(t, err)
+	resp, err = service.Seckill(ctx, &SeckillRequest{UserID: 1001, CouponID: 1, Token: token.Token})
+	require.NoError(t, err)
+	assert.True(t, resp.Success)
+
+	_, err = service.Seckill(ctx, &SeckillRequest{UserID: 1001, CouponID: 1, Token: token.Token})
+	assert.ErrorIs(t, err, ErrTokenUsed)
+	assert.Equal(t, 1, cache.decrCalls)
+}
+
+// 测试 Redis 活动信息读取和令牌判重
+func TestRedisCache_ActivityAndToken(t *testing.T) {
+	cacheRepo, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	now := time.Now()
+
+	_, _, _, err := cacheRepo.GetActivity(ctx, 1)
+	assert.ErrorIs(t, err, ErrCouponNotFound)
+
+	require.NoError(t, cacheRepo.SetActivity(ctx, 1, now, now.Add(time.Hour), CouponActive))
+	start, end, status, err := cacheRepo.GetActivity(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, now.UnixMilli(), start.UnixMilli())
+	assert.Equal(t, now.Add(time.Hour).UnixMilli(), end.UnixMilli())
+	assert.Equal(t, CouponActive, status)
+
+	ok, err := cacheRepo.ConsumeToken(ctx, "nonce", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = cacheRepo.ConsumeToken(ctx, "nonce", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
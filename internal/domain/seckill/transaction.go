@@ -0,0 +1,126 @@
+package seckill
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"rag-agent/internal/infrastructure/mq"
+	"rag-agent/pkg/tracing"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// seckillInTransaction 以事务消息完成秒杀：先发送订单半消息，再在本地事务中扣减 Redis 库存
+// 扣减成功提交消息，扣减失败回滚消息；Redis 调用出错时扣减结果未知，由回查根据订单扣减记录决定，
+// 此时同样写入处理中标记并返回处理中，用户通过订单状态查询最终结果
+// 半消息对消费者不可见，不会出现扣减成功但消息丢失、或消息已投递但未扣减的情况，无需补偿回滚
+func (s *Service) seckillInTransaction(ctx context.Context, producer TransactionalMQProducer, req *SeckillRequest) (*SeckillResponse, error) {
+	// 1. 先生成订单ID，订单扣减记录以订单ID为 key
+	orderID, err := s.idGen.NextID()
+	if err != nil {
+		log.Printf("生成订单ID失败: %v", err)
+		return &SeckillResponse{
+			Success: false,
+			Message: "系统错误",
+		}, err
+	}
+
+	order := &Order{
+		ID:        orderID,
+		UserID:    req.UserID,
+		CouponID:  req.CouponID,
+		Status:    OrderPending,
+		CreatedAt: time.Now(),
+	}
+
+	// 2. 发送半消息，在本地事务中校验活动时间、一人一单并扣减库存
+	var (
+		executed  bool
+		stock     int64
+		deductErr error
+	)
+	state, err := producer.SendOrderMessageInTransaction(ctx, order, func(ctx context.Context) mq.TransactionState {
+		executed = true
+		stock, deductErr = s.cache.DecrStockForOrder(ctx, order.CouponID, order.UserID, order.ID)
+		if deductErr == nil && stock < 0 {
+			return mq.TransactionRollback
+		}
+
+		// 提交消息前写入处理中标记，保证消费者落库后能够清除；回查回滚时同样清除
+		if markErr := s.cache.SetOrderProcessing(ctx, order, processingMarkerTTL); markErr != nil {
+			log.Printf("写入订单处理中标记失败: %v, orderID=%d", markErr, order.ID)
+		}
+		if deductErr != nil {
+			// 脚本可能已经执行，交给回查确认
+			return mq.TransactionUnknown
+		}
+		return mq.TransactionCommit
+	})
+	if err != nil {
+		// 半消息未发送成功时不会执行本地事务，库存未扣减
+		log.Printf("发送订单事务消息失败: %v, orderID=%d", err, order.ID)
+		return &SeckillResponse{
+			Success: false,
+			Message: "秒杀失败，请重试",
+		}, err
+	}
+	if !executed {
+		// 本地事务未执行时没有扣减记录，消息会被回查回滚
+		log.Printf("订单事务消息未执行本地事务: orderID=%d, state=%s", order.ID, state)
+		return &SeckillResponse{
+			Success: false,
+			Message: "秒杀失败，请重试",
+		}, ErrLocalTxNotExecuted
+	}
+	if deductErr != nil {
+		// 回查可能提交订单，不能告知用户失败
+		log.Printf("扣减库存失败: %v, orderID=%d, 由事务回查确认", deductErr, order.ID)
+		return &SeckillResponse{
+			Success: true,
+			Message: "请求处理中，请稍后查询订单状态",
+			OrderID: order.ID,
+		}, nil
+	}
+
+	// 3. 检查活动时间（-3/-4）、是否重复购买（-2）以及库存是否充足（-1）
+	if stock < 0 {
+		return s.deductionFailed(req.CouponID, stock)
+	}
+
+	return &SeckillResponse{
+		Success: true,
+		Message: "秒杀成功，订单处理中",
+		OrderID: order.ID,
+	}, nil
+}
+
+// NewOrderTransactionChecker 创建订单事务消息的回查函数
+// 订单扣减记录存在说明本地事务已扣减库存，提交消息；不存在则回滚并清除处理中标记；Redis 出错时返回未知，等待下次回查
+func NewOrderTransactionChecker(cache CacheRepository) mq.TransactionChecker {
+	return func(ctx context.Context, msg *mq.Message) mq.TransactionState {
+		ctx = tracing.Extract(ctx, propagation.MapCarrier(msg.Properties))
+		var order Order
+		if err := json.Unmarshal(msg.Body, &order); err != nil {
+			tracing.Logf(ctx, "回查时解析订单消息失败: %v, msgID=%s", err, msg.ID)
+			return mq.TransactionRollback
+		}
+
+		deducted, err := cache.HasOrderDeduction(ctx, order.ID)
+		if err != nil {
+			tracing.Logf(ctx, "回查订单扣减记录失败: %v, orderID=%d", err, order.ID)
+			return mq.TransactionUnknown
+		}
+		if !deducted {
+			tracing.Logf(ctx, "回查未找到订单扣减记录，回滚消息: orderID=%d", order.ID)
+			if err := cache.ClearOrderProcessing(ctx, &order); err != nil {
+				tracing.Logf(ctx, "回查回滚时清除订单处理中标记失败: %v, orderID=%d", err, order.ID)
+			}
+			return mq.TransactionRollback
+		}
+
+		tracing.Logf(ctx, "回查确认订单已扣减库存，提交消息: orderID=%d", order.ID)
+		return mq.TransactionCommit
+	}
+}
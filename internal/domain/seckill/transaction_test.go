@@ -0,0 +1,151 @@
+package seckill
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rag-agent/config"
+	"rag-agent/internal/infrastructure/mq"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 扣减库存时 Redis 返回错误的缓存，deductFirst 为 true 时模拟脚本已执行但响应超时
+type flakyDeductCache struct {
+	*TestOrderCache
+	deductFirst bool
+}
+
+func (c *flakyDeductCache) DecrStockForOrder(ctx context.Context, couponID, userID, orderID int64) (int64, error) {
+	if c.deductFirst {
+		c.TestOrderCache.DecrStockForOrder(ctx, couponID, userID, orderID)
+	}
+	return 0, assert.AnError
+}
+
+// 通过进程内消息队列的事务消息组装完整秒杀链路
+func newTxTestFlow(t *testing.T, repo *TestRepository, cache CacheRepository) (*Service, *mq.MemoryBroker) {
+	cfg := &config.SeckillConfig{OrderTimeout: time.Minute, MaxReconsume: 100}
+	broker := mq.NewMemoryBroker(mq.MemoryConfig{
+		RetryDelay:               10 * time.Millisecond,
+		CheckTransaction:         NewOrderTransactionChecker(cache),
+		TransactionCheckInterval: 10 * time.Millisecond,
+	})
+
+	orderConsumer := NewOrderConsumer(repo, cache, cfg)
+	c, err := broker.NewConsumer(mq.ConsumerConfig{GroupName: "seckill_group", Topic: "seckill_order", Tag: OrderMessageTag}, orderConsumer.HandleMessage)
+	require.NoError(t, err)
+	require.NoError(t, c.Start())
+	t.Cleanup(func() { c.Shutdown() })
+
+	producer := NewTransactionalOrderMQProducer(broker, broker, "seckill_order")
+	return NewService(repo, cache, producer, &TestIDGenerator{}, &TestLocker{}, cfg), broker
+}
+
+// 测试扣减成功提交订单消息，库存不足回滚
+func TestSeckillInTransaction(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	repo.stocks[1] = 2
+	cache.stocks[1] = 2
+	service, _ := newTxTestFlow(t, repo, cache)
+
+	var orderIDs []int64
+	for userID := int64(1001); userID <= 1003; userID++ {
+		resp, err := service.Seckill(ctx, &SeckillRequest{UserID: userID, CouponID: 1})
+		if userID == 1003 {
+			assert.ErrorIs(t, err, ErrStockNotEnough)
+			assert.False(t, resp.Success)
+			continue
+		}
+		require.NoError(t, err)
+		assert.True(t, resp.Success)
+		orderIDs = append(orderIDs, resp.OrderID)
+	}
+
+	for _, orderID := range orderIDs {
+		assert.Eventually(t, func() bool {
+			order, err := service.GetOrder(ctx, orderID)
+			return err == nil && order.State == OrderStatePending
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	repo.mu.Lock()
+	assert.Len(t, repo.orders, 2)
+	assert.Equal(t, int64(0), repo.stocks[1])
+	repo.mu.Unlock()
+	cache.mu.Lock()
+	assert.Empty(t, cache.processing)
+	cache.mu.Unlock()
+}
+
+// 测试扣减结果未知时由回查决定：已扣减则提交，未扣减则回滚
+func TestSeckillInTransaction_CheckBack(t *testing.T) {
+	for _, deductFirst := range []bool{true, false} {
+		ctx := context.Background()
+		repo := NewTestRepository()
+		cache := &flakyDeductCache{TestOrderCache: NewTestOrderCache(), deductFirst: deductFirst}
+		repo.stocks[1] = 1
+		cache.stocks[1] = 1
+		service, _ := newTxTestFlow(t, repo, cache)
+
+		resp, err := service.Seckill(ctx, &SeckillRequest{UserID: 1001, CouponID: 1})
+		require.NoError(t, err)
+		assert.True(t, resp.Success)
+		assert.NotZero(t, resp.OrderID)
+
+		if deductFirst {
+			assert.Eventually(t, func() bool {
+				repo.mu.Lock()
+				defer repo.mu.Unlock()
+				return len(repo.orders) == 1
+			}, time.Second, 10*time.Millisecond)
+			continue
+		}
+
+		// 回查回滚后清除处理中标记，订单查询不再显示处理中
+		assert.Eventually(t, func() bool {
+			processing, err := cache.GetProcessingOrder(ctx, resp.OrderID)
+			return err == nil && processing == nil
+		}, time.Second, 10*time.Millisecond)
+		repo.mu.Lock()
+		assert.Empty(t, repo.orders)
+		repo.mu.Unlock()
+		cache.mu.Lock()
+		assert.Equal(t, int64(1), cache.stocks[1])
+		cache.mu.Unlock()
+	}
+}
+
+// 测试半消息发送失败时不扣减库存
+func TestSeckillInTransaction_SendFailed(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTestRepository()
+	cache := NewTestOrderCache()
+	cache.stocks[1] = 1
+	service, broker := newTxTestFlow(t, repo, cache)
+	require.NoError(t, broker.Shutdown())
+
+	resp, err := service.Seckill(ctx, &SeckillRequest{UserID: 1001, CouponID: 1})
+	assert.ErrorIs(t, err, mq.ErrBrokerClosed)
+	assert.False(t, resp.Success)
+
+	cache.mu.Lock()
+	assert.Equal(t, int64(1), cache.stocks[1])
+	assert.Empty(t, cache.processing)
+	cache.mu.Unlock()
+}
+
+func TestOrderTransactionChecker(t *testing.T) {
+	ctx := context.Background()
+	cache := NewTestOrderCache()
+	cache.deductions[9001] = true
+	check := NewOrderTransactionChecker(cache)
+
+	assert.Equal(t, mq.TransactionCommit, check(ctx, &mq.Message{Body: []byte(`{"id":"9001"}`)}))
+	assert.Equal(t, mq.TransactionRollback, check(ctx, &mq.Message{Body: []byte(`{"id":9002}`)}))
+	assert.Equal(t, mq.TransactionRollback, check(ctx, &mq.Message{Body: []byte("bad")}))
+}
@@ -0,0 +1,475 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMaxReconsumeTimes = 16              // 与 RocketMQ 默认最大重试次数一致
+	defaultRetryDelay        = time.Second     // 默认重新投递间隔
+	defaultConsumeGoroutines = 4               // 每个消费者组的默认并发数
+	defaultTransactionCheck  = 5 * time.Second // 默认事务消息回查间隔
+	defaultMaxTxChecks       = 15              // 与 RocketMQ 默认最大回查次数一致
+)
+
+var (
+	ErrBrokerClosed       = errors.New("消息队列已关闭")
+	ErrConsumerGroupExist = errors.New("消费者组已存在")
+	ErrConsumerStarted    = errors.New("消费者已启动")
+)
+
+// MemoryConfig 进程内消息队列配置
+type MemoryConfig struct {
+	MaxReconsumeTimes int32         // 最大重新投递次数，消费者未配置时使用，0 使用默认值 16
+	RetryDelay        time.Duration // 重新投递间隔，0 使用默认值 1s
+	ConsumeGoroutines int           // 每个消费者组的并发数，0 使用默认值 4
+
+	// OnDeadLetter 消息超过最大重试次数进入死信时回调，err 为最后一次消费失败的错误
+	OnDeadLetter func(group string, msg *Message, err error)
+
+	CheckTransaction         TransactionChecker // 本地事务状态未知时的回查函数，未配置时直接回滚
+	TransactionCheckInterval time.Duration      // 回查间隔，0 使用默认值 5s
+	MaxTransactionChecks     int                // 最大回查次数，超过后回滚，0 使用默认值 15
+}
+
+// MemoryBroker 进程内消息队列（基础设施层，通用）
+// 基于内存队列实现集群消费语义：每个消费者组收到订阅主题和标签的全部消息，消费失败按间隔重新投递，
+// 超过最大重试次数进入死信；事务消息在本地事务提交后才投递，状态未知时按间隔回查。
+// 消息不持久化，进程退出后未消费的消息和未决的事务消息丢失，用于测试和本地运行
+type MemoryBroker struct {
+	cfg MemoryConfig
+	seq atomic.Int64
+
+	mu          sync.Mutex
+	closed      bool
+	groups      map[string]*memoryConsumer // 消费者组名 → 消费者
+	backlog     []*Message                 // 发送时没有消费者组订阅的消息，等待订阅后投递
+	deadLetters map[string][]*Message      // 消费者组名 → 死信消息
+	checks      map[*time.Timer]struct{}   // 等待回查的事务消息
+}
+
+// NewMemoryBroker 创建进程内消息队列
+func NewMemoryBroker(cfg MemoryConfig) *MemoryBroker {
+	if cfg.MaxReconsumeTimes <= 0 {
+		cfg.MaxReconsumeTimes = defaultMaxReconsumeTimes
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = defaultRetryDelay
+	}
+	if cfg.ConsumeGoroutines <= 0 {
+		cfg.ConsumeGoroutines = defaultConsumeGoroutines
+	}
+	if cfg.TransactionCheckInterval <= 0 {
+		cfg.TransactionCheckInterval = defaultTransactionCheck
+	}
+	if cfg.MaxTransactionChecks <= 0 {
+		cfg.MaxTransactionChecks = defaultMaxTxChecks
+	}
+	return &MemoryBroker{
+		cfg:         cfg,
+		groups:      make(map[string]*memoryConsumer),
+		deadLetters: make(map[string][]*Message),
+		checks:      make(map[*time.Timer]struct{}),
+	}
+}
+
+// SendMessage 发送消息，投递到所有订阅该主题和标签的消费者组
+func (b *MemoryBroker) SendMessage(ctx context.Context, topic, tag string, body []byte, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("发送消息失败: %w", err)
+	}
+	return b.publish(b.newMessage(ctx, topic, tag, body, keys))
+}
+
+// SendOrderly 发送顺序消息；每个消费者组的队列按发送顺序投递，分片键只记录在消息上
+func (b *MemoryBroker) SendOrderly(ctx context.Context, topic, tag, shardingKey string, body []byte, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("发送消息失败: %w", err)
+	}
+	msg := b.newMessage(ctx, topic, tag, body, keys)
+	msg.ShardingKey = shardingKey
+	return b.publish(msg)
+}
+
+// SendBatch 批量发送消息，全部投递或在消息队列关闭时全部失败
+func (b *MemoryBroker) SendBatch(ctx context.Context, msgs []*Message) error {
+	if err := checkBatch(msgs); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("发送消息失败: %w", err)
+	}
+
+	batch := make([]*Message, 0, len(msgs))
+	for _, m := range msgs {
+		msg := b.newMessage(ctx, m.Topic, m.Tag, m.Body, m.Keys)
+		for k, v := range m.Properties {
+			if msg.Properties == nil {
+				msg.Properties = make(map[string]string, len(m.Properties))
+			}
+			msg.Properties[k] = v
+		}
+		batch = append(batch, msg)
+	}
+	return b.publish(batch...)
+}
+
+// SendAsync 发送消息后在独立协程中回调发送结果；消息队列已关闭时直接返回错误，不回调
+func (b *MemoryBroker) SendAsync(ctx context.Context, topic, tag string, body []byte, callback SendCallback, keys ...string) error {
+	if err := b.SendMessage(ctx, topic, tag, body, keys...); err != nil {
+		return err
+	}
+	go callback(nil)
+	return nil
+}
+
+// SendMessageInTransaction 执行本地事务，提交后投递消息，回滚时丢弃，未知时按间隔回查
+func (b *MemoryBroker) SendMessageInTransaction(ctx context.Context, topic, tag string, body []byte, execute LocalTransaction, keys ...string) (TransactionState, error) {
+	if err := ctx.Err(); err != nil {
+		return TransactionRollback, fmt.Errorf("发送事务消息失败: %w", err)
+	}
+	b.mu.Lock()
+	closed := b.closed
+	b.mu.Unlock()
+	if closed {
+		return TransactionRollback, ErrBrokerClosed
+	}
+
+	msg := b.newMessage(ctx, topic, tag, body, keys)
+	state := execute(ctx, msg.clone())
+	b.endTransaction(msg, state, 0)
+	return state, nil
+}
+
+// endTransaction 按本地事务状态投递、丢弃或稍后回查事务消息，checks 为已回查次数
+func (b *MemoryBroker) endTransaction(msg *Message, state TransactionState, checks int) {
+	switch state {
+	case TransactionCommit:
+		if err := b.publish(msg); err != nil {
+			log.Printf("投递已提交的事务消息失败: %v, msgID=%s", err, msg.ID)
+		}
+	case TransactionRollback:
+	default:
+		if b.cfg.CheckTransaction == nil || checks >= b.cfg.MaxTransactionChecks {
+			log.Printf("事务消息状态未知且无法继续回查，回滚: msgID=%s, checks=%d", msg.ID, checks)
+			return
+		}
+		b.scheduleCheck(msg, checks+1)
+	}
+}
+
+// scheduleCheck 间隔 TransactionCheckInterval 后回查事务消息
+func (b *MemoryBroker) scheduleCheck(msg *Message, checks int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(b.cfg.TransactionCheckInterval, func() {
+		b.mu.Lock()
+		delete(b.checks, timer)
+		b.mu.Unlock()
+
+		state := b.cfg.CheckTransaction(context.Background(), msg.clone())
+		b.endTransaction(msg, state, checks)
+	})
+	b.checks[timer] = struct{}{}
+}
+
+// newMessage 创建消息并分配消息ID，context 中的 trace context 和请求ID写入消息属性
+func (b *MemoryBroker) newMessage(ctx context.Context, topic, tag string, body []byte, keys []string) *Message {
+	msg := &Message{
+		ID:    fmt.Sprintf("%016X", b.seq.Add(1)),
+		Topic: topic,
+		Tag:   tag,
+		Keys:  append([]string(nil), keys...),
+		Body:  append([]byte(nil), body...),
+	}
+	if props := traceProperties(ctx); len(props) > 0 {
+		msg.Properties = props
+	}
+	return msg
+}
+
+// publish 按顺序投递消息到所有订阅该主题和标签的消费者组，没有消费者组订阅该主题时进入积压
+func (b *MemoryBroker) publish(msgs ...*Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrBrokerClosed
+	}
+
+	for _, msg := range msgs {
+		subscribed := false
+		for _, c := range b.groups {
+			if c.cfg.Topic != msg.Topic {
+				continue
+			}
+			subscribed = true
+			if matchTag(c.cfg.Tag, msg.Tag) {
+				c.enqueue(msg.clone())
+			}
+		}
+		if !subscribed {
+			b.backlog = append(b.backlog, msg)
+		}
+	}
+	return nil
+}
+
+// Shutdown 关闭消息队列，之后发送消息返回 ErrBrokerClosed，等待回查的事务消息被丢弃
+func (b *MemoryBroker) Shutdown() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for timer := range b.checks {
+		timer.Stop()
+	}
+	b.checks = make(map[*time.Timer]struct{})
+	return nil
+}
+
+// NewConsumer 创建消费者，同一消费者组只能有一个消费者
+// 订阅后立即投递此前没有消费者组订阅的积压消息，Start 后开始消费
+func (b *MemoryBroker) NewConsumer(cfg ConsumerConfig, handler Handler) (Consumer, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.groups[cfg.GroupName]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrConsumerGroupExist, cfg.GroupName)
+	}
+
+	maxReconsume := cfg.MaxReconsumeTimes
+	if maxReconsume <= 0 {
+		maxReconsume = b.cfg.MaxReconsumeTimes
+	}
+	c := &memoryConsumer{
+		broker:       b,
+		cfg:          cfg,
+		handler:      handler,
+		maxReconsume: maxReconsume,
+		timers:       make(map[*time.Timer]struct{}),
+		notify:       make(chan struct{}, 1),
+		stopCh:       make(chan struct{}),
+	}
+	b.groups[cfg.GroupName] = c
+
+	remaining := b.backlog[:0]
+	for _, msg := range b.backlog {
+		if msg.Topic != cfg.Topic {
+			remaining = append(remaining, msg)
+			continue
+		}
+		if matchTag(cfg.Tag, msg.Tag) {
+			c.enqueue(msg)
+		}
+	}
+	b.backlog = remaining
+
+	return c, nil
+}
+
+// DeadLetters 返回消费者组的死信消息
+func (b *MemoryBroker) DeadLetters(group string) []*Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*Message(nil), b.deadLetters[group]...)
+}
+
+// deadLetter 记录死信消息并回调
+func (b *MemoryBroker) deadLetter(group string, msg *Message, err error) {
+	b.mu.Lock()
+	b.deadLetters[group] = append(b.deadLetters[group], msg)
+	b.mu.Unlock()
+
+	log.Printf("消息超过最大重试次数进入死信: group=%s, msgID=%s, reconsumeTimes=%d, err=%v",
+		group, msg.ID, msg.ReconsumeTimes, err)
+	if b.cfg.OnDeadLetter != nil {
+		b.cfg.OnDeadLetter(group, msg, err)
+	}
+}
+
+// unsubscribe 移除消费者组
+func (b *MemoryBroker) unsubscribe(c *memoryConsumer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.groups[c.cfg.GroupName] == c {
+		delete(b.groups, c.cfg.GroupName)
+	}
+}
+
+// memoryConsumer 进程内消息队列的消费者组
+type memoryConsumer struct {
+	broker       *MemoryBroker
+	cfg          ConsumerConfig
+	handler      Handler
+	maxReconsume int32
+
+	mu      sync.Mutex
+	queue   []*Message
+	timers  map[*time.Timer]struct{} // 等待重新投递的消息
+	started bool
+	stopped bool
+
+	notify chan struct{}
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// Start 启动消费
+func (c *memoryConsumer) Start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopped {
+		return ErrBrokerClosed
+	}
+	if c.started {
+		return ErrConsumerStarted
+	}
+	c.started = true
+
+	for i := 0; i < c.broker.cfg.ConsumeGoroutines; i++ {
+		c.wg.Add(1)
+		go c.loop()
+	}
+	return nil
+}
+
+// Shutdown 停止消费，等待正在处理的消息完成
+// 队列中未消费和等待重新投递的消息被丢弃
+func (c *memoryConsumer) Shutdown() error {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return nil
+	}
+	c.stopped = true
+	for timer := range c.timers {
+		timer.Stop()
+	}
+	c.timers = nil
+	c.queue = nil
+	c.mu.Unlock()
+
+	c.broker.unsubscribe(c)
+	close(c.stopCh)
+	c.wg.Wait()
+	return nil
+}
+
+// enqueue 消息入队并唤醒消费协程
+func (c *memoryConsumer) enqueue(msg *Message) {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return
+	}
+	c.queue = append(c.queue, msg)
+	c.mu.Unlock()
+
+	c.wake()
+}
+
+func (c *memoryConsumer) wake() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// next 取出队首消息
+func (c *memoryConsumer) next() (*Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.queue) == 0 {
+		return nil, false
+	}
+	msg := c.queue[0]
+	c.queue[0] = nil
+	c.queue = c.queue[1:]
+	if len(c.queue) > 0 {
+		// 还有消息，唤醒其他消费协程
+		c.wake()
+	}
+	return msg, true
+}
+
+func (c *memoryConsumer) loop() {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		default:
+		}
+
+		if msg, ok := c.next(); ok {
+			c.consume(msg)
+			continue
+		}
+
+		select {
+		case <-c.stopCh:
+			return
+		case <-c.notify:
+		}
+	}
+}
+
+// consume 消费消息，失败时按间隔重新投递，超过最大重试次数进入死信
+func (c *memoryConsumer) consume(msg *Message) {
+	err := c.handle(msg)
+	if err == nil {
+		return
+	}
+
+	if msg.ReconsumeTimes >= c.maxReconsume {
+		c.broker.deadLetter(c.cfg.GroupName, msg, err)
+		return
+	}
+
+	retry := msg.clone()
+	retry.ReconsumeTimes++
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(c.broker.cfg.RetryDelay, func() {
+		c.mu.Lock()
+		delete(c.timers, timer)
+		c.mu.Unlock()
+		c.enqueue(retry)
+	})
+	c.timers[timer] = struct{}{}
+}
+
+// handle 调用消息处理函数，panic 视为消费失败
+func (c *memoryConsumer) handle(msg *Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("消费消息 panic: %v", r)
+		}
+	}()
+	return c.handler(context.Background(), msg)
+}
+
+// clone 复制消息元数据，消息体和属性共享
+func (m *Message) clone() *Message {
+	cp := *m
+	return &cp
+}
@@ -0,0 +1,336 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"rag-agent/pkg/tracing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder 记录收到的消息
+type recorder struct {
+	mu   sync.Mutex
+	msgs []*Message
+}
+
+func (r *recorder) handle(ctx context.Context, msg *Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, msg)
+	return nil
+}
+
+func (r *recorder) bodies() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var bodies []string
+	for _, msg := range r.msgs {
+		bodies = append(bodies, string(msg.Body))
+	}
+	return bodies
+}
+
+// 测试按主题和标签投递，每个消费者组都收到全部消息
+func TestMemoryBroker_Subscribe(t *testing.T) {
+	ctx := context.Background()
+	broker := NewMemoryBroker(MemoryConfig{ConsumeGoroutines: 1})
+
+	orders, all := &recorder{}, &recorder{}
+	c1, err := broker.NewConsumer(ConsumerConfig{GroupName: "orders", Topic: "seckill", Tag: "order || refund"}, orders.handle)
+	require.NoError(t, err)
+	c2, err := broker.NewConsumer(ConsumerConfig{GroupName: "all", Topic: "seckill"}, all.handle)
+	require.NoError(t, err)
+	_, err = broker.NewConsumer(ConsumerConfig{GroupName: "orders", Topic: "seckill"}, orders.handle)
+	assert.ErrorIs(t, err, ErrConsumerGroupExist)
+
+	require.NoError(t, c1.Start())
+	require.NoError(t, c2.Start())
+	assert.ErrorIs(t, c1.Start(), ErrConsumerStarted)
+
+	require.NoError(t, broker.SendMessage(ctx, "seckill", "order", []byte("1"), "order_1"))
+	require.NoError(t, broker.SendMessage(ctx, "seckill", "pay", []byte("2")))
+	require.NoError(t, broker.SendMessage(ctx, "seckill", "refund", []byte("3")))
+	require.NoError(t, broker.SendMessage(ctx, "other", "order", []byte("4")))
+
+	assert.Eventually(t, func() bool { return len(all.bodies()) == 3 }, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return len(orders.bodies()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"1", "2", "3"}, all.bodies())
+	assert.Equal(t, []string{"1", "3"}, orders.bodies())
+	assert.Equal(t, []string{"order_1"}, orders.msgs[0].Keys)
+	assert.NotEmpty(t, orders.msgs[0].ID)
+
+	require.NoError(t, c1.Shutdown())
+	require.NoError(t, c2.Shutdown())
+	require.NoError(t, broker.Shutdown())
+	assert.ErrorIs(t, broker.SendMessage(ctx, "seckill", "order", nil), ErrBrokerClosed)
+}
+
+// 测试订阅前发送的消息在订阅后投递
+func TestMemoryBroker_Backlog(t *testing.T) {
+	ctx := context.Background()
+	broker := NewMemoryBroker(MemoryConfig{})
+
+	require.NoError(t, broker.SendMessage(ctx, "seckill", "order", []byte("1")))
+	require.NoError(t, broker.SendMessage(ctx, "other", "order", []byte("2")))
+
+	r := &recorder{}
+	c, err := broker.NewConsumer(ConsumerConfig{GroupName: "orders", Topic: "seckill"}, r.handle)
+	require.NoError(t, err)
+	require.NoError(t, c.Start())
+	defer c.Shutdown()
+
+	assert.Eventually(t, func() bool { return len(r.bodies()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"1"}, r.bodies())
+}
+
+// 测试消费失败重新投递，超过最大重试次数进入死信
+func TestMemoryBroker_RetryAndDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	dead := make(chan *Message, 1)
+	broker := NewMemoryBroker(MemoryConfig{
+		RetryDelay: 10 * time.Millisecond,
+		OnDeadLetter: func(group string, msg *Message, err error) {
+			assert.Equal(t, "orders", group)
+			assert.EqualError(t, err, "处理失败")
+			dead <- msg
+		},
+	})
+
+	var mu sync.Mutex
+	attempts := map[string][]int32{}
+	handler := func(ctx context.Context, msg *Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[string(msg.Body)] = append(attempts[string(msg.Body)], msg.ReconsumeTimes)
+		// "ok" 第二次投递成功，"bad" 一直失败
+		if string(msg.Body) == "ok" && msg.ReconsumeTimes >= 1 {
+			return nil
+		}
+		return errors.New("处理失败")
+	}
+
+	c, err := broker.NewConsumer(ConsumerConfig{GroupName: "orders", Topic: "seckill", MaxReconsumeTimes: 2}, handler)
+	require.NoError(t, err)
+	require.NoError(t, c.Start())
+	defer c.Shutdown()
+
+	require.NoError(t, broker.SendMessage(ctx, "seckill", "order", []byte("ok")))
+	require.NoError(t, broker.SendMessage(ctx, "seckill", "order", []byte("bad")))
+
+	select {
+	case msg := <-dead:
+		assert.Equal(t, "bad", string(msg.Body))
+		assert.Equal(t, int32(2), msg.ReconsumeTimes)
+	case <-time.After(time.Second):
+		t.Fatal("消息未进入死信")
+	}
+
+	mu.Lock()
+	assert.Equal(t, []int32{0, 1}, attempts["ok"])
+	assert.Equal(t, []int32{0, 1, 2}, attempts["bad"])
+	mu.Unlock()
+
+	deadLetters := broker.DeadLetters("orders")
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, "bad", string(deadLetters[0].Body))
+}
+
+// 测试 panic 视为消费失败，关闭时放弃等待重新投递的消息
+func TestMemoryBroker_PanicAndShutdown(t *testing.T) {
+	ctx := context.Background()
+	broker := NewMemoryBroker(MemoryConfig{RetryDelay: time.Hour})
+
+	calls := make(chan struct{}, 10)
+	c, err := broker.NewConsumer(ConsumerConfig{GroupName: "orders", Topic: "seckill"}, func(ctx context.Context, msg *Message) error {
+		calls <- struct{}{}
+		panic("boom")
+	})
+	require.NoError(t, err)
+	require.NoError(t, c.Start())
+
+	require.NoError(t, broker.SendMessage(ctx, "seckill", "order", []byte("1")))
+	select {
+	case <-calls:
+	case <-time.After(time.Second):
+		t.Fatal("消息未投递")
+	}
+
+	require.NoError(t, c.Shutdown())
+	require.NoError(t, c.Shutdown())
+	assert.Empty(t, broker.DeadLetters("orders"))
+
+	// 消费者组关闭后可以重新创建
+	_, err = broker.NewConsumer(ConsumerConfig{GroupName: "orders", Topic: "seckill"}, func(ctx context.Context, msg *Message) error { return nil })
+	assert.NoError(t, err)
+}
+
+func TestMatchTag(t *testing.T) {
+	assert.True(t, matchTag("", "a"))
+	assert.True(t, matchTag("*", "a"))
+	assert.True(t, matchTag("a || b", "b"))
+	assert.False(t, matchTag("a || b", "c"))
+	assert.False(t, matchTag("a", ""))
+}
+
+// 测试事务消息：提交后投递，回滚时丢弃
+func TestMemoryBroker_Transaction(t *testing.T) {
+	ctx := context.Background()
+	broker := NewMemoryBroker(MemoryConfig{})
+
+	r := &recorder{}
+	c, err := broker.NewConsumer(ConsumerConfig{GroupName: "orders", Topic: "seckill"}, r.handle)
+	require.NoError(t, err)
+	require.NoError(t, c.Start())
+	defer c.Shutdown()
+
+	state, err := broker.SendMessageInTransaction(ctx, "seckill", "order", []byte("1"), func(ctx context.Context, msg *Message) TransactionState {
+		// 本地事务执行时消息尚未投递
+		assert.Equal(t, "1", string(msg.Body))
+		assert.Empty(t, r.bodies())
+		return TransactionCommit
+	})
+	require.NoError(t, err)
+	assert.Equal(t, TransactionCommit, state)
+
+	state, err = broker.SendMessageInTransaction(ctx, "seckill", "order", []byte("2"), func(ctx context.Context, msg *Message) TransactionState {
+		return TransactionRollback
+	})
+	require.NoError(t, err)
+	assert.Equal(t, TransactionRollback, state)
+
+	assert.Eventually(t, func() bool { return len(r.bodies()) == 1 }, time.Second, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, []string{"1"}, r.bodies())
+}
+
+// 测试本地事务状态未知时回查，回查提交后投递，超过最大回查次数回滚
+func TestMemoryBroker_TransactionCheck(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	checks := map[string]int{}
+	broker := NewMemoryBroker(MemoryConfig{
+		TransactionCheckInterval: 10 * time.Millisecond,
+		MaxTransactionChecks:     3,
+		CheckTransaction: func(ctx context.Context, msg *Message) TransactionState {
+			mu.Lock()
+			defer mu.Unlock()
+			body := string(msg.Body)
+			checks[body]++
+			// "commit" 第二次回查时确认提交，"unknown" 一直无法确认
+			if body == "commit" && checks[body] == 2 {
+				return TransactionCommit
+			}
+			return TransactionUnknown
+		},
+	})
+
+	r := &recorder{}
+	c, err := broker.NewConsumer(ConsumerConfig{GroupName: "orders", Topic: "seckill"}, r.handle)
+	require.NoError(t, err)
+	require.NoError(t, c.Start())
+	defer c.Shutdown()
+
+	unknown := func(ctx context.Context, msg *Message) TransactionState { return TransactionUnknown }
+	for _, body := range []string{"commit", "unknown"} {
+		state, err := broker.SendMessageInTransaction(ctx, "seckill", "order", []byte(body), unknown)
+		require.NoError(t, err)
+		assert.Equal(t, TransactionUnknown, state)
+	}
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return checks["unknown"] == 3
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, 2, checks["commit"])
+	assert.Equal(t, 3, checks["unknown"])
+	mu.Unlock()
+	assert.Equal(t, []string{"commit"}, r.bodies())
+
+	require.NoError(t, broker.Shutdown())
+	_, err = broker.SendMessageInTransaction(ctx, "seckill", "order", nil, unknown)
+	assert.ErrorIs(t, err, ErrBrokerClosed)
+}
+
+// 测试顺序发送、批量发送和异步发送
+func TestMemoryBroker_SendOrderlyBatchAsync(t *testing.T) {
+	ctx := context.Background()
+	broker := NewMemoryBroker(MemoryConfig{ConsumeGoroutines: 1})
+
+	r := &recorder{}
+	c, err := broker.NewConsumer(ConsumerConfig{GroupName: "orders", Topic: "seckill", Tag: "order"}, r.handle)
+	require.NoError(t, err)
+	require.NoError(t, c.Start())
+	defer c.Shutdown()
+
+	require.NoError(t, broker.SendOrderly(ctx, "seckill", "order", "coupon_1", []byte("1"), "order_1"))
+	require.NoError(t, broker.SendBatch(ctx, []*Message{
+		{Topic: "seckill", Tag: "order", Body: []byte("2"), Properties: map[string]string{"trace": "t1"}},
+		{Topic: "seckill", Tag: "pay", Body: []byte("skip")},
+		{Topic: "seckill", Tag: "order", Body: []byte("3")},
+	}))
+	done := make(chan error, 1)
+	require.NoError(t, broker.SendAsync(ctx, "seckill", "order", []byte("4"), func(err error) { done <- err }))
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("未回调发送结果")
+	}
+
+	assert.Eventually(t, func() bool { return len(r.bodies()) == 4 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"1", "2", "3", "4"}, r.bodies())
+	r.mu.Lock()
+	assert.Equal(t, "coupon_1", r.msgs[0].ShardingKey)
+	assert.Equal(t, "t1", r.msgs[1].Properties["trace"])
+	r.mu.Unlock()
+
+	assert.ErrorIs(t, broker.SendBatch(ctx, nil), ErrEmptyBatch)
+	assert.ErrorIs(t, broker.SendBatch(ctx, []*Message{{Topic: "a"}, {Topic: "b"}}), ErrBatchTopicMismatch)
+
+	require.NoError(t, broker.Shutdown())
+	err = broker.SendAsync(ctx, "seckill", "order", nil, func(err error) { t.Error("关闭后不应回调") })
+	assert.ErrorIs(t, err, ErrBrokerClosed)
+	assert.ErrorIs(t, broker.SendBatch(ctx, []*Message{{Topic: "seckill"}}), ErrBrokerClosed)
+}
+
+// 测试发送时将 trace context 和请求ID写入消息属性
+func TestMemoryBroker_TraceProperties(t *testing.T) {
+	ctx := tracing.EnsureTrace(tracing.WithRequestID(context.Background(), "req-1"))
+	broker := NewMemoryBroker(MemoryConfig{})
+
+	r := &recorder{}
+	c, err := broker.NewConsumer(ConsumerConfig{GroupName: "orders", Topic: "seckill"}, r.handle)
+	require.NoError(t, err)
+	require.NoError(t, c.Start())
+	defer c.Shutdown()
+
+	require.NoError(t, broker.SendMessage(ctx, "seckill", "order", []byte("1")))
+	require.NoError(t, broker.SendBatch(ctx, []*Message{{Topic: "seckill", Body: []byte("2"), Properties: map[string]string{tracing.RequestIDKey: "req-2"}}}))
+	require.NoError(t, broker.SendMessage(context.Background(), "seckill", "order", []byte("3")))
+	assert.Eventually(t, func() bool { return len(r.bodies()) == 3 }, time.Second, 10*time.Millisecond)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, msg := range r.msgs {
+		switch string(msg.Body) {
+		case "1":
+			assert.Equal(t, "req-1", msg.Properties[tracing.RequestIDKey])
+			assert.NotEmpty(t, msg.Properties["traceparent"])
+		case "2":
+			// 消息自带的属性优先
+			assert.Equal(t, "req-2", msg.Properties[tracing.RequestIDKey])
+		case "3":
+			assert.Empty(t, msg.Properties)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"rag-agent/pkg/tracing"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var (
+	ErrEmptyBatch         = errors.New("批量消息为空")
+	ErrBatchTopicMismatch = errors.New("批量消息的主题必须相同")
+)
+
+// Message 与具体消息队列无关的消息
+type Message struct {
+	ID             string            // 消息ID（由消息队列分配）
+	Topic          string            // 主题
+	Tag            string            // 标签
+	Keys           []string          // 业务 Key，用于查询和去重
+	ShardingKey    string            // 分片键，相同分片键的消息进入同一队列并按发送顺序存储
+	Body           []byte            // 消息体
+	Properties     map[string]string // 自定义属性，发送时写入 context 中的 W3C trace context 和请求ID
+	ReconsumeTimes int32             // 已重新投递次数
+}
+
+// Handler 消息处理函数，返回错误时消息稍后重新投递，超过最大重试次数后进入死信
+type Handler func(ctx context.Context, msg *Message) error
+
+// SendCallback 异步发送结果回调，err 为 nil 表示发送成功
+type SendCallback func(err error)
+
+// Producer 消息生产者
+type Producer interface {
+	// SendMessage 同步发送消息
+	SendMessage(ctx context.Context, topic, tag string, body []byte, keys ...string) error
+	// SendOrderly 同步发送顺序消息：分片键相同的消息进入同一队列，按发送顺序存储和投递
+	// 消费端并发消费时仍可能乱序处理，需要严格顺序的消费者应按顺序消费
+	SendOrderly(ctx context.Context, topic, tag, shardingKey string, body []byte, keys ...string) error
+	// SendBatch 同步批量发送同一主题的多条消息，一次请求全部成功或全部失败
+	// 使用消息的 Topic、Tag、Keys、Body 和 Properties，忽略其他字段
+	SendBatch(ctx context.Context, msgs []*Message) error
+	// SendAsync 异步发送消息，发送结果通过 callback 通知且只通知一次
+	// 返回错误时消息未发出，不会调用 callback
+	SendAsync(ctx context.Context, topic, tag string, body []byte, callback SendCallback, keys ...string) error
+	// Shutdown 关闭生产者
+	Shutdown() error
+}
+
+// Consumer 消息消费者
+type Consumer interface {
+	// Start 启动消费
+	Start() error
+	// Shutdown 停止消费，等待正在处理的消息完成
+	Shutdown() error
+}
+
+// TransactionState 事务消息的本地事务状态
+type TransactionState int
+
+const (
+	TransactionCommit   TransactionState = iota // 提交：消息对消费者可见
+	TransactionRollback                         // 回滚：丢弃消息
+	TransactionUnknown                          // 未知：等待消息队列回查
+)
+
+// String 返回事务状态名称
+func (s TransactionState) String() string {
+	switch s {
+	case TransactionCommit:
+		return "commit"
+	case TransactionRollback:
+		return "rollback"
+	default:
+		return "unknown"
+	}
+}
+
+// LocalTransaction 本地事务，半消息发送成功后在发送方同步执行
+type LocalTransaction func(ctx context.Context, msg *Message) TransactionState
+
+// TransactionChecker 本地事务回查：本地事务返回未知或发送方在提交前崩溃时，由消息队列调用以决定提交或回滚
+// 回查可能在任意实例上执行，只能依据消息内容和共享存储判断
+type TransactionChecker func(ctx context.Context, msg *Message) TransactionState
+
+// TransactionProducer 事务消息生产者
+type TransactionProducer interface {
+	// SendMessageInTransaction 发送半消息（对消费者不可见），执行本地事务 execute，按返回状态提交或回滚消息
+	// 返回本地事务状态；半消息发送失败时不执行本地事务并返回错误
+	SendMessageInTransaction(ctx context.Context, topic, tag string, body []byte, execute LocalTransaction, keys ...string) (TransactionState, error)
+	// Shutdown 关闭生产者
+	Shutdown() error
+}
+
+// ConsumerConfig 消费者配置
+type ConsumerConfig struct {
+	NameServerAddr    []string // NameServer 地址列表（仅 RocketMQ）
+	GroupName         string   // 消费者组名
+	Topic             string   // 主题
+	Tag               string   // 消息标签过滤，多个标签用 || 分隔，为空或 * 表示全部
+	MaxReconsumeTimes int32    // 最大重新投递次数，超过后进入死信，0 使用默认值
+}
+
+// checkBatch 校验批量消息：不能为空且主题相同
+func checkBatch(msgs []*Message) error {
+	if len(msgs) == 0 {
+		return ErrEmptyBatch
+	}
+	for _, msg := range msgs[1:] {
+		if msg.Topic != msgs[0].Topic {
+			return fmt.Errorf("%w: %s, %s", ErrBatchTopicMismatch, msgs[0].Topic, msg.Topic)
+		}
+	}
+	return nil
+}
+
+// traceProperties 返回随消息传递的 trace context（traceparent / tracestate）和请求ID，context 中没有时为空
+func traceProperties(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	tracing.Inject(ctx, carrier)
+	return carrier
+}
+
+// matchTag 判断消息标签是否满足订阅表达式
+func matchTag(expression, tag string) bool {
+	expression = strings.TrimSpace(expression)
+	if expression == "" || expression == "*" {
+		return true
+	}
+	for _, t := range strings.Split(expression, "||") {
+		if strings.TrimSpace(t) == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,10 @@ package mq
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/apache/rocketmq-client-go/v2"
 	"github.com/apache/rocketmq-client-go/v2/consumer"
@@ -10,8 +14,8 @@ import (
 	"github.com/apache/rocketmq-client-go/v2/producer"
 )
 
-// Producer RocketMQ 生产者（基础设施层，通用）
-type Producer struct {
+// RocketMQProducer RocketMQ 生产者（基础设施层，通用）
+type RocketMQProducer struct {
 	producer rocketmq.Producer
 }
 
@@ -22,13 +26,15 @@ type ProducerConfig struct {
 	RetryTimes     int      // 重试次数
 }
 
-// NewProducer 创建 RocketMQ 生产者
-func NewProducer(cfg ProducerConfig) (*Producer, error) {
+// NewRocketMQProducer 创建 RocketMQ 生产者
+func NewRocketMQProducer(cfg ProducerConfig) (*RocketMQProducer, error) {
 	// 创建生产者
+	// 按分片键哈希选择队列，没有分片键的消息随机选择队列
 	p, err := rocketmq.NewProducer(
 		producer.WithNameServer(cfg.NameServerAddr),
 		producer.WithGroupName(cfg.GroupName),
 		producer.WithRetry(cfg.RetryTimes),
+		producer.WithQueueSelector(producer.NewHashQueueSelector()),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("创建 RocketMQ Producer 失败: %w", err)
@@ -40,14 +46,13 @@ func NewProducer(cfg ProducerConfig) (*Producer, error) {
 		return nil, fmt.Errorf("启动 RocketMQ Producer 失败: %w", err)
 	}
 
-	return &Producer{
+	return &RocketMQProducer{
 		producer: p,
 	}, nil
 }
 
-// SendMessage 发送消息（通用方法）
-func (p *Producer) SendMessage(ctx context.Context, topic, tag string, body []byte, keys ...string) error {
-	// 构建消息
+// newRocketMQMessage 构建 RocketMQ 消息，context 中的 trace context 和请求ID写入用户属性
+func newRocketMQMessage(ctx context.Context, topic, tag string, body []byte, keys []string) *primitive.Message {
 	msg := &primitive.Message{
 		Topic: topic,
 		Body:  body,
@@ -63,8 +68,73 @@ func (p *Producer) SendMessage(ctx context.Context, topic, tag string, body []by
 		msg.WithKeys(keys)
 	}
 
+	// 设置链路追踪属性
+	for k, v := range traceProperties(ctx) {
+		msg.WithProperty(k, v)
+	}
+
+	return msg
+}
+
+// SendMessage 发送消息（通用方法）
+func (p *RocketMQProducer) SendMessage(ctx context.Context, topic, tag string, body []byte, keys ...string) error {
+	return p.sendSync(ctx, newRocketMQMessage(ctx, topic, tag, body, keys))
+}
+
+// SendOrderly 发送顺序消息，按分片键哈希选择队列
+func (p *RocketMQProducer) SendOrderly(ctx context.Context, topic, tag, shardingKey string, body []byte, keys ...string) error {
+	msg := newRocketMQMessage(ctx, topic, tag, body, keys)
+	msg.WithShardingKey(shardingKey)
+	return p.sendSync(ctx, msg)
+}
+
+// SendBatch 批量发送消息，多条消息编码为一个请求发送到同一队列
+func (p *RocketMQProducer) SendBatch(ctx context.Context, msgs []*Message) error {
+	if err := checkBatch(msgs); err != nil {
+		return err
+	}
+
+	rmqMsgs := make([]*primitive.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		rmqMsg := newRocketMQMessage(ctx, msg.Topic, msg.Tag, msg.Body, msg.Keys)
+		// Tag 和 Key 也保存在属性中，逐个追加而不是整体替换
+		for k, v := range msg.Properties {
+			rmqMsg.WithProperty(k, v)
+		}
+		rmqMsgs = append(rmqMsgs, rmqMsg)
+	}
+	return p.sendSync(ctx, rmqMsgs...)
+}
+
+// SendAsync 异步发送消息
+func (p *RocketMQProducer) SendAsync(ctx context.Context, topic, tag string, body []byte, callback SendCallback, keys ...string) error {
+	msg := newRocketMQMessage(ctx, topic, tag, body, keys)
+
+	// 客户端在请求失败时可能多次调用回调，只通知第一次的结果
+	var once sync.Once
+	err := p.producer.SendAsync(ctx, func(ctx context.Context, result *primitive.SendResult, err error) {
+		once.Do(func() {
+			switch {
+			case err != nil:
+				callback(fmt.Errorf("发送消息失败: %w", err))
+			case result.Status != primitive.SendOK:
+				callback(fmt.Errorf("消息发送状态异常: %v", result.Status))
+			default:
+				callback(nil)
+			}
+		})
+	}, msg)
+	if err != nil {
+		return fmt.Errorf("发送消息失败: %w", err)
+	}
+
+	return nil
+}
+
+// sendSync 同步发送消息并检查发送状态，多条消息时批量发送
+func (p *RocketMQProducer) sendSync(ctx context.Context, msgs ...*primitive.Message) error {
 	// 发送消息
-	result, err := p.producer.SendSync(ctx, msg)
+	result, err := p.producer.SendSync(ctx, msgs...)
 	if err != nil {
 		return fmt.Errorf("发送消息失败: %w", err)
 	}
@@ -78,60 +148,211 @@ func (p *Producer) SendMessage(ctx context.Context, topic, tag string, body []by
 }
 
 // Shutdown 关闭生产者
-func (p *Producer) Shutdown() error {
+func (p *RocketMQProducer) Shutdown() error {
 	return p.producer.Shutdown()
 }
 
-// Consumer RocketMQ 消费者（基础设施层，通用）
-type Consumer struct {
+// RocketMQConsumer RocketMQ 消费者（基础设施层，通用）
+// 超过最大重试次数的消息由 RocketMQ 投递到死信主题 %DLQ%<GroupName>
+type RocketMQConsumer struct {
 	consumer rocketmq.PushConsumer
 }
 
-// ConsumerConfig 消费者配置
-type ConsumerConfig struct {
-	NameServerAddr []string // NameServer 地址列表
-	GroupName      string   // 消费者组名
-	Topic          string   // 主题
-	Tag            string   // 消息标签过滤
-}
-
-// MessageHandler 消息处理函数类型
-type MessageHandler func(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error)
-
-// NewConsumer 创建 RocketMQ 消费者
-func NewConsumer(cfg ConsumerConfig, handler MessageHandler) (*Consumer, error) {
-	// 创建消费者
-	c, err := rocketmq.NewPushConsumer(
+// NewRocketMQConsumer 创建 RocketMQ 消费者
+func NewRocketMQConsumer(cfg ConsumerConfig, handler Handler) (*RocketMQConsumer, error) {
+	opts := []consumer.Option{
 		consumer.WithNameServer(cfg.NameServerAddr),
 		consumer.WithGroupName(cfg.GroupName),
 		consumer.WithConsumerModel(consumer.Clustering), // 集群模式
-	)
+		// 每次只投递一条消息：消费失败时 RocketMQ 重新投递整批消息，单条投递避免一条坏消息拖累同批其他消息
+		consumer.WithConsumeMessageBatchMaxSize(1),
+	}
+	if cfg.MaxReconsumeTimes > 0 {
+		opts = append(opts, consumer.WithMaxReconsumeTimes(cfg.MaxReconsumeTimes))
+	}
+
+	// 创建消费者
+	c, err := rocketmq.NewPushConsumer(opts...)
 	if err != nil {
 		return nil, fmt.Errorf("创建 RocketMQ Consumer 失败: %w", err)
 	}
 
 	// 订阅主题
+	expression := cfg.Tag
+	if expression == "" {
+		expression = "*"
+	}
 	selector := consumer.MessageSelector{
 		Type:       consumer.TAG,
-		Expression: cfg.Tag,
+		Expression: expression,
 	}
 
-	err = c.Subscribe(cfg.Topic, selector, handler)
+	err = c.Subscribe(cfg.Topic, selector, func(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		for _, msg := range msgs {
+			if err := handler(ctx, fromRocketMQ(msg)); err != nil {
+				// 返回失败，RocketMQ 会自动重试
+				return consumer.ConsumeRetryLater, err
+			}
+		}
+		return consumer.ConsumeSuccess, nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("订阅主题失败: %w", err)
 	}
 
-	return &Consumer{
+	return &RocketMQConsumer{
 		consumer: c,
 	}, nil
 }
 
+// fromRocketMQ 转换为通用消息
+func fromRocketMQ(msg *primitive.MessageExt) *Message {
+	m := fromRocketMQMessage(&msg.Message)
+	m.ID = msg.MsgId
+	m.ReconsumeTimes = msg.ReconsumeTimes
+	return m
+}
+
+// fromRocketMQMessage 转换为通用消息（未分配消息ID的消息）
+func fromRocketMQMessage(msg *primitive.Message) *Message {
+	var keys []string
+	if k := msg.GetKeys(); k != "" {
+		keys = strings.Split(k, primitive.PropertyKeySeparator)
+	}
+	return &Message{
+		Topic:       msg.Topic,
+		Tag:         msg.GetTags(),
+		Keys:        keys,
+		ShardingKey: msg.GetShardingKey(),
+		Body:        msg.Body,
+		Properties:  msg.GetProperties(),
+	}
+}
+
 // Start 启动消费者
-func (c *Consumer) Start() error {
+func (c *RocketMQConsumer) Start() error {
 	return c.consumer.Start()
 }
 
 // Shutdown 关闭消费者
-func (c *Consumer) Shutdown() error {
+func (c *RocketMQConsumer) Shutdown() error {
 	return c.consumer.Shutdown()
 }
+
+// localTxKeyProperty 本地事务 key 消息属性，监听器据此找到本次发送对应的本地事务
+const localTxKeyProperty = "LOCAL_TX_KEY"
+
+// RocketMQTransactionProducer RocketMQ 事务消息生产者（基础设施层，通用）
+// 生产者组需与普通生产者不同：Broker 回查时向组内任一生产者发起
+type RocketMQTransactionProducer struct {
+	producer rocketmq.TransactionProducer
+	listener *transactionListener
+	seq      atomic.Int64
+}
+
+// NewRocketMQTransactionProducer 创建 RocketMQ 事务消息生产者
+func NewRocketMQTransactionProducer(cfg ProducerConfig, checker TransactionChecker) (*RocketMQTransactionProducer, error) {
+	listener := &transactionListener{checker: checker}
+
+	// 创建生产者
+	p, err := rocketmq.NewTransactionProducer(
+		listener,
+		producer.WithNameServer(cfg.NameServerAddr),
+		producer.WithGroupName(cfg.GroupName),
+		producer.WithRetry(cfg.RetryTimes),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("创建 RocketMQ 事务 Producer 失败: %w", err)
+	}
+
+	// 启动生产者
+	err = p.Start()
+	if err != nil {
+		return nil, fmt.Errorf("启动 RocketMQ 事务 Producer 失败: %w", err)
+	}
+
+	return &RocketMQTransactionProducer{
+		producer: p,
+		listener: listener,
+	}, nil
+}
+
+// SendMessageInTransaction 发送半消息，执行本地事务并提交或回滚
+func (p *RocketMQTransactionProducer) SendMessageInTransaction(ctx context.Context, topic, tag string, body []byte, execute LocalTransaction, keys ...string) (TransactionState, error) {
+	msg := newRocketMQMessage(ctx, topic, tag, body, keys)
+
+	// 本地事务由监听器在发送的 goroutine 中同步执行，发送结束后移除
+	txKey := strconv.FormatInt(p.seq.Add(1), 10)
+	msg.WithProperty(localTxKeyProperty, txKey)
+	p.listener.pending.Store(txKey, &pendingTransaction{ctx: ctx, execute: execute})
+	defer p.listener.pending.Delete(txKey)
+
+	result, err := p.producer.SendMessageInTransaction(ctx, msg)
+	if err != nil {
+		return TransactionRollback, fmt.Errorf("发送事务消息失败: %w", err)
+	}
+
+	// 半消息未发送成功时不会执行本地事务
+	if result.Status != primitive.SendOK {
+		return TransactionRollback, fmt.Errorf("事务消息发送状态异常: %v", result.Status)
+	}
+
+	return fromLocalTransactionState(result.State), nil
+}
+
+// Shutdown 关闭生产者
+func (p *RocketMQTransactionProducer) Shutdown() error {
+	return p.producer.Shutdown()
+}
+
+// pendingTransaction 正在发送的事务消息对应的本地事务
+type pendingTransaction struct {
+	ctx     context.Context
+	execute LocalTransaction
+}
+
+// transactionListener 适配 RocketMQ 事务监听器
+type transactionListener struct {
+	checker TransactionChecker
+	pending sync.Map // 本地事务 key → *pendingTransaction
+}
+
+// ExecuteLocalTransaction 半消息发送成功后执行本地事务
+func (l *transactionListener) ExecuteLocalTransaction(msg *primitive.Message) primitive.LocalTransactionState {
+	v, ok := l.pending.Load(msg.GetProperty(localTxKeyProperty))
+	if !ok {
+		return primitive.UnknowState
+	}
+	tx := v.(*pendingTransaction)
+	return toLocalTransactionState(tx.execute(tx.ctx, fromRocketMQMessage(msg)))
+}
+
+// CheckLocalTransaction Broker 回查本地事务状态
+func (l *transactionListener) CheckLocalTransaction(msg *primitive.MessageExt) primitive.LocalTransactionState {
+	if l.checker == nil {
+		return primitive.UnknowState
+	}
+	return toLocalTransactionState(l.checker(context.Background(), fromRocketMQ(msg)))
+}
+
+func toLocalTransactionState(state TransactionState) primitive.LocalTransactionState {
+	switch state {
+	case TransactionCommit:
+		return primitive.CommitMessageState
+	case TransactionRollback:
+		return primitive.RollbackMessageState
+	default:
+		return primitive.UnknowState
+	}
+}
+
+func fromLocalTransactionState(state primitive.LocalTransactionState) TransactionState {
+	switch state {
+	case primitive.CommitMessageState:
+		return TransactionCommit
+	case primitive.RollbackMessageState:
+		return TransactionRollback
+	default:
+		return TransactionUnknown
+	}
+}
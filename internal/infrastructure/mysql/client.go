@@ -10,6 +10,7 @@ import (
 
 // Config MySQL 配置
 type Config struct {
+	DSN             string // 非空时直接使用，忽略 Host/Port/User/Password/Database
 	Host            string
 	Port            int
 	User            string
@@ -23,13 +24,16 @@ type Config struct {
 // NewClient 创建 MySQL 客户端
 func NewClient(cfg Config) (*sql.DB, error) {
 	// 构建 DSN (Data Source Name)
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		cfg.User,
-		cfg.Password,
-		cfg.Host,
-		cfg.Port,
-		cfg.Database,
-	)
+	dsn := cfg.DSN
+	if dsn == "" {
+		dsn = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			cfg.User,
+			cfg.Password,
+			cfg.Host,
+			cfg.Port,
+			cfg.Database,
+		)
+	}
 
 	// 打开数据库连接
 	db, err := sql.Open("mysql", dsn)
@@ -44,6 +48,7 @@ func NewClient(cfg Config) (*sql.DB, error) {
 
 	// 测试连接
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("连接 MySQL 失败: %w", err)
 	}
 
@@ -9,6 +9,7 @@ import (
 
 // Config Redis 配置
 type Config struct {
+	Addr     string // 非空时直接使用，忽略 Host/Port
 	Host     string
 	Port     int
 	Password string
@@ -17,8 +18,13 @@ type Config struct {
 
 // NewClient 创建 Redis 客户端
 func NewClient(cfg Config) (*redis.Client, error) {
+	addr := cfg.Addr
+	if addr == "" {
+		addr = fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	}
+
 	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Addr:     addr,
 		Password: cfg.Password,
 		DB:       cfg.DB,
 	})
@@ -26,6 +32,7 @@ func NewClient(cfg Config) (*redis.Client, error) {
 	// 测试连接
 	ctx := context.Background()
 	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
 		return nil, fmt.Errorf("连接 Redis 失败: %w", err)
 	}
 
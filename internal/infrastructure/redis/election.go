@@ -0,0 +1,113 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Election 基于分布式锁的 leader 选举
+// 各实例定时尝试获取同名锁，获取成功的实例成为 leader，由锁的 watchdog 续期；
+// 续期失败（锁丢失）时自动退位，下个周期重新竞选。Stop 时主动释放锁，其他实例可立即接任
+type Election struct {
+	locker   *Locker
+	name     string
+	interval time.Duration
+
+	leader atomic.Bool
+	lock   *Lock
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewElection 创建 leader 选举，name 为锁名，interval 为竞选间隔（应小于锁租期）
+func NewElection(locker *Locker, name string, interval time.Duration) *Election {
+	return &Election{
+		locker:   locker,
+		name:     name,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// IsLeader 当前实例是否为 leader
+func (e *Election) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Start 启动后台竞选
+func (e *Election) Start(ctx context.Context) {
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		e.campaign(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				e.resign()
+				return
+			case <-e.stopCh:
+				e.resign()
+				return
+			case <-ticker.C:
+				e.campaign(ctx)
+			}
+		}
+	}()
+}
+
+// Stop 停止竞选并释放 leader 身份
+func (e *Election) Stop() {
+	close(e.stopCh)
+	e.wg.Wait()
+}
+
+// campaign 检查当前 leader 身份，不是 leader 时尝试获取锁
+func (e *Election) campaign(ctx context.Context) {
+	if e.lock != nil {
+		select {
+		case <-e.lock.Lost():
+			log.Printf("leader 身份已丢失: %s", e.name)
+			e.lock = nil
+			e.leader.Store(false)
+		default:
+			return
+		}
+	}
+
+	lock, err := e.locker.TryLock(ctx, e.name)
+	if errors.Is(err, ErrNotObtained) {
+		return
+	}
+	if err != nil {
+		log.Printf("竞选 leader 失败: %v, name=%s", err, e.name)
+		return
+	}
+
+	e.lock = lock
+	e.leader.Store(true)
+	log.Printf("成为 leader: %s", e.name)
+}
+
+// resign 主动退位并释放锁
+func (e *Election) resign() {
+	if e.lock == nil {
+		return
+	}
+	e.leader.Store(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := e.lock.Unlock(ctx); err != nil && !errors.Is(err, ErrLockNotHeld) {
+		log.Printf("释放 leader 锁失败: %v, name=%s", err, e.name)
+	}
+	e.lock = nil
+}
@@ -0,0 +1,31 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 测试 leader 选举：同一时刻只有一个 leader，leader 退位后其他实例接任
+func TestElection(t *testing.T) {
+	client := setupTestClient(t)
+	locker := NewLocker(client, "test:lock:", time.Second)
+	ctx := context.Background()
+
+	a := NewElection(locker, "leader", 50*time.Millisecond)
+	b := NewElection(locker, "leader", 50*time.Millisecond)
+	a.Start(ctx)
+	require.Eventually(t, a.IsLeader, time.Second, 10*time.Millisecond)
+
+	b.Start(ctx)
+	defer b.Stop()
+	time.Sleep(200 * time.Millisecond)
+	assert.False(t, b.IsLeader())
+
+	a.Stop()
+	assert.False(t, a.IsLeader())
+	require.Eventually(t, b.IsLeader, time.Second, 10*time.Millisecond)
+}
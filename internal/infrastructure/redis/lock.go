@@ -0,0 +1,212 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrNotObtained 锁已被其他持有者占用
+	ErrNotObtained = errors.New("锁已被占用")
+	// ErrLockNotHeld 锁已过期或被其他持有者获取
+	ErrLockNotHeld = errors.New("锁未持有")
+)
+
+const (
+	defaultRetryInterval = 50 * time.Millisecond // 获取锁失败后的重试间隔
+	defaultLockExpire    = 10 * time.Second      // 未配置租期时的默认租期
+	minLockExpire        = 3 * time.Millisecond  // 最小租期：PX 精度为毫秒，watchdog 每 expire/3 续期
+)
+
+// 仅当锁仍由自己持有时续期
+var refreshScript = redis.NewScript(`
+	if redis.call('GET', KEYS[1]) == ARGV[1] then
+		return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	end
+	return 0
+`)
+
+// 仅当锁仍由自己持有时删除
+var releaseScript = redis.NewScript(`
+	if redis.call('GET', KEYS[1]) == ARGV[1] then
+		return redis.call('DEL', KEYS[1])
+	end
+	return 0
+`)
+
+// Locker Redis 分布式锁
+// 使用 SET NX PX 加锁，value 为持有者唯一 token；解锁和续期通过 Lua 脚本比较 token，
+// 不会误删其他持有者的锁。持有期间由 watchdog 每 expire/3 续期一次
+type Locker struct {
+	client        *redis.Client
+	prefix        string
+	expire        time.Duration
+	retryInterval time.Duration
+}
+
+// NewLocker 创建分布式锁，key 为 prefix + name，租期为 expire
+// expire 小于 3ms（包括未配置）时使用默认租期 10s，避免创建永不过期的锁
+func NewLocker(client *redis.Client, prefix string, expire time.Duration) *Locker {
+	if expire < minLockExpire {
+		expire = defaultLockExpire
+	}
+	return &Locker{
+		client:        client,
+		prefix:        prefix,
+		expire:        expire,
+		retryInterval: defaultRetryInterval,
+	}
+}
+
+// TryLock 尝试获取一次锁，锁被占用时返回 ErrNotObtained
+func (l *Locker) TryLock(ctx context.Context, name string) (*Lock, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	key := l.prefix + name
+	ok, err := l.client.SetNX(ctx, key, token, l.expire).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取锁失败: %w", err)
+	}
+	if !ok {
+		return nil, ErrNotObtained
+	}
+
+	lock := &Lock{
+		client: l.client,
+		key:    key,
+		token:  token,
+		expire: l.expire,
+		stopCh: make(chan struct{}),
+		lostCh: make(chan struct{}),
+	}
+	lock.wg.Add(1)
+	go lock.watchdog()
+	return lock, nil
+}
+
+// Lock 获取锁，锁被占用时按重试间隔重试，直到成功或 ctx 结束
+// ctx 结束时返回 ErrNotObtained
+func (l *Locker) Lock(ctx context.Context, name string) (*Lock, error) {
+	ticker := time.NewTicker(l.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		lock, err := l.TryLock(ctx, name)
+		if !errors.Is(err, ErrNotObtained) {
+			return lock, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %v", ErrNotObtained, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Lock 已获取的锁
+type Lock struct {
+	client *redis.Client
+	key    string
+	token  string
+	expire time.Duration
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	lostCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Key 返回锁的 Redis key
+func (lk *Lock) Key() string {
+	return lk.key
+}
+
+// Lost 锁丢失（续期时发现已被其他持有者获取或已过期）时关闭
+func (lk *Lock) Lost() <-chan struct{} {
+	return lk.lostCh
+}
+
+// Refresh 手动续期
+func (lk *Lock) Refresh(ctx context.Context) error {
+	n, err := refreshScript.Run(ctx, lk.client, []string{lk.key}, lk.token, lk.expire.Milliseconds()).Int64()
+	if err != nil {
+		return fmt.Errorf("续期锁失败: %w", err)
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Unlock 停止续期并释放锁，锁已不属于自己时返回 ErrLockNotHeld
+func (lk *Lock) Unlock(ctx context.Context) error {
+	lk.stopWatchdog()
+
+	n, err := releaseScript.Run(ctx, lk.client, []string{lk.key}, lk.token).Int64()
+	if err != nil {
+		return fmt.Errorf("释放锁失败: %w", err)
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// stopWatchdog 停止续期 goroutine
+func (lk *Lock) stopWatchdog() {
+	lk.stopOnce.Do(func() {
+		close(lk.stopCh)
+	})
+	lk.wg.Wait()
+}
+
+// watchdog 每 expire/3 续期一次，锁丢失时关闭 lostCh 并退出
+func (lk *Lock) watchdog() {
+	defer lk.wg.Done()
+
+	interval := lk.expire / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lk.stopCh:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			err := lk.Refresh(ctx)
+			cancel()
+
+			if errors.Is(err, ErrLockNotHeld) {
+				log.Printf("锁已丢失: key=%s", lk.key)
+				close(lk.lostCh)
+				return
+			}
+			if err != nil {
+				// 网络抖动，下个周期重试；租期内仍持有锁
+				log.Printf("%v, key=%s", err, lk.key)
+			}
+		}
+	}
+}
+
+// newToken 生成锁持有者唯一标识
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成锁标识失败: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,126 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 设置测试环境
+func setupTestClient(t *testing.T) *redis.Client {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+		DB:   1, // 使用测试数据库
+	})
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Skip("Redis 未启动，跳过测试")
+	}
+
+	client.FlushDB(context.Background())
+	t.Cleanup(func() {
+		client.FlushDB(context.Background())
+		client.Close()
+	})
+	return client
+}
+
+// 测试锁互斥与释放
+func TestLocker_TryLock(t *testing.T) {
+	client := setupTestClient(t)
+	locker := NewLocker(client, "test:lock:", time.Second)
+	ctx := context.Background()
+
+	lock, err := locker.TryLock(ctx, "a")
+	require.NoError(t, err)
+
+	_, err = locker.TryLock(ctx, "a")
+	assert.ErrorIs(t, err, ErrNotObtained)
+
+	require.NoError(t, lock.Unlock(ctx))
+
+	lock, err = locker.TryLock(ctx, "a")
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock(ctx))
+}
+
+// 测试未配置租期时使用默认租期，锁带有 TTL
+func TestLocker_ZeroExpire(t *testing.T) {
+	assert.Equal(t, defaultLockExpire, NewLocker(nil, "test:lock:", 0).expire)
+	assert.Equal(t, defaultLockExpire, NewLocker(nil, "test:lock:", time.Millisecond).expire)
+
+	client := setupTestClient(t)
+	locker := NewLocker(client, "test:lock:", 0)
+	ctx := context.Background()
+
+	lock, err := locker.TryLock(ctx, "a")
+	require.NoError(t, err)
+	ttl, err := client.PTTL(ctx, lock.Key()).Result()
+	require.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0))
+	require.NoError(t, lock.Unlock(ctx))
+}
+
+// 测试不会释放其他持有者的锁
+func TestLock_UnlockNotHeld(t *testing.T) {
+	client := setupTestClient(t)
+	locker := NewLocker(client, "test:lock:", time.Second)
+	ctx := context.Background()
+
+	lock, err := locker.TryLock(ctx, "a")
+	require.NoError(t, err)
+
+	// 模拟锁过期后被其他持有者获取
+	client.Set(ctx, lock.Key(), "other", time.Second)
+
+	assert.ErrorIs(t, lock.Unlock(ctx), ErrLockNotHeld)
+	assert.Equal(t, "other", client.Get(ctx, lock.Key()).Val())
+}
+
+// 测试 watchdog 续期
+func TestLock_Watchdog(t *testing.T) {
+	client := setupTestClient(t)
+	locker := NewLocker(client, "test:lock:", 300*time.Millisecond)
+	ctx := context.Background()
+
+	lock, err := locker.TryLock(ctx, "a")
+	require.NoError(t, err)
+
+	// 超过租期后仍持有锁
+	time.Sleep(time.Second)
+	_, err = locker.TryLock(ctx, "a")
+	assert.ErrorIs(t, err, ErrNotObtained)
+
+	require.NoError(t, lock.Unlock(ctx))
+}
+
+// 测试带重试的加锁在 ctx 超时后放弃
+func TestLocker_LockWithRetry(t *testing.T) {
+	client := setupTestClient(t)
+	locker := NewLocker(client, "test:lock:", time.Second)
+	ctx := context.Background()
+
+	lock, err := locker.TryLock(ctx, "a")
+	require.NoError(t, err)
+
+	// 锁被占用，超时放弃
+	timeoutCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	_, err = locker.Lock(timeoutCtx, "a")
+	assert.ErrorIs(t, err, ErrNotObtained)
+
+	// 持有者释放后重试成功
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		lock.Unlock(ctx)
+	}()
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	lock, err = locker.Lock(waitCtx, "a")
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock(ctx))
+}
@@ -1,8 +1,10 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"rag-agent/internal/domain/seckill"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -29,13 +31,108 @@ func (h *SeckillHandler) Seckill(c *gin.Context) {
 
 	resp, err := h.service.Seckill(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, resp)
+		c.JSON(seckillErrorStatus(err), resp)
 		return
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
 
+// seckillErrorStatus 将秒杀业务错误映射为 HTTP 状态码
+func seckillErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, seckill.ErrAlreadyBought), errors.Is(err, seckill.ErrStockNotEnough):
+		return http.StatusConflict
+	case errors.Is(err, seckill.ErrNotStarted):
+		return http.StatusForbidden
+	case errors.Is(err, seckill.ErrNotAdmitted):
+		return http.StatusTooManyRequests
+	case errors.Is(err, seckill.ErrEnded):
+		return http.StatusGone
+	case errors.Is(err, seckill.ErrTokenInvalid), errors.Is(err, seckill.ErrTokenExpired), errors.Is(err, seckill.ErrTokenUsed):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// IssueToken 获取秒杀令牌（仅活动进行中可获取）
+func (h *SeckillHandler) IssueToken(c *gin.Context) {
+	couponID, err := strconv.ParseInt(c.Param("coupon_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "优惠券ID格式错误"})
+		return
+	}
+	var query struct {
+		UserID int64 `form:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := h.service.IssueToken(c.Request.Context(), couponID, query.UserID)
+	if errors.Is(err, seckill.ErrCouponNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(seckillErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, token)
+}
+
+// JoinQueue 加入秒杀排队
+func (h *SeckillHandler) JoinQueue(c *gin.Context) {
+	var req seckill.SeckillRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := h.service.JoinQueue(c.Request.Context(), &req)
+	if errors.Is(err, seckill.ErrStockNotEnough) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// GetQueueStatus 查询排队状态
+func (h *SeckillHandler) GetQueueStatus(c *gin.Context) {
+	couponID, err := strconv.ParseInt(c.Param("coupon_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "优惠券ID格式错误"})
+		return
+	}
+	var query struct {
+		UserID int64 `form:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := h.service.GetQueueStatus(c.Request.Context(), couponID, query.UserID)
+	if errors.Is(err, seckill.ErrNotInQueue) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
 // GetCoupon 获取优惠券信息
 func (h *SeckillHandler) GetCoupon(c *gin.Context) {
 	var couponID int64
@@ -73,3 +170,67 @@ func (h *SeckillHandler) InitStock(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "库存初始化成功"})
 }
+
+// GetOrder 查询订单状态（订单消息处理中时返回 processing）
+func (h *SeckillHandler) GetOrder(c *gin.Context) {
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单ID格式错误"})
+		return
+	}
+
+	order, err := h.service.GetOrder(c.Request.Context(), orderID)
+	if errors.Is(err, seckill.ErrOrderNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// ListOrders 查询用户的订单列表
+func (h *SeckillHandler) ListOrders(c *gin.Context) {
+	var query struct {
+		UserID int64 `form:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orders, err := h.service.ListUserOrders(c.Request.Context(), query.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"orders": orders})
+}
+
+// PayOrder 支付订单
+func (h *SeckillHandler) PayOrder(c *gin.Context) {
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单ID格式错误"})
+		return
+	}
+
+	err = h.service.PayOrder(c.Request.Context(), orderID)
+	switch {
+	case errors.Is(err, seckill.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, seckill.ErrOrderStatusInvalid):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "支付成功"})
+}
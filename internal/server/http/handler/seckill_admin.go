@@ -0,0 +1,262 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"rag-agent/internal/domain/seckill"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SeckillAdminHandler 秒杀管理处理器
+type SeckillAdminHandler struct {
+	service    *seckill.Service
+	reconciler *seckill.Reconciler
+}
+
+// NewSeckillAdminHandler 创建秒杀管理处理器
+func NewSeckillAdminHandler(service *seckill.Service, reconciler *seckill.Reconciler) *SeckillAdminHandler {
+	return &SeckillAdminHandler{
+		service:    service,
+		reconciler: reconciler,
+	}
+}
+
+// CheckStock 对账：报告进行中优惠券的 Redis/MySQL 库存差异
+func (h *SeckillAdminHandler) CheckStock(c *gin.Context) {
+	reports, err := h.reconciler.Check(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reports": reports})
+}
+
+// RepairStock 对账并修复库存差异
+func (h *SeckillAdminHandler) RepairStock(c *gin.Context) {
+	reports, err := h.reconciler.Repair(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reports": reports})
+}
+
+// CreateCoupon 创建优惠券
+func (h *SeckillAdminHandler) CreateCoupon(c *gin.Context) {
+	var req seckill.CreateCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	coupon, err := h.service.CreateCoupon(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(couponErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, coupon)
+}
+
+// UpdateCoupon 更新优惠券（只修改请求中出现的字段）
+func (h *SeckillAdminHandler) UpdateCoupon(c *gin.Context) {
+	couponID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "优惠券ID格式错误"})
+		return
+	}
+
+	var req seckill.UpdateCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	coupon, err := h.service.UpdateCoupon(c.Request.Context(), couponID, &req)
+	if err != nil {
+		c.JSON(couponErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+// ListCoupons 分页查询优惠券列表
+func (h *SeckillAdminHandler) ListCoupons(c *gin.Context) {
+	var req seckill.ListCouponsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.service.ListCoupons(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteCoupon 删除优惠券（软删除）
+func (h *SeckillAdminHandler) DeleteCoupon(c *gin.Context) {
+	couponID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "优惠券ID格式错误"})
+		return
+	}
+
+	if err := h.service.DeleteCoupon(c.Request.Context(), couponID); err != nil {
+		c.JSON(couponErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// RefundOrder 订单退款（已支付 → 已退款，归还库存）
+func (h *SeckillAdminHandler) RefundOrder(c *gin.Context) {
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单ID格式错误"})
+		return
+	}
+
+	var req seckill.RefundOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.service.RefundOrder(c.Request.Context(), orderID, req.Reason, req.Operator)
+	switch {
+	case errors.Is(err, seckill.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, seckill.ErrOrderStatusInvalid):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "退款成功"})
+}
+
+// GetOrderStatusLogs 查询订单状态变更日志
+func (h *SeckillAdminHandler) GetOrderStatusLogs(c *gin.Context) {
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单ID格式错误"})
+		return
+	}
+
+	logs, err := h.service.GetOrderStatusLogs(c.Request.Context(), orderID)
+	if errors.Is(err, seckill.ErrOrderNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"logs": logs})
+}
+
+// ListDeadLetters 分页查询死信
+func (h *SeckillAdminHandler) ListDeadLetters(c *gin.Context) {
+	var req seckill.ListDeadLettersRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.service.ListDeadLetters(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetDeadLetter 查询死信详情（包含原始消息体和失败原因）
+func (h *SeckillAdminHandler) GetDeadLetter(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "死信ID格式错误"})
+		return
+	}
+
+	dl, err := h.service.GetDeadLetter(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(deadLetterErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dl)
+}
+
+// ReplayDeadLetter 重放死信：重新发送订单消息
+func (h *SeckillAdminHandler) ReplayDeadLetter(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "死信ID格式错误"})
+		return
+	}
+
+	if err := h.service.ReplayDeadLetter(c.Request.Context(), id); err != nil {
+		c.JSON(deadLetterErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "重放成功"})
+}
+
+// DiscardDeadLetter 丢弃死信，订单未落库时归还库存
+func (h *SeckillAdminHandler) DiscardDeadLetter(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "死信ID格式错误"})
+		return
+	}
+
+	if err := h.service.DiscardDeadLetter(c.Request.Context(), id); err != nil {
+		c.JSON(deadLetterErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "丢弃成功"})
+}
+
+// deadLetterErrorStatus 将死信管理错误映射为 HTTP 状态码
+func deadLetterErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, seckill.ErrDeadLetterNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, seckill.ErrDeadLetterHandled), errors.Is(err, seckill.ErrDeadLetterInvalid), errors.Is(err, seckill.ErrLockFailed):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// couponErrorStatus 将优惠券管理错误映射为 HTTP 状态码
+func couponErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, seckill.ErrCouponInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, seckill.ErrCouponNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, seckill.ErrStockNotEnough), errors.Is(err, seckill.ErrLockFailed):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"rag-agent/internal/domain/seckill"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试秒杀业务错误映射的 HTTP 状态码
+func TestSeckillErrorStatus(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+	}{
+		{seckill.ErrStockNotEnough, http.StatusConflict},
+		{seckill.ErrAlreadyBought, http.StatusConflict},
+		{seckill.ErrNotAdmitted, http.StatusTooManyRequests},
+		{seckill.ErrNotStarted, http.StatusForbidden},
+		{seckill.ErrEnded, http.StatusGone},
+		{seckill.ErrTokenUsed, http.StatusUnauthorized},
+		{fmt.Errorf("扣减库存失败: %w", seckill.ErrStockNotEnough), http.StatusConflict},
+		{assert.AnError, http.StatusInternalServerError},
+	}
+
+	for _, tc := range cases {
+		assert.Equal(t, tc.status, seckillErrorStatus(tc.err), tc.err.Error())
+	}
+}
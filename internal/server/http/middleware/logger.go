@@ -4,6 +4,8 @@ import (
 	"log"
 	"time"
 
+	"rag-agent/pkg/tracing"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -19,13 +21,14 @@ func Logger() gin.HandlerFunc {
 		end := time.Now()
 		latency := end.Sub(start)
 
-		log.Printf("[%s] %s %s | %d | %v | %s",
+		log.Printf("[%s] %s %s | %d | %v | %s | %s",
 			c.Request.Method,
 			path,
 			query,
 			c.Writer.Status(),
 			latency,
 			c.ClientIP(),
+			tracing.RequestID(c.Request.Context()),
 		)
 	}
 }
@@ -0,0 +1,278 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"rag-agent/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// fallbackLogInterval Redis 不可用时降级日志的最小间隔，避免刷屏
+	fallbackLogInterval = 10 * time.Second
+	// localSweepInterval 本地令牌桶清理间隔
+	localSweepInterval = time.Minute
+	// redisFailureCooldown Redis 限流失败后直接使用本地令牌桶的时间，避免每个请求都等待 Redis 超时
+	redisFailureCooldown = 5 * time.Second
+	// maxUserIDBodySize 读取 user_id 时允许的最大请求体字节数
+	maxUserIDBodySize = 64 << 10
+)
+
+// 令牌桶 Lua 脚本
+// KEYS[1]: 桶 key
+// ARGV[1]: 每毫秒补充的令牌数, ARGV[2]: 桶容量, ARGV[3]: 当前时间（毫秒）
+// 返回 {是否放行, 需要等待的毫秒数}
+var tokenBucketScript = redis.NewScript(`
+	local rate = tonumber(ARGV[1])
+	local capacity = tonumber(ARGV[2])
+	local now = tonumber(ARGV[3])
+
+	local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+	local tokens = tonumber(bucket[1])
+	local ts = tonumber(bucket[2])
+	if tokens == nil then
+		tokens = capacity
+		ts = now
+	end
+
+	tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+	local allowed = 0
+	local wait = 0
+	if tokens >= 1 then
+		tokens = tokens - 1
+		allowed = 1
+	else
+		wait = math.ceil((1 - tokens) / rate)
+	end
+
+	redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+	redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate) + 1000)
+	return {allowed, wait}
+`)
+
+// RateLimiter 令牌桶限流器
+// 令牌桶保存在 Redis 中，多实例共享限额；Redis 不可用时降级为进程内令牌桶，
+// 并在 redisFailureCooldown 内不再访问 Redis（熔断），冷却结束后再次尝试
+type RateLimiter struct {
+	client *redis.Client
+	cfg    config.RateLimitConfig
+
+	local       *localBuckets
+	lastWarning atomic.Int64
+	redisDownAt atomic.Int64 // 最近一次 Redis 失败时间（UnixNano），0 表示正常
+}
+
+// NewRateLimiter 创建限流器，client 为 nil 时只使用进程内令牌桶
+func NewRateLimiter(client *redis.Client, cfg config.RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		client: client,
+		cfg:    cfg,
+		local:  newLocalBuckets(),
+	}
+}
+
+// RateLimit 限流中间件，按配置的规则依次检查，任一规则超限返回 429 和 Retry-After
+func RateLimit(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !limiter.cfg.Enabled {
+			c.Next()
+			return
+		}
+
+		for _, rule := range limiter.cfg.Rules {
+			if !validRule(rule) {
+				continue
+			}
+			subject := rateLimitSubject(c, rule.Key)
+			if c.IsAborted() {
+				return
+			}
+			if subject == "" {
+				continue
+			}
+
+			key := limiter.cfg.Prefix + rule.Key + ":" + subject
+			allowed, retryAfter := limiter.Allow(c.Request.Context(), key, rule)
+			if !allowed {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "请求过于频繁，请稍后重试"})
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// Allow 从 key 对应的令牌桶取一个令牌，返回是否放行以及被拒绝时需要等待的时间
+// 无效规则（见 validRule）不限流
+func (l *RateLimiter) Allow(ctx context.Context, key string, rule config.RateLimitRule) (bool, time.Duration) {
+	if !validRule(rule) {
+		return true, 0
+	}
+	rate, capacity := bucketParams(rule)
+
+	if l.client != nil && !l.redisCoolingDown() {
+		res, err := tokenBucketScript.Run(ctx, l.client, []string{key}, rate, capacity, time.Now().UnixMilli()).Int64Slice()
+		if err == nil {
+			l.redisDownAt.Store(0)
+			return res[0] == 1, time.Duration(res[1]) * time.Millisecond
+		}
+		l.redisDownAt.Store(time.Now().UnixNano())
+		l.warnFallback(err)
+	}
+
+	return l.local.allow(key, rate, capacity, time.Now())
+}
+
+// redisCoolingDown Redis 最近失败且仍在冷却期内
+func (l *RateLimiter) redisCoolingDown() bool {
+	downAt := l.redisDownAt.Load()
+	return downAt != 0 && time.Now().UnixNano()-downAt < int64(redisFailureCooldown)
+}
+
+// warnFallback 记录降级日志（限频）
+func (l *RateLimiter) warnFallback(err error) {
+	now := time.Now().UnixNano()
+	last := l.lastWarning.Load()
+	if now-last < int64(fallbackLogInterval) || !l.lastWarning.CompareAndSwap(last, now) {
+		return
+	}
+	log.Printf("Redis 限流失败，降级为本地限流: %v", err)
+}
+
+// validRule 规则的 Limit 必须大于 0，Window 至少 1 毫秒（令牌桶按毫秒计时）
+func validRule(rule config.RateLimitRule) bool {
+	return rule.Limit > 0 && rule.Window >= time.Millisecond
+}
+
+// bucketParams 计算每毫秒补充的令牌数和桶容量，调用方保证规则有效
+func bucketParams(rule config.RateLimitRule) (float64, float64) {
+	capacity := rule.Burst
+	if capacity <= 0 {
+		capacity = rule.Limit
+	}
+	rate := float64(rule.Limit) / (float64(rule.Window) / float64(time.Millisecond))
+	return rate, float64(capacity)
+}
+
+// rateLimitSubject 根据限流维度提取限流对象，无法提取时返回空字符串（跳过该规则）
+// 客户端 IP 只采信 engine.SetTrustedProxies 配置的代理设置的 X-Forwarded-For
+func rateLimitSubject(c *gin.Context, key string) string {
+	switch key {
+	case "user":
+		return requestUserID(c)
+	case "ip":
+		return c.ClientIP()
+	case "route":
+		return c.Request.Method + ":" + c.FullPath()
+	default:
+		return ""
+	}
+}
+
+// requestUserID 从查询参数或 JSON 请求体中读取 user_id，读取后恢复请求体供后续处理器绑定
+// 请求体超过 maxUserIDBodySize 时返回 413 并终止请求，避免伪造超大请求体绕过按用户限流
+func requestUserID(c *gin.Context) string {
+	if userID := c.Query("user_id"); userID != "" {
+		return userID
+	}
+
+	if c.Request.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxUserIDBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "请求体过大"})
+		}
+		return ""
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var req struct {
+		UserID json.Number `json:"user_id"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+	return req.UserID.String()
+}
+
+// localBuckets 进程内令牌桶（Redis 不可用时使用）
+type localBuckets struct {
+	mu        sync.Mutex
+	buckets   map[string]*localBucket
+	lastSweep time.Time
+}
+
+type localBucket struct {
+	tokens   float64
+	updated  time.Time
+	capacity float64
+	rate     float64
+}
+
+func newLocalBuckets() *localBuckets {
+	return &localBuckets{
+		buckets:   make(map[string]*localBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow 与 Redis 令牌桶脚本逻辑一致
+func (b *localBuckets) allow(key string, rate, capacity float64, now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sweep(now)
+
+	bucket, ok := b.buckets[key]
+	if !ok {
+		bucket = &localBucket{tokens: capacity, updated: now}
+		b.buckets[key] = bucket
+	}
+	bucket.rate = rate
+	bucket.capacity = capacity
+
+	elapsed := float64(now.Sub(bucket.updated).Milliseconds())
+	bucket.tokens = math.Min(capacity, bucket.tokens+math.Max(0, elapsed)*rate)
+	bucket.updated = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := math.Ceil((1 - bucket.tokens) / rate)
+	return false, time.Duration(wait) * time.Millisecond
+}
+
+// sweep 定期清理已经补满的令牌桶，避免 key 无限增长
+func (b *localBuckets) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < localSweepInterval {
+		return
+	}
+	b.lastSweep = now
+
+	for key, bucket := range b.buckets {
+		elapsed := float64(now.Sub(bucket.updated).Milliseconds())
+		if bucket.tokens+elapsed*bucket.rate >= bucket.capacity {
+			delete(b.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"rag-agent/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRateLimitEngine(limiter *RateLimiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/seckill", RateLimit(limiter), func(c *gin.Context) {
+		var req struct {
+			UserID int64 `json:"user_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"user_id": req.UserID})
+	})
+	return engine
+}
+
+func doSeckill(engine *gin.Engine, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/seckill", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+// 测试按用户限流：超限返回 429 和 Retry-After，其他用户不受影响，请求体仍可绑定
+func TestRateLimit_PerUser(t *testing.T) {
+	limiter := NewRateLimiter(nil, config.RateLimitConfig{
+		Enabled: true,
+		Rules:   []config.RateLimitRule{{Key: "user", Limit: 2, Window: time.Minute}},
+	})
+	engine := newRateLimitEngine(limiter)
+
+	for i := 0; i < 2; i++ {
+		w := doSeckill(engine, `{"user_id": 1001, "coupon_id": 1}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "1001")
+	}
+
+	w := doSeckill(engine, `{"user_id": 1001, "coupon_id": 1}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	w = doSeckill(engine, `{"user_id": 1002, "coupon_id": 1}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// 测试请求体过大时返回 413，不会绕过按用户限流
+func TestRateLimit_LargeBody(t *testing.T) {
+	limiter := NewRateLimiter(nil, config.RateLimitConfig{
+		Enabled: true,
+		Rules:   []config.RateLimitRule{{Key: "user", Limit: 1, Window: time.Minute}},
+	})
+	engine := newRateLimitEngine(limiter)
+
+	w := doSeckill(engine, `{"user_id": 1001, "padding": "`+strings.Repeat("x", maxUserIDBodySize)+`"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = doSeckill(engine, `{"user_id": 1001}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// 测试按 IP 限流：未配置受信任代理时伪造 X-Forwarded-For 无法绕过限流
+func TestRateLimit_PerIPSpoofed(t *testing.T) {
+	limiter := NewRateLimiter(nil, config.RateLimitConfig{
+		Enabled: true,
+		Rules:   []config.RateLimitRule{{Key: "ip", Limit: 1, Window: time.Minute}},
+	})
+	engine := newRateLimitEngine(limiter)
+	require.NoError(t, engine.SetTrustedProxies(nil))
+
+	doSpoofed := func(ip string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/seckill", strings.NewReader(`{"user_id": 1001}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", ip)
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, doSpoofed("10.0.0.1"))
+	assert.Equal(t, http.StatusTooManyRequests, doSpoofed("10.0.0.2"))
+
+	// 请求来自受信任代理时按 X-Forwarded-For 区分客户端
+	limiter = NewRateLimiter(nil, limiter.cfg)
+	engine = newRateLimitEngine(limiter)
+	require.NoError(t, engine.SetTrustedProxies([]string{"192.0.2.1"}))
+
+	assert.Equal(t, http.StatusOK, doSpoofed("10.0.0.1"))
+	assert.Equal(t, http.StatusOK, doSpoofed("10.0.0.2"))
+	assert.Equal(t, http.StatusTooManyRequests, doSpoofed("10.0.0.1"))
+}
+
+// 测试令牌按速率补充
+func TestLocalBuckets_Refill(t *testing.T) {
+	buckets := newLocalBuckets()
+	rate, capacity := bucketParams(config.RateLimitRule{Limit: 10, Window: time.Second, Burst: 2})
+	now := time.Now()
+
+	allowed, _ := buckets.allow("k", rate, capacity, now)
+	assert.True(t, allowed)
+	allowed, _ = buckets.allow("k", rate, capacity, now)
+	assert.True(t, allowed)
+
+	allowed, wait := buckets.allow("k", rate, capacity, now)
+	assert.False(t, allowed)
+	assert.Equal(t, 100*time.Millisecond, wait)
+
+	allowed, _ = buckets.allow("k", rate, capacity, now.Add(100*time.Millisecond))
+	assert.True(t, allowed)
+}
+
+// 测试 Window 小于 1 毫秒或 Limit 不大于 0 的规则不生效，不会除零
+func TestRateLimiter_InvalidRule(t *testing.T) {
+	limiter := NewRateLimiter(nil, config.RateLimitConfig{})
+	for _, rule := range []config.RateLimitRule{
+		{Key: "user", Limit: 1, Window: time.Microsecond},
+		{Key: "user", Limit: 0, Window: time.Second},
+	} {
+		for i := 0; i < 3; i++ {
+			allowed, wait := limiter.Allow(context.Background(), "invalid", rule)
+			assert.True(t, allowed)
+			assert.Zero(t, wait)
+		}
+	}
+
+	rate, capacity := bucketParams(config.RateLimitRule{Limit: 3, Window: 1500 * time.Microsecond})
+	assert.InDelta(t, 2.0, rate, 1e-9)
+	assert.Equal(t, 3.0, capacity)
+}
+
+// 测试 Redis 令牌桶，以及 Redis 不可用时降级为本地限流
+func TestRateLimiter_Redis(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379", DB: 1})
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis 未启动，跳过测试")
+	}
+	client.FlushDB(ctx)
+	defer func() {
+		client.FlushDB(ctx)
+		client.Close()
+	}()
+
+	rule := config.RateLimitRule{Key: "ip", Limit: 1, Window: time.Minute}
+	limiter := NewRateLimiter(client, config.RateLimitConfig{Enabled: true, Prefix: "test:ratelimit:"})
+
+	allowed, _ := limiter.Allow(ctx, "test:ratelimit:ip:1", rule)
+	require.True(t, allowed)
+	allowed, wait := limiter.Allow(ctx, "test:ratelimit:ip:1", rule)
+	assert.False(t, allowed)
+	assert.Greater(t, wait, 59*time.Second)
+
+	// Redis 不可用时使用本地令牌桶
+	broken := NewRateLimiter(redis.NewClient(&redis.Options{Addr: "localhost:1"}), config.RateLimitConfig{Enabled: true})
+	allowed, _ = broken.Allow(ctx, "k", rule)
+	assert.True(t, allowed)
+	allowed, _ = broken.Allow(ctx, "k", rule)
+	assert.False(t, allowed)
+}
+
+// 统计 Redis 命令次数的 hook
+type countingHook struct {
+	calls atomic.Int64
+}
+
+func (h *countingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *countingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.calls.Add(1)
+		return next(ctx, cmd)
+	}
+}
+
+func (h *countingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+// 测试 Redis 失败后冷却期内不再访问 Redis，冷却结束后重新尝试
+func TestRateLimiter_RedisCooldown(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:1", MaxRetries: -1})
+	defer client.Close()
+	hook := &countingHook{}
+	client.AddHook(hook)
+
+	ctx := context.Background()
+	rule := config.RateLimitRule{Key: "ip", Limit: 10, Window: time.Minute}
+	limiter := NewRateLimiter(client, config.RateLimitConfig{Enabled: true})
+
+	allowed, _ := limiter.Allow(ctx, "k", rule)
+	assert.True(t, allowed)
+	calls := hook.calls.Load()
+	require.Greater(t, calls, int64(0))
+
+	allowed, _ = limiter.Allow(ctx, "k", rule)
+	assert.True(t, allowed)
+	assert.Equal(t, calls, hook.calls.Load(), "冷却期内不应访问 Redis")
+
+	limiter.redisDownAt.Store(time.Now().Add(-redisFailureCooldown).UnixNano())
+	limiter.Allow(ctx, "k", rule)
+	assert.Greater(t, hook.calls.Load(), calls)
+}
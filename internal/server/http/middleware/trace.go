@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"rag-agent/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trace 链路追踪中间件
+// 从请求头恢复 W3C trace context（traceparent）和请求ID（X-Request-ID），缺失时生成；
+// 写入请求 context 供消息队列等下游传递，并在响应头返回请求ID
+func Trace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := tracing.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := tracing.Tracer().Start(ctx, c.Request.Method+" "+c.FullPath(), trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		ctx = tracing.EnsureTrace(ctx)
+		requestID := tracing.RequestID(ctx)
+		span.SetAttributes(attribute.String("request_id", requestID))
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(tracing.RequestIDKey, requestID)
+
+		c.Next()
+
+		if c.Writer.Status() >= 500 {
+			span.SetStatus(codes.Error, "")
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rag-agent/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 测试从请求头恢复 trace context 和请求ID，缺失时生成
+func TestTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	var traceID, requestID string
+	engine.GET("/seckill", Trace(), func(c *gin.Context) {
+		traceID = trace.SpanContextFromContext(c.Request.Context()).TraceID().String()
+		requestID = tracing.RequestID(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/seckill", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(tracing.RequestIDKey, "req-1")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+	assert.Equal(t, "req-1", requestID)
+	assert.Equal(t, "req-1", w.Header().Get(tracing.RequestIDKey))
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/seckill", nil))
+	assert.Len(t, traceID, 32)
+	assert.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+	assert.Equal(t, traceID, requestID)
+	assert.Equal(t, requestID, w.Header().Get(tracing.RequestIDKey))
+}
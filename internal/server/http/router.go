@@ -9,18 +9,24 @@ import (
 
 // Router 路由配置
 type Router struct {
-	seckillHandler  *handler.SeckillHandler
-	aisearchHandler *handler.AISearchHandler
+	seckillHandler      *handler.SeckillHandler
+	seckillAdminHandler *handler.SeckillAdminHandler
+	aisearchHandler     *handler.AISearchHandler
+	seckillRateLimiter  *middleware.RateLimiter
 }
 
 // NewRouter 创建路由
 func NewRouter(
 	seckillHandler *handler.SeckillHandler,
+	seckillAdminHandler *handler.SeckillAdminHandler,
 	aisearchHandler *handler.AISearchHandler,
+	seckillRateLimiter *middleware.RateLimiter,
 ) *Router {
 	return &Router{
-		seckillHandler:  seckillHandler,
-		aisearchHandler: aisearchHandler,
+		seckillHandler:      seckillHandler,
+		seckillAdminHandler: seckillAdminHandler,
+		aisearchHandler:     aisearchHandler,
+		seckillRateLimiter:  seckillRateLimiter,
 	}
 }
 
@@ -29,6 +35,7 @@ func (r *Router) Setup() *gin.Engine {
 	router := gin.New()
 
 	// 使用中间件
+	router.Use(middleware.Trace())
 	router.Use(middleware.Logger())
 	router.Use(middleware.CORS())
 	router.Use(gin.Recovery())
@@ -39,9 +46,32 @@ func (r *Router) Setup() *gin.Engine {
 		// 秒杀相关路由
 		seckill := v1.Group("/seckill")
 		{
-			seckill.POST("/", r.seckillHandler.Seckill)
+			seckill.POST("/", middleware.RateLimit(r.seckillRateLimiter), r.seckillHandler.Seckill)
+			seckill.GET("/token/:coupon_id", middleware.RateLimit(r.seckillRateLimiter), r.seckillHandler.IssueToken)
+			seckill.POST("/queue", middleware.RateLimit(r.seckillRateLimiter), r.seckillHandler.JoinQueue)
+			seckill.GET("/queue/:coupon_id", r.seckillHandler.GetQueueStatus)
 			seckill.GET("/coupon/:id", r.seckillHandler.GetCoupon)
 			seckill.POST("/init-stock", r.seckillHandler.InitStock)
+			seckill.GET("/order/:id", r.seckillHandler.GetOrder)
+			seckill.POST("/order/:id/pay", r.seckillHandler.PayOrder)
+			seckill.GET("/orders", r.seckillHandler.ListOrders)
+
+			// 秒杀管理路由
+			admin := seckill.Group("/admin")
+			{
+				admin.GET("/reconcile", r.seckillAdminHandler.CheckStock)
+				admin.POST("/reconcile", r.seckillAdminHandler.RepairStock)
+				admin.POST("/coupons", r.seckillAdminHandler.CreateCoupon)
+				admin.GET("/coupons", r.seckillAdminHandler.ListCoupons)
+				admin.PUT("/coupons/:id", r.seckillAdminHandler.UpdateCoupon)
+				admin.DELETE("/coupons/:id", r.seckillAdminHandler.DeleteCoupon)
+				admin.POST("/orders/:id/refund", r.seckillAdminHandler.RefundOrder)
+				admin.GET("/orders/:id/logs", r.seckillAdminHandler.GetOrderStatusLogs)
+				admin.GET("/dead-letters", r.seckillAdminHandler.ListDeadLetters)
+				admin.GET("/dead-letters/:id", r.seckillAdminHandler.GetDeadLetter)
+				admin.POST("/dead-letters/:id/replay", r.seckillAdminHandler.ReplayDeadLetter)
+				admin.POST("/dead-letters/:id/discard", r.seckillAdminHandler.DiscardDeadLetter)
+			}
 		}
 
 		// AI搜索相关路由 - 整合了LLM和RAG能力
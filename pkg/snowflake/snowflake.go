@@ -0,0 +1,123 @@
+package snowflake
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ID 布局：1 位符号位 | 41 位毫秒时间戳 | 10 位 workerID | 12 位序列号
+const (
+	workerIDBits = 10
+	sequenceBits = 12
+
+	MaxWorkerID = -1 ^ (-1 << workerIDBits) // 1023
+	maxSequence = -1 ^ (-1 << sequenceBits) // 4095
+
+	workerIDShift  = sequenceBits
+	timestampShift = sequenceBits + workerIDBits
+
+	// maxBackwardWait 时钟回拨在此范围内时等待追上，超出则报错
+	maxBackwardWait = 10 * time.Millisecond
+)
+
+// Epoch 起始时间（2024-01-01 00:00:00 UTC），时间戳从此处开始计算
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ErrClockBackwards 时钟回拨过大
+var ErrClockBackwards = errors.New("时钟回拨，拒绝生成ID")
+
+// Generator Snowflake ID 生成器（并发安全）
+type Generator struct {
+	mu       sync.Mutex
+	lease    *WorkerLease // 非空时每次生成前从租约获取 workerID
+	workerID int64
+	lastTime int64
+	sequence int64
+	now      func() time.Time
+}
+
+// NewGenerator 创建 ID 生成器
+func NewGenerator(workerID int64) (*Generator, error) {
+	if workerID < 0 || workerID > MaxWorkerID {
+		return nil, fmt.Errorf("workerID 超出范围 [0, %d]: %d", MaxWorkerID, workerID)
+	}
+
+	return &Generator{
+		workerID: workerID,
+		now:      time.Now,
+	}, nil
+}
+
+// NewLeasedGenerator 创建使用租约 workerID 的 ID 生成器
+// 租约失效期间 NextID 返回 ErrWorkerLeaseLost，避免与接手该 workerID 的实例生成重复 ID
+func NewLeasedGenerator(lease *WorkerLease) *Generator {
+	return &Generator{
+		lease:    lease,
+		workerID: lease.ID(),
+		now:      time.Now,
+	}
+}
+
+// NextID 生成下一个 ID
+func (g *Generator) NextID() (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.lease != nil {
+		workerID, err := g.lease.WorkerID()
+		if err != nil {
+			return 0, err
+		}
+		g.workerID = workerID
+	}
+
+	ts := g.timestamp()
+
+	// 时钟回拨：小幅回拨等待追上，否则报错
+	if ts < g.lastTime {
+		if time.Duration(g.lastTime-ts)*time.Millisecond > maxBackwardWait {
+			return 0, fmt.Errorf("%w: 回拨 %dms", ErrClockBackwards, g.lastTime-ts)
+		}
+		for ts < g.lastTime {
+			time.Sleep(time.Millisecond)
+			ts = g.timestamp()
+		}
+	}
+
+	if ts == g.lastTime {
+		g.sequence = (g.sequence + 1) & maxSequence
+		// 同一毫秒内序列号用尽，等待下一毫秒
+		if g.sequence == 0 {
+			for ts <= g.lastTime {
+				ts = g.timestamp()
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+
+	g.lastTime = ts
+	return ts<<timestampShift | g.workerID<<workerIDShift | g.sequence, nil
+}
+
+// WorkerID 返回生成器的 workerID
+func (g *Generator) WorkerID() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.workerID
+}
+
+// timestamp 当前时间相对 Epoch 的毫秒数
+func (g *Generator) timestamp() int64 {
+	return g.now().Sub(Epoch).Milliseconds()
+}
+
+// Parse 解析 ID 中的生成时间、workerID 和序列号
+func Parse(id int64) (t time.Time, workerID int64, sequence int64) {
+	t = Epoch.Add(time.Duration(id>>timestampShift) * time.Millisecond)
+	workerID = (id >> workerIDShift) & MaxWorkerID
+	sequence = id & maxSequence
+	return t, workerID, sequence
+}
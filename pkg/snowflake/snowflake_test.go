@@ -0,0 +1,76 @@
+package snowflake
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewGenerator_InvalidWorkerID(t *testing.T) {
+	_, err := NewGenerator(-1)
+	assert.Error(t, err)
+
+	_, err = NewGenerator(MaxWorkerID + 1)
+	assert.Error(t, err)
+}
+
+func TestGenerator_NextID(t *testing.T) {
+	g, err := NewGenerator(42)
+	require.NoError(t, err)
+
+	id, err := g.NextID()
+	require.NoError(t, err)
+	assert.Greater(t, id, int64(0))
+
+	ts, workerID, _ := Parse(id)
+	assert.Equal(t, int64(42), workerID)
+	assert.WithinDuration(t, time.Now(), ts, time.Second)
+}
+
+func TestGenerator_UniqueConcurrent(t *testing.T) {
+	g, err := NewGenerator(1)
+	require.NoError(t, err)
+
+	const goroutines, perGoroutine = 8, 5000
+	ids := make(chan int64, goroutines*perGoroutine)
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				id, err := g.NextID()
+				assert.NoError(t, err)
+				ids <- id
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[int64]struct{}, goroutines*perGoroutine)
+	for id := range ids {
+		_, dup := seen[id]
+		require.False(t, dup, "ID 重复: %d", id)
+		seen[id] = struct{}{}
+	}
+}
+
+func TestGenerator_ClockBackwards(t *testing.T) {
+	g, err := NewGenerator(1)
+	require.NoError(t, err)
+
+	now := time.Now()
+	g.now = func() time.Time { return now }
+	_, err = g.NextID()
+	require.NoError(t, err)
+
+	// 回拨超过允许范围
+	g.now = func() time.Time { return now.Add(-time.Second) }
+	_, err = g.NextID()
+	assert.ErrorIs(t, err, ErrClockBackwards)
+}
@@ -0,0 +1,200 @@
+package snowflake
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrNoWorkerID 所有 workerID 均已被占用
+	ErrNoWorkerID = errors.New("没有可用的 workerID")
+	// ErrWorkerLeaseLost workerID 租约已过期或被其他实例占用，重新租用前不能生成 ID
+	ErrWorkerLeaseLost = errors.New("workerID 租约已失效")
+)
+
+// 仅当 key 的值仍为本实例 token 时续期
+var renewScript = redis.NewScript(`
+	if redis.call('GET', KEYS[1]) == ARGV[1] then
+		return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	end
+	return 0
+`)
+
+// 仅当 key 的值仍为本实例 token 时删除
+var releaseScript = redis.NewScript(`
+	if redis.call('GET', KEYS[1]) == ARGV[1] then
+		return redis.call('DEL', KEYS[1])
+	end
+	return 0
+`)
+
+// WorkerLease 通过 Redis 租用的 workerID
+// 每个实例用 SET NX 占用 <prefix><workerID>，后台定期续期，关闭时释放；
+// 租约只在最近一次续期成功后的 ttl 内有效，续期失败超过 ttl 或发现 key 已被其他实例占用时失效，
+// 后台重新租用新的 workerID，失效期间 WorkerID 返回 ErrWorkerLeaseLost
+type WorkerLease struct {
+	client *redis.Client
+	prefix string
+	token  string
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu         sync.Mutex
+	key        string
+	id         int64
+	validUntil time.Time // 租约有效期截止时间，零值表示已失效
+
+	stopCh    chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// AcquireWorkerID 从 Redis 中租用一个未被占用的 workerID
+func AcquireWorkerID(ctx context.Context, client *redis.Client, prefix string, ttl time.Duration) (*WorkerLease, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	lease := &WorkerLease{
+		client: client,
+		prefix: prefix,
+		token:  token,
+		ttl:    ttl,
+		now:    time.Now,
+		stopCh: make(chan struct{}),
+	}
+	if err := lease.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	lease.wg.Add(1)
+	go lease.keepAlive()
+	return lease, nil
+}
+
+// acquire 依次尝试 SET NX 占用 workerID，成功后更新租约
+func (l *WorkerLease) acquire(ctx context.Context) error {
+	for id := int64(0); id <= MaxWorkerID; id++ {
+		key := fmt.Sprintf("%s%d", l.prefix, id)
+		start := l.now()
+		ok, err := l.client.SetNX(ctx, key, l.token, l.ttl).Result()
+		if err != nil {
+			return fmt.Errorf("租用 workerID 失败: %w", err)
+		}
+		if !ok {
+			continue
+		}
+
+		l.mu.Lock()
+		l.key = key
+		l.id = id
+		l.validUntil = start.Add(l.ttl)
+		l.mu.Unlock()
+		return nil
+	}
+
+	return ErrNoWorkerID
+}
+
+// ID 返回最近租用到的 workerID（不检查租约是否有效）
+func (l *WorkerLease) ID() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.id
+}
+
+// WorkerID 返回当前有效的 workerID，租约失效时返回 ErrWorkerLeaseLost
+func (l *WorkerLease) WorkerID() (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.now().Before(l.validUntil) {
+		return 0, fmt.Errorf("%w: workerID=%d", ErrWorkerLeaseLost, l.id)
+	}
+	return l.id, nil
+}
+
+// Close 停止续期并释放 workerID，可以重复调用
+func (l *WorkerLease) Close(ctx context.Context) error {
+	l.closeOnce.Do(func() { close(l.stopCh) })
+	l.wg.Wait()
+
+	l.mu.Lock()
+	key := l.key
+	l.validUntil = time.Time{}
+	l.mu.Unlock()
+
+	if err := releaseScript.Run(ctx, l.client, []string{key}, l.token).Err(); err != nil {
+		return fmt.Errorf("释放 workerID 失败: %w", err)
+	}
+	return nil
+}
+
+// keepAlive 每 ttl/3 续期一次，租约丢失时重新租用
+func (l *WorkerLease) keepAlive() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stopCh:
+			return
+		case <-ticker.C:
+			l.renew()
+		}
+	}
+}
+
+// renew 续期租约；以发送续期请求前的时间计算有效期，保证早于 Redis 中 key 的过期时间
+func (l *WorkerLease) renew() {
+	l.mu.Lock()
+	key, id := l.key, l.id
+	l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+	defer cancel()
+
+	start := l.now()
+	n, err := renewScript.Run(ctx, l.client, []string{key}, l.token, l.ttl.Milliseconds()).Int64()
+	if err != nil {
+		// 租约在有效期截止后自动失效
+		log.Printf("续期 workerID 失败: %v, workerID=%d", err, id)
+		return
+	}
+	if n == 1 {
+		l.mu.Lock()
+		l.validUntil = start.Add(l.ttl)
+		l.mu.Unlock()
+		return
+	}
+
+	// key 已过期或被其他实例占用，立即停止使用该 workerID 并重新租用
+	log.Printf("workerID 租约已丢失，重新租用: workerID=%d", id)
+	l.mu.Lock()
+	l.validUntil = time.Time{}
+	l.mu.Unlock()
+	if err := l.acquire(ctx); err != nil {
+		log.Printf("重新租用 workerID 失败: %v", err)
+		return
+	}
+	log.Printf("重新租用 workerID 成功: workerID=%d", l.ID())
+}
+
+// newToken 生成实例唯一标识
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成实例标识失败: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
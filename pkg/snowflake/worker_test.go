@@ -0,0 +1,135 @@
+package snowflake
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireWorkerID(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+		DB:   1, // 使用测试数据库
+	})
+	defer client.Close()
+
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis 未启动，跳过测试")
+	}
+	client.FlushDB(ctx)
+	defer client.FlushDB(ctx)
+
+	// 两个实例拿到不同的 workerID
+	first, err := AcquireWorkerID(ctx, client, "test:worker:", time.Minute)
+	require.NoError(t, err)
+	second, err := AcquireWorkerID(ctx, client, "test:worker:", time.Minute)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID(), second.ID())
+
+	// 释放后可以被重新租用
+	require.NoError(t, first.Close(ctx))
+	third, err := AcquireWorkerID(ctx, client, "test:worker:", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID(), third.ID())
+
+	// 重复关闭不会 panic，也不会释放已被其他实例租用的 workerID
+	require.NoError(t, first.Close(ctx))
+	owner, err := client.Get(ctx, third.key).Result()
+	require.NoError(t, err)
+	assert.Equal(t, third.token, owner)
+
+	require.NoError(t, second.Close(ctx))
+	require.NoError(t, third.Close(ctx))
+}
+
+// 测试租约过期后不再以旧 workerID 生成 ID，重新租用后使用新 workerID
+func TestLeasedGenerator_LeaseExpired(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Now()
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	lease := &WorkerLease{ttl: time.Second, now: clock, id: 7, validUntil: now.Add(time.Second)}
+	g := NewLeasedGenerator(lease)
+
+	id, err := g.NextID()
+	require.NoError(t, err)
+	_, workerID, _ := Parse(id)
+	assert.Equal(t, int64(7), workerID)
+
+	// 续期失败超过 ttl，租约过期
+	mu.Lock()
+	now = now.Add(time.Second)
+	mu.Unlock()
+	for i := 0; i < 3; i++ {
+		_, err := g.NextID()
+		assert.ErrorIs(t, err, ErrWorkerLeaseLost)
+	}
+
+	// 重新租用到新的 workerID
+	lease.mu.Lock()
+	lease.id = 8
+	lease.validUntil = clock().Add(time.Second)
+	lease.mu.Unlock()
+	id, err = g.NextID()
+	require.NoError(t, err)
+	_, workerID, _ = Parse(id)
+	assert.Equal(t, int64(8), workerID)
+}
+
+// 测试 key 被其他实例占用后续期发现丢失，立即停止使用旧 workerID 并重新租用
+func TestWorkerLease_Lost(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+		DB:   1, // 使用测试数据库
+	})
+	defer client.Close()
+
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis 未启动，跳过测试")
+	}
+	client.FlushDB(ctx)
+	defer client.FlushDB(ctx)
+
+	lease, err := AcquireWorkerID(ctx, client, "test:worker:", time.Minute)
+	require.NoError(t, err)
+	defer lease.Close(ctx)
+	g := NewLeasedGenerator(lease)
+	oldID := lease.ID()
+
+	// 模拟租约过期后被其他实例占用
+	require.NoError(t, client.Set(ctx, "test:worker:0", "other", time.Minute).Err())
+	lease.renew()
+
+	_, err = lease.WorkerID()
+	require.NoError(t, err)
+	assert.NotEqual(t, oldID, lease.ID())
+	for i := 0; i < 100; i++ {
+		id, err := g.NextID()
+		require.NoError(t, err)
+		_, workerID, _ := Parse(id)
+		assert.NotEqual(t, oldID, workerID)
+	}
+}
+
+// 测试重复关闭租约不会 panic（不依赖 Redis，释放失败只返回错误）
+func TestWorkerLease_CloseTwice(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:0", MaxRetries: -1})
+	defer client.Close()
+
+	lease := &WorkerLease{client: client, key: "test:worker:0", stopCh: make(chan struct{})}
+	ctx := context.Background()
+	assert.NotPanics(t, func() {
+		assert.Error(t, lease.Close(ctx))
+		assert.Error(t, lease.Close(ctx))
+	})
+}
@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDKey 请求ID在 HTTP 请求头和消息属性中的 key
+const RequestIDKey = "X-Request-ID"
+
+// tracerName 本服务创建 span 使用的 tracer 名称
+const tracerName = "rag-agent"
+
+// propagator 按 W3C Trace Context 读写 traceparent / tracestate
+var propagator = propagation.TraceContext{}
+
+type requestIDKey struct{}
+
+// WithRequestID 将请求ID写入 context
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID 返回 context 中的请求ID，不存在时返回空字符串
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// Inject 将 context 中的 trace context 和请求ID写入 carrier（HTTP 请求头、消息属性等）
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	propagator.Inject(ctx, carrier)
+	if requestID := RequestID(ctx); requestID != "" {
+		carrier.Set(RequestIDKey, requestID)
+	}
+}
+
+// Extract 从 carrier 恢复 trace context 和请求ID，carrier 中没有的字段保持 context 原值
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	ctx = propagator.Extract(ctx, carrier)
+	if requestID := carrier.Get(RequestIDKey); requestID != "" {
+		ctx = WithRequestID(ctx, requestID)
+	}
+	return ctx
+}
+
+// EnsureTrace 保证 context 带有 trace context 和请求ID
+// 没有 span context 时生成新的根 span context（未采样），没有请求ID时以 trace ID 作为请求ID
+func EnsureTrace(ctx context.Context) context.Context {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		var traceID trace.TraceID
+		var spanID trace.SpanID
+		rand.Read(traceID[:])
+		rand.Read(spanID[:])
+		sc = trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID})
+		ctx = trace.ContextWithSpanContext(ctx, sc)
+	}
+	if RequestID(ctx) == "" {
+		ctx = WithRequestID(ctx, sc.TraceID().String())
+	}
+	return ctx
+}
+
+// Tracer 返回全局 TracerProvider 的 tracer；未注册 TracerProvider 时 span 不记录，只传递 trace context
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Logf 输出日志，context 带有请求ID时在日志前加上 [request_id=...]
+func Logf(ctx context.Context, format string, args ...any) {
+	if requestID := RequestID(ctx); requestID != "" {
+		log.Printf("[request_id=%s] %s", requestID, fmt.Sprintf(format, args...))
+		return
+	}
+	log.Printf(format, args...)
+}
@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 测试 trace context 和请求ID经 carrier 传递
+func TestInjectExtract(t *testing.T) {
+	ctx := EnsureTrace(WithRequestID(context.Background(), "req-1"))
+	sc := trace.SpanContextFromContext(ctx)
+	require.True(t, sc.IsValid())
+
+	carrier := propagation.MapCarrier{}
+	Inject(ctx, carrier)
+	assert.Equal(t, "req-1", carrier[RequestIDKey])
+	assert.Contains(t, carrier["traceparent"], sc.TraceID().String())
+
+	restored := Extract(context.Background(), carrier)
+	assert.Equal(t, "req-1", RequestID(restored))
+	assert.Equal(t, sc.TraceID(), trace.SpanContextFromContext(restored).TraceID())
+	assert.True(t, trace.SpanContextFromContext(restored).IsRemote())
+}
+
+// 测试没有 trace context 和请求ID时生成，已有时保留
+func TestEnsureTrace(t *testing.T) {
+	ctx := EnsureTrace(context.Background())
+	sc := trace.SpanContextFromContext(ctx)
+	require.True(t, sc.IsValid())
+	assert.Equal(t, sc.TraceID().String(), RequestID(ctx))
+
+	again := EnsureTrace(ctx)
+	assert.Equal(t, sc, trace.SpanContextFromContext(again))
+	assert.Equal(t, RequestID(ctx), RequestID(again))
+
+	// carrier 中没有 trace context 时保持原值
+	assert.Equal(t, "", RequestID(Extract(context.Background(), propagation.MapCarrier{})))
+}
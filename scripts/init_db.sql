@@ -14,11 +14,13 @@ CREATE TABLE IF NOT EXISTS coupons (
     description TEXT COMMENT '优惠券描述',
     total_stock BIGINT NOT NULL DEFAULT 0 COMMENT '总库存',
     remain_stock BIGINT NOT NULL DEFAULT 0 COMMENT '剩余库存',
+    stock_buckets INT NOT NULL DEFAULT 1 COMMENT 'Redis 库存分桶数，1 表示不分桶',
     start_time TIMESTAMP NOT NULL COMMENT '开始时间',
     end_time TIMESTAMP NOT NULL COMMENT '结束时间',
     status TINYINT NOT NULL DEFAULT 0 COMMENT '状态: 0-未开始, 1-进行中, 2-已结束',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP NULL DEFAULT NULL COMMENT '删除时间（软删除）',
     INDEX idx_status (status),
     INDEX idx_time (start_time, end_time)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='秒杀-优惠券表';
@@ -28,7 +30,7 @@ CREATE TABLE IF NOT EXISTS orders (
     id BIGINT AUTO_INCREMENT PRIMARY KEY,
     user_id BIGINT NOT NULL COMMENT '用户ID',
     coupon_id BIGINT NOT NULL COMMENT '优惠券ID',
-    status TINYINT NOT NULL DEFAULT 0 COMMENT '状态: 0-待支付, 1-已支付, 2-已取消',
+    status TINYINT NOT NULL DEFAULT 0 COMMENT '状态: 0-待支付, 1-已支付, 2-已取消, 3-已退款',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     INDEX idx_user_id (user_id),
@@ -37,12 +39,25 @@ CREATE TABLE IF NOT EXISTS orders (
     UNIQUE KEY uk_user_coupon (user_id, coupon_id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='秒杀-订单表';
 
--- 补偿任务表（MQ失败补偿，预留）
+-- 订单状态变更日志表（状态机每次变更写入一条，用于审计）
+CREATE TABLE IF NOT EXISTS order_status_log (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    order_id BIGINT NOT NULL COMMENT '订单ID',
+    from_status TINYINT NOT NULL COMMENT '变更前状态',
+    to_status TINYINT NOT NULL COMMENT '变更后状态',
+    reason VARCHAR(255) NOT NULL DEFAULT '' COMMENT '变更原因',
+    actor VARCHAR(64) NOT NULL DEFAULT '' COMMENT '操作人: user-用户, system-系统, 其他为管理员',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_order_id (order_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='秒杀-订单状态变更日志表';
+
+-- 补偿任务表（MQ发送失败后由补偿 worker 重新投递）
 CREATE TABLE IF NOT EXISTS compensation_tasks (
     id BIGINT AUTO_INCREMENT PRIMARY KEY,
     user_id BIGINT NOT NULL COMMENT '用户ID',
     coupon_id BIGINT NOT NULL COMMENT '优惠券ID',
     order_id BIGINT NOT NULL COMMENT '订单ID',
+    order_created_at TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) COMMENT '下单时间，重新投递时作为订单创建时间',
     status TINYINT NOT NULL DEFAULT 0 COMMENT '状态: 0-待处理, 1-处理中, 2-已完成, -1-失败',
     retry_count INT NOT NULL DEFAULT 0 COMMENT '重试次数',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
@@ -52,6 +67,23 @@ CREATE TABLE IF NOT EXISTS compensation_tasks (
     INDEX idx_retry_count (retry_count)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='秒杀-补偿任务表';
 
+-- 死信表（订单消息无法解析或超过最大重新消费次数后转入，供管理员重放或丢弃）
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    msg_id VARCHAR(128) NOT NULL DEFAULT '' COMMENT '消息ID',
+    topic VARCHAR(255) NOT NULL DEFAULT '' COMMENT '主题',
+    tag VARCHAR(255) NOT NULL DEFAULT '' COMMENT '标签',
+    msg_keys VARCHAR(512) NOT NULL DEFAULT '' COMMENT '消息 Key，多个以空格分隔',
+    payload MEDIUMTEXT NOT NULL COMMENT '原始消息体',
+    error VARCHAR(1024) NOT NULL DEFAULT '' COMMENT '最后一次消费失败原因',
+    reconsume_times INT NOT NULL DEFAULT 0 COMMENT '进入死信时已重新消费次数',
+    status TINYINT NOT NULL DEFAULT 0 COMMENT '状态: 0-待处理, 1-已重放, 2-已丢弃',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_status (status),
+    INDEX idx_msg_id (msg_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='秒杀-死信表';
+
 -- ==========================================
 -- 其他模块表（预留）
 -- ==========================================